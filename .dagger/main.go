@@ -33,7 +33,10 @@ func (m RegistryAuth) Test(
 		Version: goVersion,
 	}).
 		WithSource(m.Source).
-		Exec([]string{"go", "test", "-race", "./..."})
+		Exec([]string{"go", "test", "-race", "./..."}).
+		// SQLite tests live in a separate module to keep the driver out of the library's dependencies
+		WithWorkdir("auth/authn/sql/sqlitetest").
+		WithExec([]string{"go", "test", "-race", "./..."})
 }
 
 func (m RegistryAuth) Lint() *dagger.Container {
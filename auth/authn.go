@@ -3,6 +3,8 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 // ErrAuthenticationFailed is returned when authentication fails.
@@ -22,3 +24,40 @@ type PasswordAuthenticator interface {
 type RefreshTokenAuthenticator interface {
 	AuthenticateRefreshToken(ctx context.Context, service string, refreshToken string) (Subject, error)
 }
+
+// ClientAuthenticator authenticates a (confidential) client using the "client_credentials" grant.
+//
+// It returns an [ErrAuthenticationFailed] error in case credentials are invalid.
+type ClientAuthenticator interface {
+	AuthenticateClient(ctx context.Context, clientID string, clientSecret string) (Subject, error)
+}
+
+// SubjectRepository looks up a [Subject] based on an identifier.
+//
+// It returns an [ErrAuthenticationFailed] error if the subject does not exist (anymore) or is disabled.
+type SubjectRepository interface {
+	GetSubjectByID(ctx context.Context, id SubjectID) (Subject, error)
+}
+
+// ErrTooManyAttempts is returned when a client is temporarily blocked from authenticating
+// (eg. because of too many failed attempts).
+//
+// Implementations SHOULD return a [TooManyAttemptsError] to tell the client when it may try again.
+var ErrTooManyAttempts = errors.New("too many authentication attempts")
+
+// TooManyAttemptsError is returned when a client is temporarily blocked from authenticating.
+//
+// It matches [ErrTooManyAttempts] when using [errors.Is].
+type TooManyAttemptsError struct {
+	// RetryAfter is the amount of time the client has to wait before trying again.
+	RetryAfter time.Duration
+}
+
+func (e TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrTooManyAttempts.Error(), e.RetryAfter)
+}
+
+// Is implements the interface used by [errors.Is].
+func (e TooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
@@ -2,29 +2,87 @@ package authn
 
 import (
 	"context"
+	"fmt"
 	"maps"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/portward/registry-auth/auth"
 )
 
 // UserAuthenticator is a static list of users.
+//
+// Password hashes are verified by a [PasswordHasher] (see [WithPasswordHasher]).
 type UserAuthenticator struct {
 	entries map[string]User
+
+	hasher       PasswordHasher
+	updater      PasswordHashUpdater
+	errorHandler auth.ErrorHandler
+}
+
+// PasswordHashUpdater stores a new password hash of a user.
+//
+// Authenticators call it after a successful login if the stored hash is outdated
+// (ie. it uses a different algorithm or different parameters than the preferred ones).
+type PasswordHashUpdater interface {
+	UpdatePasswordHash(ctx context.Context, username string, passwordHash string) error
+}
+
+// UserAuthenticatorOption configures a [UserAuthenticator].
+type UserAuthenticatorOption interface {
+	applyUserAuthenticator(a *UserAuthenticator)
+}
+
+// WithPasswordHasher sets the [PasswordHasher] used to verify passwords. Defaults to [DefaultPasswordHasher].
+func WithPasswordHasher(hasher PasswordHasher) UserAuthenticatorOption {
+	return withPasswordHasher{hasher}
+}
+
+type withPasswordHasher struct {
+	hasher PasswordHasher
+}
+
+func (w withPasswordHasher) applyUserAuthenticator(a *UserAuthenticator) {
+	a.hasher = w.hasher
+}
+
+// WithPasswordHashUpdater upgrades outdated password hashes after a successful login.
+//
+// Errors are not fatal: they are passed to errorHandler (if any).
+//
+// Note: [UserAuthenticator] keeps using the user list it was created with,
+// so the updater is responsible for making sure the new hash is used the next time the list is loaded.
+func WithPasswordHashUpdater(updater PasswordHashUpdater, errorHandler auth.ErrorHandler) UserAuthenticatorOption {
+	return withPasswordHashUpdater{updater, errorHandler}
+}
+
+type withPasswordHashUpdater struct {
+	updater      PasswordHashUpdater
+	errorHandler auth.ErrorHandler
+}
+
+func (w withPasswordHashUpdater) applyUserAuthenticator(a *UserAuthenticator) {
+	a.updater = w.updater
+	a.errorHandler = w.errorHandler
 }
 
 // NewUserAuthenticator returns a new [UserAuthenticator].
-func NewUserAuthenticator(users []User) UserAuthenticator {
+func NewUserAuthenticator(users []User, opts ...UserAuthenticatorOption) UserAuthenticator {
 	entries := make(map[string]User, len(users))
 
 	for _, user := range users {
 		entries[user.Username] = user
 	}
 
-	return UserAuthenticator{
+	a := UserAuthenticator{
 		entries: entries,
+		hasher:  DefaultPasswordHasher,
+	}
+
+	for _, opt := range opts {
+		opt.applyUserAuthenticator(&a)
 	}
+
+	return a
 }
 
 // User is an [auth.Subject].
@@ -57,27 +115,38 @@ func (u User) Attributes() map[string]any {
 }
 
 // AuthenticatePassword implements [auth.PasswordAuthenticator].
-func (a UserAuthenticator) AuthenticatePassword(_ context.Context, username string, password string) (auth.Subject, error) {
-	if a.entries == nil {
-		return nil, auth.ErrAuthenticationFailed
-	}
-
+func (a UserAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
 	user, ok := a.entries[username]
 	if !ok || !user.Enabled {
 		// timing attack paranoia
-		_ = bcrypt.CompareHashAndPassword([]byte{}, []byte(password))
+		a.hasher.VerifyDummy(password)
 
 		return nil, auth.ErrAuthenticationFailed
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	if err != nil {
+	ok, needsRehash := a.hasher.Verify(user.PasswordHash, password)
+	if !ok {
 		return nil, auth.ErrAuthenticationFailed
 	}
 
+	if needsRehash && a.updater != nil {
+		a.rehash(ctx, username, password)
+	}
+
 	return user, nil
 }
 
+func (a UserAuthenticator) rehash(ctx context.Context, username string, password string) {
+	passwordHash, err := a.hasher.Hash(password)
+	if err == nil {
+		err = a.updater.UpdatePasswordHash(ctx, username, passwordHash)
+	}
+
+	if err != nil && a.errorHandler != nil {
+		a.errorHandler.Handle(fmt.Errorf("upgrading password hash of user %q: %w", username, err))
+	}
+}
+
 // GetSubjectByID implements [SubjectRepository].
 func (a UserAuthenticator) GetSubjectByID(_ context.Context, id auth.SubjectID) (auth.Subject, error) {
 	user, ok := a.entries[id.String()]
@@ -108,9 +177,7 @@ type RefreshTokenVerifier interface {
 }
 
 // SubjectRepository looks up an [auth.Subject] based on an identifier.
-type SubjectRepository interface {
-	GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error)
-}
+type SubjectRepository = auth.SubjectRepository
 
 // AuthenticateRefreshToken implements [auth.RefreshTokenAuthenticator].
 func (a RefreshTokenAuthenticator) AuthenticateRefreshToken(ctx context.Context, service string, refreshToken string) (auth.Subject, error) {
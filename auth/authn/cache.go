@@ -0,0 +1,328 @@
+package authn
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// DefaultCacheTTL is the default amount of time a successful verification is remembered by a [CachingAuthenticator].
+const DefaultCacheTTL = time.Minute
+
+// DefaultCacheMaxEntries is the default number of verifications remembered by a [CachingAuthenticator].
+const DefaultCacheMaxEntries = 10000
+
+// DefaultCacheLoadTimeout is the default amount of time a [CachingAuthenticator] waits for a (shared) verification.
+const DefaultCacheLoadTimeout = 30 * time.Second
+
+// CacheConfig configures a [CachingAuthenticator].
+type CacheConfig struct {
+	// TTL is the amount of time a successful verification is remembered. Defaults to [DefaultCacheTTL].
+	TTL time.Duration
+
+	// MaxEntries is the maximum number of remembered verifications. Defaults to [DefaultCacheMaxEntries].
+	MaxEntries int
+
+	// LoadTimeout limits how long a verification shared by concurrent requests may take. Defaults to [DefaultCacheLoadTimeout].
+	// Shared verifications are not canceled with the request that started them, so that other requests waiting for the result do not fail.
+	LoadTimeout time.Duration
+
+	// Key is the secret used to derive cache keys from credentials.
+	// If empty, a random key is generated (which is what you want unless the cache is shared between processes).
+	Key []byte
+
+	// Clock is used to determine the current time. Defaults to the real time.
+	Clock clockwork.Clock
+}
+
+// CachingAuthenticator remembers successful password verifications for a short period of time,
+// so that expensive hash comparisons (eg. bcrypt) do not run for every token request.
+//
+// Credentials are never stored: cache entries are keyed by an HMAC of the username and password.
+// Failed verifications are never cached.
+// Concurrent verifications of identical credentials are coalesced into a single call to the underlying authenticator.
+//
+// If the underlying authenticator also implements [SubjectRepository], cached subjects are revalidated on every hit:
+// if the subject no longer exists, got disabled or changed in any way (eg. its password hash got rotated),
+// the entry is dropped and credentials are verified again.
+// Changes are detected by comparing a fingerprint of the subject returned by the repository
+// when the entry was stored with one of the subject it currently returns.
+// Otherwise, use [CachingAuthenticator.Invalidate] and [CachingAuthenticator.InvalidateAll] when users change.
+// Verifications still in progress when the cache is invalidated are not cached.
+type CachingAuthenticator struct {
+	authenticator     auth.PasswordAuthenticator
+	subjectRepository SubjectRepository
+
+	ttl         time.Duration
+	maxEntries  int
+	loadTimeout time.Duration
+	key         []byte
+	clock       clockwork.Clock
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+
+	// generation is incremented by every invalidation, so that verifications started before are not cached
+	generation uint64
+
+	group singleflight.Group
+}
+
+type cacheEntry struct {
+	username    string
+	subject     auth.Subject
+	fingerprint string
+	expiresAt   time.Time
+}
+
+// subjectFingerprint returns a digest of everything a subject holds (including unexported fields, eg. password hashes).
+func subjectFingerprint(subject auth.Subject) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", subject)))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// NewCachingAuthenticator returns a new [CachingAuthenticator].
+func NewCachingAuthenticator(authenticator auth.PasswordAuthenticator, config CacheConfig) *CachingAuthenticator {
+	a := &CachingAuthenticator{
+		authenticator: authenticator,
+		ttl:           config.TTL,
+		maxEntries:    config.MaxEntries,
+		loadTimeout:   config.LoadTimeout,
+		key:           config.Key,
+		clock:         config.Clock,
+		entries:       make(map[string]cacheEntry),
+	}
+
+	if subjectRepository, ok := authenticator.(SubjectRepository); ok {
+		a.subjectRepository = subjectRepository
+	}
+
+	if a.ttl <= 0 {
+		a.ttl = DefaultCacheTTL
+	}
+
+	if a.maxEntries <= 0 {
+		a.maxEntries = DefaultCacheMaxEntries
+	}
+
+	if a.loadTimeout <= 0 {
+		a.loadTimeout = DefaultCacheLoadTimeout
+	}
+
+	if len(a.key) == 0 {
+		a.key = make([]byte, sha256.Size)
+
+		if _, err := rand.Read(a.key); err != nil {
+			panic(err)
+		}
+	}
+
+	if a.clock == nil {
+		a.clock = clockwork.NewRealClock()
+	}
+
+	return a
+}
+
+func (a *CachingAuthenticator) cacheKey(username string, password string) string {
+	mac := hmac.New(sha256.New, a.key)
+
+	// Length prefix makes sure different username/password splits never produce the same key
+	_ = binary.Write(mac, binary.BigEndian, uint64(len(username)))
+	mac.Write([]byte(username))
+	mac.Write([]byte(password))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+func (a *CachingAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	key := a.cacheKey(username, password)
+
+	subject, ok, err := a.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		return subject, nil
+	}
+
+	// The first caller's context is not used directly: canceling it would fail every caller waiting for the result
+	ch := a.group.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), a.loadTimeout)
+		defer cancel()
+
+		generation := a.currentGeneration()
+
+		subject, err := a.authenticator.AuthenticatePassword(ctx, username, password)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := cacheEntry{
+			username:  username,
+			subject:   subject,
+			expiresAt: a.clock.Now().Add(a.ttl),
+		}
+
+		if a.subjectRepository != nil {
+			current, err := a.subjectRepository.GetSubjectByID(ctx, subject.ID())
+			if err != nil {
+				// The verification succeeded, but the entry could never be revalidated
+				return subject, nil
+			}
+
+			entry.fingerprint = subjectFingerprint(current)
+		}
+
+		a.set(key, entry, generation)
+
+		return subject, nil
+	})
+
+	select {
+	case result := <-ch:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+
+		return result.Val.(auth.Subject), nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (a *CachingAuthenticator) get(ctx context.Context, key string) (auth.Subject, bool, error) {
+	a.mu.Lock()
+	entry, ok := a.entries[key]
+	a.mu.Unlock()
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	if !a.clock.Now().Before(entry.expiresAt) {
+		a.delete(key)
+
+		return nil, false, nil
+	}
+
+	if a.subjectRepository == nil {
+		return entry.subject, true, nil
+	}
+
+	current, err := a.subjectRepository.GetSubjectByID(ctx, entry.subject.ID())
+	if errors.Is(err, auth.ErrAuthenticationFailed) {
+		a.delete(key)
+
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if subjectFingerprint(current) != entry.fingerprint {
+		a.delete(key)
+
+		return nil, false, nil
+	}
+
+	return entry.subject, true, nil
+}
+
+func (a *CachingAuthenticator) currentGeneration() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.generation
+}
+
+// set stores an entry unless the cache got invalidated since generation.
+func (a *CachingAuthenticator) set(key string, entry cacheEntry, generation uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.generation != generation {
+		return
+	}
+
+	if len(a.entries) >= a.maxEntries {
+		a.evict()
+	}
+
+	a.entries[key] = entry
+}
+
+// evict makes room for a new entry: it drops expired entries or an arbitrary one if none expired.
+func (a *CachingAuthenticator) evict() {
+	now := a.clock.Now()
+
+	for key, entry := range a.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(a.entries, key)
+		}
+	}
+
+	for key := range a.entries {
+		if len(a.entries) < a.maxEntries {
+			break
+		}
+
+		delete(a.entries, key)
+	}
+}
+
+func (a *CachingAuthenticator) delete(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.entries, key)
+}
+
+// Invalidate drops every cached verification of a user.
+// Verifications in progress are not cached (regardless of the user).
+func (a *CachingAuthenticator) Invalidate(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.generation++
+
+	for key, entry := range a.entries {
+		if entry.username == username {
+			delete(a.entries, key)
+		}
+	}
+}
+
+// InvalidateAll drops every cached verification.
+func (a *CachingAuthenticator) InvalidateAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.generation++
+
+	clear(a.entries)
+}
+
+// GetSubjectByID implements [SubjectRepository] (if the underlying authenticator implements it).
+func (a *CachingAuthenticator) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	if a.subjectRepository == nil {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	return a.subjectRepository.GetSubjectByID(ctx, id)
+}
@@ -0,0 +1,259 @@
+package authn
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+type countingAuthenticator struct {
+	auth.PasswordAuthenticator
+
+	calls atomic.Int64
+	wait  chan struct{}
+}
+
+func (a *countingAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	a.calls.Add(1)
+
+	if a.wait != nil {
+		<-a.wait
+	}
+
+	return a.PasswordAuthenticator.AuthenticatePassword(ctx, username, password)
+}
+
+// pointerSubjectRepository returns subjects as pointers, while the authenticator returns them as values.
+type pointerSubjectRepository struct {
+	*countingAuthenticator
+
+	users UserAuthenticator
+}
+
+func (r pointerSubjectRepository) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	subject, err := r.users.GetSubjectByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user := subject.(User)
+
+	return &user, nil
+}
+
+func TestCachingAuthenticator(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := User{
+		Enabled:      true,
+		Username:     "user",
+		PasswordHash: string(passwordHash),
+	}
+
+	newAuthenticator := func(inner auth.PasswordAuthenticator) (*CachingAuthenticator, *countingAuthenticator, *clockwork.FakeClock) {
+		counter := &countingAuthenticator{PasswordAuthenticator: inner}
+		clock := clockwork.NewFakeClock()
+
+		return NewCachingAuthenticator(counter, CacheConfig{TTL: time.Minute, Clock: clock}), counter, clock
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		authenticator, counter, clock := newAuthenticator(NewUserAuthenticator([]User{user}))
+
+		for i := 0; i < 3; i++ {
+			subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+			require.NoError(t, err)
+
+			assert.Equal(t, user.ID(), subject.ID())
+		}
+
+		assert.Equal(t, int64(1), counter.calls.Load())
+
+		clock.Advance(time.Minute)
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(2), counter.calls.Load())
+	})
+
+	t.Run("FailuresAreNotCached", func(t *testing.T) {
+		authenticator, counter, _ := newAuthenticator(NewUserAuthenticator([]User{user}))
+
+		for i := 0; i < 2; i++ {
+			_, err := authenticator.AuthenticatePassword(context.Background(), "user", "otherPassword")
+			require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		}
+
+		assert.Equal(t, int64(2), counter.calls.Load())
+	})
+
+	t.Run("DifferentPassword", func(t *testing.T) {
+		authenticator, _, _ := newAuthenticator(NewUserAuthenticator([]User{user}))
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "otherPassword")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		authenticator, counter, _ := newAuthenticator(NewUserAuthenticator([]User{user}))
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		authenticator.Invalidate("user")
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		authenticator.InvalidateAll()
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(3), counter.calls.Load())
+	})
+
+	t.Run("Revalidate", func(t *testing.T) {
+		htpasswd := User{Enabled: true, Username: "user", PasswordHash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="}
+
+		htpasswdAuthenticator := &HtpasswdAuthenticator{}
+		htpasswdAuthenticator.entries.Store(&map[string]User{"user": htpasswd})
+
+		authenticator := NewCachingAuthenticator(htpasswdAuthenticator, CacheConfig{})
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		// Password changed
+		htpasswd.PasswordHash = "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ="
+		htpasswdAuthenticator.entries.Store(&map[string]User{"user": htpasswd})
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "secret")
+		require.NoError(t, err)
+
+		// User removed
+		htpasswdAuthenticator.entries.Store(&map[string]User{})
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "secret")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("RevalidateDifferentType", func(t *testing.T) {
+		users := NewUserAuthenticator([]User{user})
+		counter := &countingAuthenticator{PasswordAuthenticator: users}
+
+		authenticator := NewCachingAuthenticator(pointerSubjectRepository{counter, users}, CacheConfig{})
+
+		for i := 0; i < 3; i++ {
+			_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, int64(1), counter.calls.Load())
+	})
+
+	t.Run("InvalidateInFlight", func(t *testing.T) {
+		authenticator, counter, _ := newAuthenticator(NewUserAuthenticator([]User{user}))
+		counter.wait = make(chan struct{})
+
+		result := make(chan error, 1)
+
+		go func() {
+			_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+			result <- err
+		}()
+
+		// Wait for the first verification to start
+		require.Eventually(t, func() bool { return counter.calls.Load() > 0 }, time.Second, time.Millisecond)
+
+		authenticator.Invalidate("user")
+		close(counter.wait)
+
+		require.NoError(t, <-result)
+
+		// The verification started before the invalidation is not cached
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(2), counter.calls.Load())
+	})
+
+	t.Run("Coalesce", func(t *testing.T) {
+		authenticator, counter, _ := newAuthenticator(NewUserAuthenticator([]User{user}))
+		counter.wait = make(chan struct{})
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+				assert.NoError(t, err)
+			}()
+		}
+
+		// Wait for the first verification to start
+		require.Eventually(t, func() bool { return counter.calls.Load() > 0 }, time.Second, time.Millisecond)
+
+		time.Sleep(10 * time.Millisecond)
+		close(counter.wait)
+
+		wg.Wait()
+
+		assert.Equal(t, int64(1), counter.calls.Load())
+	})
+
+	t.Run("CanceledCaller", func(t *testing.T) {
+		authenticator, counter, _ := newAuthenticator(NewUserAuthenticator([]User{user}))
+		counter.wait = make(chan struct{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error, 1)
+
+		go func() {
+			_, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+			first <- err
+		}()
+
+		// Wait for the first verification to start
+		require.Eventually(t, func() bool { return counter.calls.Load() > 0 }, time.Second, time.Millisecond)
+
+		second := make(chan error, 1)
+
+		go func() {
+			_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+			second <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+
+		assert.ErrorIs(t, <-first, context.Canceled)
+
+		close(counter.wait)
+
+		// The shared verification is not affected by the first caller going away
+		assert.NoError(t, <-second)
+		assert.Equal(t, int64(1), counter.calls.Load())
+	})
+}
@@ -0,0 +1,175 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// ChainProvider is a named identity provider in a [ChainAuthenticator].
+type ChainProvider struct {
+	// Name identifies the provider. It is used to namespace subject IDs (eg. "ldap:john").
+	// It MUST be unique within a chain and MUST NOT contain a colon.
+	// "client" is reserved: subject IDs of clients use the same namespace (see [ClientSubjectIDPrefix]).
+	Name string
+
+	Authenticator auth.PasswordAuthenticator
+
+	// SubjectRepository is used to look up subjects of this provider (eg. during refresh token authentication).
+	// If nil, Authenticator is used (if it implements [SubjectRepository]).
+	SubjectRepository SubjectRepository
+}
+
+// ChainAuthenticator tries a list of providers in order and returns the first successfully authenticated subject.
+//
+// A provider returning [auth.ErrAuthenticationFailed] makes the chain fall through to the next provider.
+// Any other error (eg. connection problems) is returned immediately.
+//
+// Subject IDs are namespaced by the name of the provider that authenticated the subject,
+// so that identical IDs from different providers do not collide (see [auth.SubjectID]).
+// ChainAuthenticator also implements [SubjectRepository]: it routes lookups to the right provider based on the namespace.
+type ChainAuthenticator struct {
+	providers []ChainProvider
+}
+
+// NewChainAuthenticator returns a new [ChainAuthenticator].
+//
+// It returns an error if a provider name is empty, contains a colon, is reserved or is used more than once.
+func NewChainAuthenticator(providers ...ChainProvider) (ChainAuthenticator, error) {
+	providers = slices.Clone(providers)
+	names := make(map[string]bool, len(providers))
+
+	for i, provider := range providers {
+		if provider.Name == "" || strings.Contains(provider.Name, ":") {
+			return ChainAuthenticator{}, fmt.Errorf("invalid provider name %q", provider.Name)
+		}
+
+		if provider.Name+":" == ClientSubjectIDPrefix {
+			return ChainAuthenticator{}, fmt.Errorf("provider name %q is reserved for clients", provider.Name)
+		}
+
+		if names[provider.Name] {
+			return ChainAuthenticator{}, fmt.Errorf("duplicate provider name %q", provider.Name)
+		}
+
+		names[provider.Name] = true
+
+		if provider.SubjectRepository == nil {
+			if subjectRepository, ok := provider.Authenticator.(SubjectRepository); ok {
+				providers[i].SubjectRepository = subjectRepository
+			}
+		}
+	}
+
+	return ChainAuthenticator{
+		providers: providers,
+	}, nil
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+func (a ChainAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	for _, provider := range a.providers {
+		subject, err := provider.Authenticator.AuthenticatePassword(ctx, username, password)
+		if errors.Is(err, auth.ErrAuthenticationFailed) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", provider.Name, err)
+		}
+
+		return namespaceSubject(provider.Name, subject), nil
+	}
+
+	return nil, auth.ErrAuthenticationFailed
+}
+
+// GetSubjectByID implements [SubjectRepository].
+func (a ChainAuthenticator) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	name, providerID, ok := strings.Cut(id.String(), ":")
+	if !ok {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	for _, provider := range a.providers {
+		if provider.Name != name {
+			continue
+		}
+
+		if provider.SubjectRepository == nil {
+			return nil, auth.ErrAuthenticationFailed
+		}
+
+		subject, err := provider.SubjectRepository.GetSubjectByID(ctx, auth.SubjectIDFromString(providerID))
+		if err != nil {
+			return nil, err
+		}
+
+		return namespaceSubject(provider.Name, subject), nil
+	}
+
+	return nil, auth.ErrAuthenticationFailed
+}
+
+// namespaceSubject prefixes the ID of a subject with the name of a provider.
+//
+// Optional behavior defined by the auth package is preserved:
+// anonymous subjects are returned as is, bounds of an [auth.BoundedSubject], the actor of an [auth.DelegatedSubject]
+// and whether the subject is an [auth.TransientSubject] are kept.
+// Any other optional interface of the original subject is hidden by the wrapper: use Unwrap to access the original subject.
+func namespaceSubject(namespace string, subject auth.Subject) auth.Subject {
+	if auth.IsAnonymous(subject) {
+		return subject
+	}
+
+	if subject, ok := subject.(auth.DelegatedSubject); ok {
+		subject.Subject = namespaceSubject(namespace, subject.Subject)
+
+		return subject
+	}
+
+	s := namespacedSubject{
+		Subject: subject,
+		id:      auth.SubjectIDFromString(namespace + ":" + subject.ID().String()),
+	}
+
+	if subject, ok := subject.(auth.BoundedSubject); ok {
+		return namespacedBoundedSubject{
+			namespacedSubject: s,
+			bounds:            subject,
+		}
+	}
+
+	return s
+}
+
+type namespacedSubject struct {
+	auth.Subject
+
+	id auth.SubjectID
+}
+
+func (s namespacedSubject) ID() auth.SubjectID {
+	return s.id
+}
+
+// Unwrap returns the original subject.
+func (s namespacedSubject) Unwrap() auth.Subject {
+	return s.Subject
+}
+
+func (s namespacedSubject) Transient() bool {
+	return auth.IsTransient(s.Subject)
+}
+
+type namespacedBoundedSubject struct {
+	namespacedSubject
+
+	bounds auth.BoundedSubject
+}
+
+func (s namespacedBoundedSubject) ScopeBounds() []auth.Scope {
+	return s.bounds.ScopeBounds()
+}
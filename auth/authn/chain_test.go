@@ -0,0 +1,197 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+type passwordAuthenticatorStub struct {
+	subject auth.Subject
+	err     error
+
+	calls int
+}
+
+func (a *passwordAuthenticatorStub) AuthenticatePassword(_ context.Context, _ string, _ string) (auth.Subject, error) {
+	a.calls++
+
+	return a.subject, a.err
+}
+
+func TestChainAuthenticator(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := User{
+		Enabled:      true,
+		Username:     "user",
+		PasswordHash: string(passwordHash),
+	}
+
+	local := NewUserAuthenticator([]User{user})
+
+	t.Run("OK", func(t *testing.T) {
+		fallback := &passwordAuthenticatorStub{err: auth.ErrAuthenticationFailed}
+		authenticator, err := NewChainAuthenticator(
+			ChainProvider{Name: "other", Authenticator: fallback},
+			ChainProvider{Name: "local", Authenticator: local},
+		)
+		require.NoError(t, err)
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectIDFromString("local:user"), subject.ID())
+		assert.Equal(t, 1, fallback.calls)
+
+		subject, err = authenticator.GetSubjectByID(context.Background(), subject.ID())
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectIDFromString("local:user"), subject.ID())
+	})
+
+	t.Run("StopsOnFirstSuccess", func(t *testing.T) {
+		next := &passwordAuthenticatorStub{err: errors.New("should not be called")}
+		authenticator, err := NewChainAuthenticator(
+			ChainProvider{Name: "local", Authenticator: local},
+			ChainProvider{Name: "next", Authenticator: next},
+		)
+		require.NoError(t, err)
+
+		_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, 0, next.calls)
+	})
+
+	t.Run("PreservesBounds", func(t *testing.T) {
+		bounded := &passwordAuthenticatorStub{subject: boundedSubjectStub{user}}
+		authenticator, err := NewChainAuthenticator(ChainProvider{Name: "pat", Authenticator: bounded})
+		require.NoError(t, err)
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		_, ok := subject.(auth.BoundedSubject)
+		assert.True(t, ok)
+	})
+
+	t.Run("PreservesTransient", func(t *testing.T) {
+		transient := &passwordAuthenticatorStub{subject: transientSubjectStub{user}}
+		authenticator, err := NewChainAuthenticator(ChainProvider{Name: "oidc", Authenticator: transient})
+		require.NoError(t, err)
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.True(t, auth.IsTransient(subject))
+
+		local, err := NewChainAuthenticator(ChainProvider{Name: "local", Authenticator: local})
+		require.NoError(t, err)
+
+		subject, err = local.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.False(t, auth.IsTransient(subject))
+	})
+
+	t.Run("PreservesActor", func(t *testing.T) {
+		delegated := &passwordAuthenticatorStub{subject: auth.DelegatedSubject{Subject: user, Actor: auth.Actor{Subject: "ci"}}}
+		authenticator, err := NewChainAuthenticator(ChainProvider{Name: "local", Authenticator: delegated})
+		require.NoError(t, err)
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		delegatedSubject, ok := subject.(auth.DelegatedSubject)
+		require.True(t, ok)
+
+		assert.Equal(t, auth.SubjectIDFromString("local:user"), delegatedSubject.ID())
+		assert.Equal(t, "ci", delegatedSubject.Actor.Subject)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("InvalidProviderName", func(t *testing.T) {
+			_, err := NewChainAuthenticator(ChainProvider{Name: "local:users", Authenticator: local})
+			require.Error(t, err)
+
+			_, err = NewChainAuthenticator(
+				ChainProvider{Name: "local", Authenticator: local},
+				ChainProvider{Name: "local", Authenticator: local},
+			)
+			require.Error(t, err)
+
+			// Reserved for clients
+			_, err = NewChainAuthenticator(ChainProvider{Name: "client", Authenticator: local})
+			require.Error(t, err)
+		})
+
+		t.Run("AuthenticationFailed", func(t *testing.T) {
+			authenticator, err := NewChainAuthenticator(
+				ChainProvider{Name: "local", Authenticator: local},
+				ChainProvider{Name: "other", Authenticator: &passwordAuthenticatorStub{err: auth.ErrAuthenticationFailed}},
+			)
+			require.NoError(t, err)
+
+			_, err = authenticator.AuthenticatePassword(context.Background(), "user", "otherPassword")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("Infrastructure", func(t *testing.T) {
+			infraErr := errors.New("connection refused")
+			next := &passwordAuthenticatorStub{}
+
+			authenticator, err := NewChainAuthenticator(
+				ChainProvider{Name: "ldap", Authenticator: &passwordAuthenticatorStub{err: infraErr}},
+				ChainProvider{Name: "next", Authenticator: next},
+			)
+			require.NoError(t, err)
+
+			_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, infraErr)
+			assert.Equal(t, 0, next.calls)
+		})
+
+		t.Run("UnknownProvider", func(t *testing.T) {
+			authenticator, err := NewChainAuthenticator(ChainProvider{Name: "local", Authenticator: local})
+			require.NoError(t, err)
+
+			_, err = authenticator.GetSubjectByID(context.Background(), auth.SubjectIDFromString("other:user"))
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+			_, err = authenticator.GetSubjectByID(context.Background(), auth.SubjectIDFromString("user"))
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+	})
+}
+
+type boundedSubjectStub struct {
+	auth.Subject
+}
+
+func (s boundedSubjectStub) ScopeBounds() []auth.Scope {
+	return nil
+}
+
+type transientSubjectStub struct {
+	auth.Subject
+}
+
+func (s transientSubjectStub) Transient() bool {
+	return true
+}
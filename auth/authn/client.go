@@ -0,0 +1,235 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// ClientRegistry is an [auth.ClientRegistry] declaring clients in a static list (eg. docker, podman, CI, UI).
+//
+// It also authenticates machine clients (eg. deployment bots) using the "client_credentials" grant (see [auth.ClientAuthenticator]).
+//
+// Client secret hashes are verified by the [DefaultPasswordHasher] (which supports every hash format).
+// Secrets are verified once per request: [ClientRegistry.AuthenticateClient] trusts the policy returned by
+// [ClientRegistry.ClientPolicy] (carried by the context) if the secret was already verified.
+type ClientRegistry struct {
+	entries map[string]Client
+
+	hasher  PasswordHasher
+	lockout *lockout
+}
+
+// ClientRegistryOption configures a [ClientRegistry].
+type ClientRegistryOption interface {
+	applyClientRegistry(*ClientRegistry)
+}
+
+// WithClientLockout protects client secrets from brute-force attacks (see [LockoutAuthenticator]).
+//
+// Failures are tracked per client ID (see [LockoutConfig.ClientID]) and per client IP (see [LockoutConfig.ClientIP]).
+// The store may be shared with a [LockoutAuthenticator]: failures of clients and users count towards the same client IP.
+func WithClientLockout(store FailureStore, config LockoutConfig) ClientRegistryOption {
+	return withClientLockout{newLockout(store, config)}
+}
+
+type withClientLockout struct {
+	lockout lockout
+}
+
+func (w withClientLockout) applyClientRegistry(r *ClientRegistry) {
+	r.lockout = &w.lockout
+}
+
+// NewClientRegistry returns a new [ClientRegistry].
+func NewClientRegistry(clients []Client, opts ...ClientRegistryOption) ClientRegistry {
+	entries := make(map[string]Client, len(clients))
+
+	for _, client := range clients {
+		entries[client.ClientID] = client
+	}
+
+	r := ClientRegistry{
+		entries: entries,
+		hasher:  DefaultPasswordHasher,
+	}
+
+	for _, opt := range opts {
+		opt.applyClientRegistry(&r)
+	}
+
+	return r
+}
+
+// ClientSubjectIDPrefix is prepended to the subject ID of clients (see [Client.ID]),
+// so that client IDs never collide with usernames (eg. in authorization policies).
+// A [ChainAuthenticator] cannot have a provider with the same name (see [NewChainAuthenticator]).
+const ClientSubjectIDPrefix = "client:"
+
+// Client is a registered client.
+//
+// It is also the [auth.Subject] of the "client_credentials" grant:
+// tokens issued to a client never exceed the scopes of its registration (if any).
+type Client struct {
+	Enabled  bool
+	ClientID string
+
+	// SecretHash is optional: clients without a secret (eg. docker) are public clients.
+	// Public clients cannot use the "client_credentials" grant.
+	SecretHash string
+
+	// GrantTypes lists the grant types the client may use (nil means any).
+	GrantTypes []string
+
+	// AccessTypes lists the access types the client may request (nil means any).
+	AccessTypes []string
+
+	// Scopes is the upper bound of scopes the client may be granted (nil means no limit).
+	// Resource names may contain wildcards (see [auth.IntersectScopes]).
+	Scopes []auth.Scope
+
+	// AccessTokenExpiration overrides the expiration of access tokens issued to the client (if positive).
+	AccessTokenExpiration time.Duration
+
+	// RefreshTokenLifetime limits the lifetime of refresh tokens issued to the client (if positive).
+	RefreshTokenLifetime time.Duration
+
+	Attrs map[string]any
+}
+
+// ID implements [auth.Subject].
+//
+// It is the client ID prefixed with [ClientSubjectIDPrefix] (eg. "client:deploy-bot"):
+// authorization policies refer to clients using this ID.
+func (c Client) ID() auth.SubjectID {
+	return auth.SubjectIDFromString(ClientSubjectIDPrefix + c.ClientID)
+}
+
+// Attribute implements [auth.Subject].
+func (c Client) Attribute(key string) (any, bool) {
+	if c.Attrs == nil {
+		return "", false
+	}
+
+	v, ok := c.Attrs[key]
+
+	return v, ok
+}
+
+// Attributes implements [auth.Subject].
+func (c Client) Attributes() map[string]any {
+	return maps.Clone(c.Attrs)
+}
+
+// subject returns the [auth.Subject] of the "client_credentials" grant.
+func (c Client) subject() auth.Subject {
+	if c.Scopes != nil {
+		return boundedClient{c}
+	}
+
+	return c
+}
+
+// boundedClient is a [Client] with scopes: nil scopes mean no limit, so only these clients are [auth.BoundedSubject]s.
+type boundedClient struct {
+	Client
+}
+
+// ScopeBounds implements [auth.BoundedSubject].
+func (c boundedClient) ScopeBounds() []auth.Scope {
+	return slices.Clone(c.Scopes)
+}
+
+// AuthenticateClient implements [auth.ClientAuthenticator].
+//
+// The secret is not verified again if the policy carried by ctx says the client already authenticated (see [auth.ClientPolicy]).
+func (r ClientRegistry) AuthenticateClient(ctx context.Context, clientID string, clientSecret string) (auth.Subject, error) {
+	client, ok := r.entries[clientID]
+	confidential := ok && client.Enabled && client.SecretHash != ""
+
+	if confidential && authenticated(ctx, clientID) {
+		return client.subject(), nil
+	}
+
+	err := r.withLockout(ctx, clientID, func() error {
+		if !confidential {
+			// timing attack paranoia
+			r.hasher.VerifyDummy(clientSecret)
+
+			return auth.ErrAuthenticationFailed
+		}
+
+		return r.verifySecret(client, clientSecret)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return client.subject(), nil
+}
+
+// authenticated checks whether the policy carried by ctx belongs to an authenticated client.
+func authenticated(ctx context.Context, clientID string) bool {
+	info, ok := auth.ClientInfoFromContext(ctx)
+	if !ok || info.ClientID != clientID {
+		return false
+	}
+
+	policy, ok := auth.ClientPolicyFromContext(ctx)
+
+	return ok && policy.Authenticated
+}
+
+// ClientPolicy implements [auth.ClientRegistry].
+//
+// Secrets of public clients are ignored.
+func (r ClientRegistry) ClientPolicy(ctx context.Context, clientID string, clientSecret string) (auth.ClientPolicy, error) {
+	client, ok := r.entries[clientID]
+	if !ok || !client.Enabled {
+		return auth.ClientPolicy{}, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidClient, Description: "unknown client"}
+	}
+
+	if client.SecretHash != "" {
+		err := r.withLockout(ctx, clientID, func() error {
+			return r.verifySecret(client, clientSecret)
+		})
+		if errors.Is(err, auth.ErrAuthenticationFailed) {
+			return auth.ClientPolicy{}, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidClient, Description: "invalid client credentials"}
+		} else if err != nil {
+			return auth.ClientPolicy{}, err
+		}
+	}
+
+	return auth.ClientPolicy{
+		GrantTypes:            client.GrantTypes,
+		AccessTypes:           client.AccessTypes,
+		Scopes:                client.Scopes,
+		AccessTokenExpiration: client.AccessTokenExpiration,
+		RefreshTokenLifetime:  client.RefreshTokenLifetime,
+		Authenticated:         client.SecretHash != "",
+	}, nil
+}
+
+func (r ClientRegistry) verifySecret(client Client, clientSecret string) error {
+	if ok, _ := r.hasher.Verify(client.SecretHash, clientSecret); !ok {
+		return auth.ErrAuthenticationFailed
+	}
+
+	return nil
+}
+
+// withLockout runs verify under the lockout (if configured).
+func (r ClientRegistry) withLockout(ctx context.Context, clientID string, verify func() error) error {
+	if r.lockout == nil {
+		return verify()
+	}
+
+	// Like usernames, client IDs are reset on success, client IPs are not
+	keys := r.lockout.keys(ctx, lockoutKey{"client:" + clientID, r.lockout.config.ClientID, true})
+
+	return r.lockout.attempt(ctx, keys, verify)
+}
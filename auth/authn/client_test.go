@@ -0,0 +1,248 @@
+package authn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+func TestClientRegistry_AuthenticateClient(t *testing.T) {
+	secretHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	client := Client{
+		Enabled:    true,
+		ClientID:   "deploy-bot",
+		SecretHash: string(secretHash),
+		Scopes: []auth.Scope{
+			{
+				Resource: auth.Resource{
+					Type: "repository",
+					Name: "apps/*",
+				},
+				Actions: []string{"pull"},
+			},
+		},
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		authenticator := NewClientRegistry([]Client{client})
+
+		subject, err := authenticator.AuthenticateClient(context.Background(), "deploy-bot", "secret")
+		require.NoError(t, err)
+
+		assert.Equal(t, boundedClient{client}, subject)
+
+		// Clients do not share a namespace with users
+		assert.Equal(t, auth.SubjectIDFromString("client:deploy-bot"), subject.ID())
+
+		boundedSubject, ok := subject.(auth.BoundedSubject)
+		require.True(t, ok)
+
+		assert.Equal(t, client.Scopes, boundedSubject.ScopeBounds())
+	})
+
+	t.Run("Unbounded", func(t *testing.T) {
+		unboundedClient := client
+		unboundedClient.Scopes = nil
+
+		authenticator := NewClientRegistry([]Client{unboundedClient})
+
+		subject, err := authenticator.AuthenticateClient(context.Background(), "deploy-bot", "secret")
+		require.NoError(t, err)
+
+		assert.Equal(t, unboundedClient, subject)
+
+		// Nil scopes mean no limit
+		_, ok := subject.(auth.BoundedSubject)
+		assert.False(t, ok)
+	})
+
+	t.Run("AlreadyAuthenticated", func(t *testing.T) {
+		registry := NewClientRegistry([]Client{client})
+
+		ctx := auth.ContextWithClientInfo(context.Background(), auth.ClientInfo{ClientID: "deploy-bot"})
+
+		policy, err := registry.ClientPolicy(ctx, "deploy-bot", "secret")
+		require.NoError(t, err)
+
+		assert.True(t, policy.Authenticated)
+
+		ctx = auth.ContextWithClientPolicy(ctx, policy)
+
+		// The secret is not verified again
+		_, err = registry.AuthenticateClient(ctx, "deploy-bot", "")
+		require.NoError(t, err)
+
+		// The policy of another client does not count
+		_, err = registry.AuthenticateClient(ctx, "other", "secret")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("Lockout", func(t *testing.T) {
+		config := LockoutConfig{
+			ClientID: LockoutPolicy{
+				FreeAttempts: 1,
+				BaseDelay:    time.Minute,
+			},
+			Clock: clockwork.NewFakeClock(),
+		}
+
+		registry := NewClientRegistry([]Client{client}, WithClientLockout(NewInMemoryFailureStore(), config))
+
+		_, err := registry.AuthenticateClient(context.Background(), "deploy-bot", "other")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+		_, err = registry.ClientPolicy(context.Background(), "deploy-bot", "other")
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidClient})
+
+		// Even the right secret is rejected while the client is locked
+		_, err = registry.AuthenticateClient(context.Background(), "deploy-bot", "secret")
+		require.ErrorIs(t, err, auth.ErrTooManyAttempts)
+
+		_, err = registry.ClientPolicy(context.Background(), "deploy-bot", "secret")
+		require.ErrorIs(t, err, auth.ErrTooManyAttempts)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		disabledClient := client
+		disabledClient.ClientID = "disabled"
+		disabledClient.Enabled = false
+
+		authenticator := NewClientRegistry([]Client{client, disabledClient})
+
+		testCases := []struct {
+			name         string
+			clientID     string
+			clientSecret string
+		}{
+			{
+				name:         "UnknownClient",
+				clientID:     "unknown",
+				clientSecret: "secret",
+			},
+			{
+				name:         "DisabledClient",
+				clientID:     "disabled",
+				clientSecret: "secret",
+			},
+			{
+				name:         "SecretMismatch",
+				clientID:     "deploy-bot",
+				clientSecret: "other",
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.name, func(t *testing.T) {
+				_, err := authenticator.AuthenticateClient(context.Background(), testCase.clientID, testCase.clientSecret)
+				require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+			})
+		}
+	})
+}
+
+func TestClientRegistry_ClientPolicy(t *testing.T) {
+	secretHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "*",
+			},
+			Actions: []string{"pull"},
+		},
+	}
+
+	registry := NewClientRegistry([]Client{
+		{
+			Enabled:               true,
+			ClientID:              "docker",
+			GrantTypes:            []string{auth.GrantTypePassword, auth.GrantTypeRefreshToken},
+			AccessTypes:           []string{auth.AccessTypeOffline},
+			Scopes:                scopes,
+			AccessTokenExpiration: 5 * time.Minute,
+			RefreshTokenLifetime:  24 * time.Hour,
+		},
+		{
+			Enabled:    true,
+			ClientID:   "ci",
+			SecretHash: string(secretHash),
+		},
+		{
+			Enabled:  false,
+			ClientID: "disabled",
+		},
+	})
+
+	t.Run("OK", func(t *testing.T) {
+		policy, err := registry.ClientPolicy(context.Background(), "docker", "")
+		require.NoError(t, err)
+
+		expected := auth.ClientPolicy{
+			GrantTypes:            []string{auth.GrantTypePassword, auth.GrantTypeRefreshToken},
+			AccessTypes:           []string{auth.AccessTypeOffline},
+			Scopes:                scopes,
+			AccessTokenExpiration: 5 * time.Minute,
+			RefreshTokenLifetime:  24 * time.Hour,
+		}
+
+		assert.Equal(t, expected, policy)
+	})
+
+	t.Run("ConfidentialClient", func(t *testing.T) {
+		_, err := registry.ClientPolicy(context.Background(), "ci", "secret")
+		require.NoError(t, err)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		testCases := []struct {
+			name         string
+			clientID     string
+			clientSecret string
+		}{
+			{
+				name:     "UnknownClient",
+				clientID: "unknown",
+			},
+			{
+				name:     "DisabledClient",
+				clientID: "disabled",
+			},
+			{
+				name:     "MissingSecret",
+				clientID: "ci",
+			},
+			{
+				name:         "SecretMismatch",
+				clientID:     "ci",
+				clientSecret: "other",
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.name, func(t *testing.T) {
+				_, err := registry.ClientPolicy(context.Background(), testCase.clientID, testCase.clientSecret)
+				require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidClient})
+			})
+		}
+	})
+
+	t.Run("PublicClientCredentials", func(t *testing.T) {
+		_, err := registry.AuthenticateClient(context.Background(), "docker", "")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+}
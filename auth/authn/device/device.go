@@ -0,0 +1,419 @@
+// Package device implements the [OAuth 2.0 Device Authorization Grant].
+//
+// It lets users without a password (eg. authenticating with SSO) log in from a device without a browser (eg. docker login):
+// the device displays a short user code, the user approves it on a verification page (authenticated by any means),
+// and the device receives a refresh token it can use as an identity token.
+//
+// The verification page is not part of this package: it has to look up the authorization using [Service.GetAuthorization]
+// and call [Service.Approve] or [Service.Deny] once the user decided.
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628
+package device
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authn"
+	"github.com/portward/registry-auth/internal/secret"
+)
+
+// ErrAuthorizationNotFound is returned when an authorization cannot be found (or is no longer pending).
+var ErrAuthorizationNotFound = errors.New("device authorization not found")
+
+// ErrUserCodeExists is returned by a [Store] when the user code of a new authorization is already taken.
+var ErrUserCodeExists = errors.New("user code already exists")
+
+// Default values of a [Service].
+const (
+	DefaultExpiration = 10 * time.Minute
+	DefaultInterval   = 5 * time.Second
+)
+
+// slowDownIncrement is added to the polling interval every time a device polls too often (as required by RFC 8628).
+const slowDownIncrement = 5 * time.Second
+
+// Status is the state of an authorization.
+type Status string
+
+// Authorization statuses.
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusDenied   Status = "denied"
+)
+
+// Authorization is a device authorization.
+type Authorization struct {
+	ID string
+
+	// DeviceCodeHash is the hex encoded SHA-256 hash of the device code.
+	DeviceCodeHash string
+
+	// UserCode is the normalized user code (see [NormalizeUserCode]).
+	UserCode string
+
+	Service  string
+	ClientID string
+	Scopes   []auth.Scope
+
+	Status Status
+
+	// SubjectID is the ID of the subject that approved the authorization.
+	SubjectID string
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// Interval is the minimum amount of time the device has to wait between polling requests.
+	Interval time.Duration
+
+	// LastPolledAt is the time the device last polled the token endpoint (if ever).
+	LastPolledAt time.Time
+}
+
+// Expired checks if an authorization has expired.
+func (a Authorization) Expired(now time.Time) bool {
+	return !now.Before(a.ExpiresAt)
+}
+
+// Store persists device authorizations.
+type Store interface {
+	// CreateAuthorization stores a new authorization.
+	//
+	// It returns [ErrUserCodeExists] if another authorization has the same user code.
+	CreateAuthorization(ctx context.Context, authorization Authorization) error
+
+	// GetAuthorizationByDeviceCodeHash returns an authorization by the hash of its device code or [ErrAuthorizationNotFound].
+	GetAuthorizationByDeviceCodeHash(ctx context.Context, hash string) (Authorization, error)
+
+	// GetAuthorizationByUserCode returns an authorization by its (normalized) user code or [ErrAuthorizationNotFound].
+	GetAuthorizationByUserCode(ctx context.Context, userCode string) (Authorization, error)
+
+	// UpdatePolling records a polling request: only LastPolledAt and Interval are updated.
+	// It returns [ErrAuthorizationNotFound] if the authorization does not exist.
+	UpdatePolling(ctx context.Context, id string, lastPolledAt time.Time, interval time.Duration) error
+
+	// UpdateStatus records the decision of a subject about a pending authorization.
+	//
+	// It MUST be atomic: if the authorization does not exist or is no longer pending, it returns [ErrAuthorizationNotFound].
+	UpdateStatus(ctx context.Context, id string, status Status, subjectID string) error
+
+	// DeleteAuthorization deletes an authorization or returns [ErrAuthorizationNotFound].
+	//
+	// It MUST be atomic: the device code of an approved authorization can only be exchanged once.
+	DeleteAuthorization(ctx context.Context, id string) error
+}
+
+// Service implements [auth.DeviceAuthorizer].
+type Service struct {
+	store             Store
+	subjectRepository authn.SubjectRepository
+	verificationURI   string
+
+	expiration time.Duration
+	interval   time.Duration
+	clock      clockwork.Clock
+}
+
+// Option configures a [Service].
+type Option interface {
+	apply(s *Service)
+}
+
+// WithClock configures a [Service] to use a Clock.
+func WithClock(clock clockwork.Clock) Option {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock clockwork.Clock
+}
+
+func (w withClock) apply(s *Service) {
+	s.clock = w.clock
+}
+
+// WithExpiration configures how long device codes remain valid. Defaults to [DefaultExpiration].
+func WithExpiration(expiration time.Duration) Option {
+	return withExpiration{expiration}
+}
+
+type withExpiration struct {
+	expiration time.Duration
+}
+
+func (w withExpiration) apply(s *Service) {
+	s.expiration = w.expiration
+}
+
+// WithInterval configures the minimum amount of time devices have to wait between polling requests. Defaults to [DefaultInterval].
+func WithInterval(interval time.Duration) Option {
+	return withInterval{interval}
+}
+
+type withInterval struct {
+	interval time.Duration
+}
+
+func (w withInterval) apply(s *Service) {
+	s.interval = w.interval
+}
+
+// NewService returns a new [Service].
+//
+// verificationURI is the address of the page where users approve user codes.
+// subjectRepository is used to look up the subject that approved an authorization.
+func NewService(store Store, subjectRepository authn.SubjectRepository, verificationURI string, opts ...Option) Service {
+	s := Service{
+		store:             store,
+		subjectRepository: subjectRepository,
+		verificationURI:   verificationURI,
+	}
+
+	for _, opt := range opts {
+		opt.apply(&s)
+	}
+
+	if s.expiration <= 0 {
+		s.expiration = DefaultExpiration
+	}
+
+	if s.interval <= 0 {
+		s.interval = DefaultInterval
+	}
+
+	if s.clock == nil {
+		s.clock = clockwork.NewRealClock()
+	}
+
+	return s
+}
+
+// AuthorizeDevice implements [auth.DeviceAuthorizer].
+func (s Service) AuthorizeDevice(ctx context.Context, r auth.DeviceAuthorizationRequest) (auth.DeviceAuthorizationResponse, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return auth.DeviceAuthorizationResponse{}, err
+	}
+
+	deviceCode, err := secret.New("")
+	if err != nil {
+		return auth.DeviceAuthorizationResponse{}, err
+	}
+
+	now := s.clock.Now()
+
+	authorization := Authorization{
+		ID:             id.String(),
+		DeviceCodeHash: secret.Hash(deviceCode),
+		Service:        r.Service,
+		ClientID:       r.ClientID,
+		Scopes:         r.Scopes,
+		Status:         StatusPending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(s.expiration),
+		Interval:       s.interval,
+	}
+
+	// User codes are short: retry a few times in the unlikely case of a collision
+	for attempt := 1; ; attempt++ {
+		authorization.UserCode, err = generateUserCode()
+		if err != nil {
+			return auth.DeviceAuthorizationResponse{}, err
+		}
+
+		err = s.store.CreateAuthorization(ctx, authorization)
+		if err == nil {
+			break
+		} else if !errors.Is(err, ErrUserCodeExists) || attempt == maxUserCodeAttempts {
+			return auth.DeviceAuthorizationResponse{}, err
+		}
+	}
+
+	response := auth.DeviceAuthorizationResponse{
+		DeviceCode:      deviceCode,
+		UserCode:        FormatUserCode(authorization.UserCode),
+		VerificationURI: s.verificationURI,
+		ExpiresIn:       int(s.expiration.Seconds()),
+		Interval:        int(s.interval.Seconds()),
+	}
+
+	if u, err := url.Parse(s.verificationURI); err == nil {
+		query := u.Query()
+		query.Set("user_code", response.UserCode)
+		u.RawQuery = query.Encode()
+
+		response.VerificationURIComplete = u.String()
+	}
+
+	return response, nil
+}
+
+// AuthenticateDeviceCode implements [auth.DeviceAuthorizer].
+func (s Service) AuthenticateDeviceCode(ctx context.Context, service string, clientID string, deviceCode string) (auth.Subject, error) {
+	authorization, err := s.store.GetAuthorizationByDeviceCodeHash(ctx, secret.Hash(deviceCode))
+	if errors.Is(err, ErrAuthorizationNotFound) {
+		return nil, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidGrant}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if authorization.Service != service || authorization.ClientID != clientID {
+		return nil, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidGrant}
+	}
+
+	now := s.clock.Now()
+
+	if authorization.Expired(now) {
+		if err := s.delete(ctx, authorization.ID); err != nil {
+			return nil, err
+		}
+
+		return nil, auth.OAuth2Error{Code: auth.OAuth2ErrorExpiredToken}
+	}
+
+	switch authorization.Status {
+	case StatusApproved:
+		if err := s.delete(ctx, authorization.ID); err != nil {
+			return nil, err
+		}
+
+		return s.subjectRepository.GetSubjectByID(ctx, auth.SubjectIDFromString(authorization.SubjectID))
+
+	case StatusDenied:
+		if err := s.delete(ctx, authorization.ID); err != nil {
+			return nil, err
+		}
+
+		return nil, auth.OAuth2Error{Code: auth.OAuth2ErrorAccessDenied}
+	}
+
+	tooFast := !authorization.LastPolledAt.IsZero() && now.Sub(authorization.LastPolledAt) < authorization.Interval
+
+	interval := authorization.Interval
+	if tooFast {
+		interval += slowDownIncrement
+	}
+
+	// Only polling fields are written: the authorization may have been approved in the meantime
+	if err := s.store.UpdatePolling(ctx, authorization.ID, now, interval); errors.Is(err, ErrAuthorizationNotFound) {
+		return nil, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidGrant}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if tooFast {
+		return nil, auth.OAuth2Error{Code: auth.OAuth2ErrorSlowDown}
+	}
+
+	return nil, auth.OAuth2Error{Code: auth.OAuth2ErrorAuthorizationPending}
+}
+
+// delete deletes an authorization that reached a final state.
+// Losing a race against another polling request means the device code has already been used.
+func (s Service) delete(ctx context.Context, id string) error {
+	err := s.store.DeleteAuthorization(ctx, id)
+	if errors.Is(err, ErrAuthorizationNotFound) {
+		return auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidGrant}
+	}
+
+	return err
+}
+
+// GetAuthorization returns a pending authorization by its user code (eg. to display it on the verification page).
+//
+// User codes are normalized (see [NormalizeUserCode]).
+// It returns [ErrAuthorizationNotFound] if the authorization does not exist, expired or is no longer pending.
+func (s Service) GetAuthorization(ctx context.Context, userCode string) (Authorization, error) {
+	authorization, err := s.store.GetAuthorizationByUserCode(ctx, NormalizeUserCode(userCode))
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	if authorization.Status != StatusPending || authorization.Expired(s.clock.Now()) {
+		return Authorization{}, ErrAuthorizationNotFound
+	}
+
+	return authorization, nil
+}
+
+// Approve approves a pending authorization on behalf of a subject.
+//
+// The caller is responsible for authenticating the subject (and for asking for their consent).
+func (s Service) Approve(ctx context.Context, userCode string, subjectID auth.SubjectID) error {
+	if subjectID == nil || subjectID.String() == "" {
+		return errors.New("subject ID is required")
+	}
+
+	authorization, err := s.GetAuthorization(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	return s.store.UpdateStatus(ctx, authorization.ID, StatusApproved, subjectID.String())
+}
+
+// Deny denies a pending authorization.
+func (s Service) Deny(ctx context.Context, userCode string) error {
+	authorization, err := s.GetAuthorization(ctx, userCode)
+	if err != nil {
+		return err
+	}
+
+	return s.store.UpdateStatus(ctx, authorization.ID, StatusDenied, "")
+}
+
+// userCodeCharset contains consonants only to avoid forming words and ambiguous characters (as recommended by RFC 8628).
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+const userCodeLength = 8
+
+// maxUserCodeAttempts is the number of user codes generated before giving up on collisions.
+const maxUserCodeAttempts = 5
+
+func generateUserCode() (string, error) {
+	var b strings.Builder
+
+	charsetLength := big.NewInt(int64(len(userCodeCharset)))
+
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, charsetLength)
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteByte(userCodeCharset[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// FormatUserCode formats a normalized user code for display (eg. "WDJBMJHT" becomes "WDJB-MJHT").
+func FormatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// NormalizeUserCode normalizes a user code entered by a user: it is converted to upper case and dashes and spaces are removed.
+func NormalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToUpper(userCode))
+}
@@ -0,0 +1,307 @@
+package device
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authn"
+)
+
+func TestService(t *testing.T) {
+	user := authn.User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "user/repo",
+			},
+			Actions: []string{"pull"},
+		},
+	}
+
+	newService := func() (Service, *clockwork.FakeClock) {
+		clock := clockwork.NewFakeClockAt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		return NewService(NewInMemoryStore(), authn.NewUserAuthenticator([]authn.User{user}), "https://auth.example.com/device", WithClock(clock)), clock
+	}
+
+	authorize := func(t *testing.T, service Service) auth.DeviceAuthorizationResponse {
+		t.Helper()
+
+		response, err := service.AuthorizeDevice(context.Background(), auth.DeviceAuthorizationRequest{
+			Service:  "registry",
+			ClientID: "docker",
+			Scopes:   scopes,
+		})
+		require.NoError(t, err)
+
+		return response
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		service, clock := newService()
+
+		response := authorize(t, service)
+
+		assert.Regexp(t, "^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$", response.UserCode)
+		assert.Equal(t, "https://auth.example.com/device?user_code="+url.QueryEscape(response.UserCode), response.VerificationURIComplete)
+		assert.Equal(t, 600, response.ExpiresIn)
+		assert.Equal(t, 5, response.Interval)
+
+		_, err := service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorAuthorizationPending})
+
+		// User codes are case insensitive and the dash is optional
+		authorization, err := service.GetAuthorization(context.Background(), strings.ToLower(strings.ReplaceAll(response.UserCode, "-", "")))
+		require.NoError(t, err)
+
+		assert.Equal(t, "docker", authorization.ClientID)
+		assert.Equal(t, scopes, authorization.Scopes)
+		assert.NotContains(t, authorization.DeviceCodeHash, response.DeviceCode)
+
+		err = service.Approve(context.Background(), response.UserCode, user.ID())
+		require.NoError(t, err)
+
+		// Approved authorizations cannot be approved (or denied) again
+		err = service.Deny(context.Background(), response.UserCode)
+		require.ErrorIs(t, err, ErrAuthorizationNotFound)
+
+		clock.Advance(5 * time.Second)
+
+		subject, err := service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.NoError(t, err)
+
+		assert.Equal(t, user.ID(), subject.ID())
+
+		_, err = service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidGrant})
+	})
+
+	t.Run("SlowDown", func(t *testing.T) {
+		service, clock := newService()
+
+		response := authorize(t, service)
+
+		_, err := service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorAuthorizationPending})
+
+		clock.Advance(4 * time.Second)
+
+		_, err = service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorSlowDown})
+
+		// The interval got increased to 10 seconds
+		clock.Advance(5 * time.Second)
+
+		_, err = service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorSlowDown})
+
+		clock.Advance(15 * time.Second)
+
+		_, err = service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorAuthorizationPending})
+	})
+
+	// Polling must not overwrite a decision made while the authorization was being read
+	t.Run("ApprovedWhilePolling", func(t *testing.T) {
+		store := &interleavingStore{InMemoryStore: NewInMemoryStore()}
+		clock := clockwork.NewFakeClockAt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		service := NewService(store, authn.NewUserAuthenticator([]authn.User{user}), "https://auth.example.com/device", WithClock(clock))
+
+		response := authorize(t, service)
+
+		store.afterRead = func() {
+			err := service.Approve(context.Background(), response.UserCode, user.ID())
+			require.NoError(t, err)
+		}
+
+		_, err := service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorAuthorizationPending})
+
+		store.afterRead = nil
+
+		clock.Advance(5 * time.Second)
+
+		subject, err := service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.NoError(t, err)
+
+		assert.Equal(t, user.ID(), subject.ID())
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		service, clock := newService()
+
+		response := authorize(t, service)
+
+		var (
+			wg        sync.WaitGroup
+			approvals atomic.Int64
+		)
+
+		poll := func() {
+			subject, err := service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+			if err == nil && subject.ID().Equals(user.ID()) {
+				approvals.Add(1)
+			}
+		}
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 10; j++ {
+					poll()
+				}
+			}()
+		}
+
+		err := service.Approve(context.Background(), response.UserCode, user.ID())
+		require.NoError(t, err)
+
+		wg.Wait()
+
+		clock.Advance(time.Minute)
+		poll()
+
+		// The approval is never lost and the device code is only exchanged once
+		assert.Equal(t, int64(1), approvals.Load())
+	})
+
+	t.Run("UserCodeCollision", func(t *testing.T) {
+		store := &interleavingStore{InMemoryStore: NewInMemoryStore(), collisions: maxUserCodeAttempts - 1}
+		service := NewService(store, authn.NewUserAuthenticator([]authn.User{user}), "https://auth.example.com/device")
+
+		authorize(t, service)
+
+		store.collisions = maxUserCodeAttempts
+
+		_, err := service.AuthorizeDevice(context.Background(), auth.DeviceAuthorizationRequest{
+			Service:  "registry",
+			ClientID: "docker",
+		})
+		require.ErrorIs(t, err, ErrUserCodeExists)
+
+		// The in-memory store detects collisions as well
+		inMemoryStore := NewInMemoryStore()
+
+		err = inMemoryStore.CreateAuthorization(context.Background(), Authorization{ID: "1", DeviceCodeHash: "a", UserCode: "BCDFGHJK"})
+		require.NoError(t, err)
+
+		err = inMemoryStore.CreateAuthorization(context.Background(), Authorization{ID: "2", DeviceCodeHash: "b", UserCode: "BCDFGHJK"})
+		require.ErrorIs(t, err, ErrUserCodeExists)
+	})
+
+	t.Run("Denied", func(t *testing.T) {
+		service, _ := newService()
+
+		response := authorize(t, service)
+
+		err := service.Deny(context.Background(), response.UserCode)
+		require.NoError(t, err)
+
+		_, err = service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorAccessDenied})
+
+		_, err = service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidGrant})
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		service, clock := newService()
+
+		response := authorize(t, service)
+
+		clock.Advance(DefaultExpiration)
+
+		err := service.Approve(context.Background(), response.UserCode, user.ID())
+		require.ErrorIs(t, err, ErrAuthorizationNotFound)
+
+		_, err = service.AuthenticateDeviceCode(context.Background(), "registry", "docker", response.DeviceCode)
+		require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorExpiredToken})
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		service, _ := newService()
+
+		response := authorize(t, service)
+
+		testCases := []struct {
+			name       string
+			service    string
+			clientID   string
+			deviceCode string
+		}{
+			{
+				name:       "UnknownDeviceCode",
+				service:    "registry",
+				clientID:   "docker",
+				deviceCode: "unknown",
+			},
+			{
+				name:       "OtherService",
+				service:    "other",
+				clientID:   "docker",
+				deviceCode: response.DeviceCode,
+			},
+			{
+				name:       "OtherClient",
+				service:    "registry",
+				clientID:   "other",
+				deviceCode: response.DeviceCode,
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.name, func(t *testing.T) {
+				_, err := service.AuthenticateDeviceCode(context.Background(), testCase.service, testCase.clientID, testCase.deviceCode)
+				require.ErrorIs(t, err, auth.OAuth2Error{Code: auth.OAuth2ErrorInvalidGrant})
+			})
+		}
+	})
+}
+
+// interleavingStore simulates concurrent requests and user code collisions.
+type interleavingStore struct {
+	*InMemoryStore
+
+	afterRead  func()
+	collisions int
+}
+
+func (s *interleavingStore) CreateAuthorization(ctx context.Context, authorization Authorization) error {
+	if s.collisions > 0 {
+		s.collisions--
+
+		return ErrUserCodeExists
+	}
+
+	return s.InMemoryStore.CreateAuthorization(ctx, authorization)
+}
+
+func (s *interleavingStore) GetAuthorizationByDeviceCodeHash(ctx context.Context, hash string) (Authorization, error) {
+	authorization, err := s.InMemoryStore.GetAuthorizationByDeviceCodeHash(ctx, hash)
+
+	if s.afterRead != nil {
+		s.afterRead()
+	}
+
+	return authorization, err
+}
@@ -0,0 +1,107 @@
+package device
+
+import (
+	"context"
+	"time"
+
+	"github.com/portward/registry-auth/internal/secret"
+)
+
+// InMemoryStore is a [Store] keeping authorizations in memory.
+//
+// It is primarily useful for testing and single instance deployments: authorizations are lost when the process exits.
+type InMemoryStore struct {
+	authorizations *secret.Store[Authorization]
+}
+
+// NewInMemoryStore returns a new [InMemoryStore].
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		authorizations: secret.NewStore(
+			func(authorization Authorization) string { return authorization.ID },
+			func(authorization Authorization) []string {
+				return []string{authorization.DeviceCodeHash, authorization.UserCode}
+			},
+		),
+	}
+}
+
+// CreateAuthorization implements [Store].
+func (s *InMemoryStore) CreateAuthorization(_ context.Context, authorization Authorization) error {
+	if !s.authorizations.Add(authorization) {
+		return ErrUserCodeExists
+	}
+
+	return nil
+}
+
+// GetAuthorizationByDeviceCodeHash implements [Store].
+func (s *InMemoryStore) GetAuthorizationByDeviceCodeHash(_ context.Context, hash string) (Authorization, error) {
+	return s.lookup(hash)
+}
+
+// GetAuthorizationByUserCode implements [Store].
+func (s *InMemoryStore) GetAuthorizationByUserCode(_ context.Context, userCode string) (Authorization, error) {
+	return s.lookup(userCode)
+}
+
+// Device code hashes and user codes never collide: hashes are hex encoded and user codes contain consonants only.
+func (s *InMemoryStore) lookup(key string) (Authorization, error) {
+	authorization, ok := s.authorizations.Lookup(key)
+	if !ok {
+		return Authorization{}, ErrAuthorizationNotFound
+	}
+
+	return authorization, nil
+}
+
+// UpdatePolling implements [Store].
+func (s *InMemoryStore) UpdatePolling(_ context.Context, id string, lastPolledAt time.Time, interval time.Duration) error {
+	ok := s.authorizations.Update(id, func(authorization *Authorization) bool {
+		authorization.LastPolledAt = lastPolledAt
+		authorization.Interval = interval
+
+		return true
+	})
+	if !ok {
+		return ErrAuthorizationNotFound
+	}
+
+	return nil
+}
+
+// UpdateStatus implements [Store].
+func (s *InMemoryStore) UpdateStatus(_ context.Context, id string, status Status, subjectID string) error {
+	ok := s.authorizations.Update(id, func(authorization *Authorization) bool {
+		if authorization.Status != StatusPending {
+			return false
+		}
+
+		authorization.Status = status
+		authorization.SubjectID = subjectID
+
+		return true
+	})
+	if !ok {
+		return ErrAuthorizationNotFound
+	}
+
+	return nil
+}
+
+// DeleteAuthorization implements [Store].
+func (s *InMemoryStore) DeleteAuthorization(_ context.Context, id string) error {
+	if !s.authorizations.Delete(id, nil) {
+		return ErrAuthorizationNotFound
+	}
+
+	return nil
+}
+
+// Prune removes expired authorizations that were never used.
+// Call it periodically to keep memory usage bounded.
+func (s *InMemoryStore) Prune(now time.Time) {
+	s.authorizations.DeleteFunc(func(authorization Authorization) bool {
+		return authorization.Expired(now)
+	})
+}
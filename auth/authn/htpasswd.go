@@ -0,0 +1,267 @@
+package authn
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/pkg/fswatch"
+)
+
+// HtpasswdAuthenticator authenticates users listed in an Apache-style htpasswd file.
+//
+// Supported hash formats are bcrypt ($2y$, $2a$, $2b$), SHA1 ({SHA}), APR1-MD5 ($apr1$) and traditional (DES) crypt.
+//
+// The user table is replaced atomically on every (successful) reload,
+// so HtpasswdAuthenticator is safe for concurrent use while watching the file for changes.
+type HtpasswdAuthenticator struct {
+	path    string
+	entries atomic.Pointer[map[string]User]
+
+	// dummyHash is verified for unknown users: it takes as long to verify as most hashes in the file
+	dummyHash atomic.Pointer[string]
+}
+
+// NewHtpasswdAuthenticator returns a new [HtpasswdAuthenticator] and loads users from the file at path.
+func NewHtpasswdAuthenticator(path string) (*HtpasswdAuthenticator, error) {
+	a := &HtpasswdAuthenticator{
+		path: path,
+	}
+
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Reload reads the htpasswd file and replaces the current user table.
+//
+// If the file cannot be read or parsed, the current user table is kept.
+func (a *HtpasswdAuthenticator) Reload() error {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users, err := ParseHtpasswd(file)
+	if err != nil {
+		return fmt.Errorf("parsing htpasswd file %q: %w", a.path, err)
+	}
+
+	entries := make(map[string]User, len(users))
+
+	for _, user := range users {
+		entries[user.Username] = user
+	}
+
+	dummyHash, err := htpasswdDummyHash(users)
+	if err != nil {
+		return err
+	}
+
+	a.entries.Store(&entries)
+	a.dummyHash.Store(&dummyHash)
+
+	return nil
+}
+
+// htpasswdDummySHA1Hash is verified for unknown users when the file has no bcrypt hashes (other formats are cheap to verify).
+const htpasswdDummySHA1Hash = "{SHA}AAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+// htpasswdDummyHash returns a bcrypt hash with the most common cost in the file.
+//
+// The cost cannot be fixed: htpasswd -B defaults to cost 5,
+// so verifying a dummy hash of a higher cost would reveal which users do not exist.
+func htpasswdDummyHash(users []User) (string, error) {
+	costs := make(map[int]int)
+
+	var cost int
+
+	for _, user := range users {
+		if !isBcryptHash(user.PasswordHash) {
+			continue
+		}
+
+		c, err := bcrypt.Cost([]byte(user.PasswordHash))
+		if err != nil {
+			continue
+		}
+
+		costs[c]++
+
+		if costs[c] > costs[cost] || (costs[c] == costs[cost] && c > cost) {
+			cost = c
+		}
+	}
+
+	if cost == 0 {
+		return htpasswdDummySHA1Hash, nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy"), cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Watch watches the htpasswd file and reloads the user table whenever the file changes.
+//
+// Reload errors are passed to errorHandler (if any) and the previous user table remains in use.
+//
+// Watch blocks until ctx is canceled.
+func (a *HtpasswdAuthenticator) Watch(ctx context.Context, errorHandler auth.ErrorHandler) error {
+	return fswatch.Watch(ctx, a.path, fswatch.DefaultDebounce, func() {
+		err := a.Reload()
+		if err != nil && errorHandler != nil {
+			errorHandler.Handle(err)
+		}
+	})
+}
+
+func (a *HtpasswdAuthenticator) lookup(username string) (User, bool) {
+	entries := a.entries.Load()
+	if entries == nil {
+		return User{}, false
+	}
+
+	user, ok := (*entries)[username]
+
+	return user, ok
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+func (a *HtpasswdAuthenticator) AuthenticatePassword(_ context.Context, username string, password string) (auth.Subject, error) {
+	user, ok := a.lookup(username)
+	if !ok {
+		// timing attack paranoia
+		if dummyHash := a.dummyHash.Load(); dummyHash != nil {
+			compareHtpasswdHash(*dummyHash, password)
+		} else {
+			DefaultPasswordHasher.VerifyDummy(password)
+		}
+
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	if !compareHtpasswdHash(user.PasswordHash, password) {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	return user, nil
+}
+
+// GetSubjectByID implements [SubjectRepository].
+func (a *HtpasswdAuthenticator) GetSubjectByID(_ context.Context, id auth.SubjectID) (auth.Subject, error) {
+	user, ok := a.lookup(id.String())
+	if !ok {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	return user, nil
+}
+
+// ParseHtpasswd parses users from an Apache-style htpasswd file.
+//
+// Empty lines and lines starting with # are ignored.
+// Every user returned by ParseHtpasswd is enabled.
+func ParseHtpasswd(r io.Reader) ([]User, error) {
+	var users []User
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" || hash == "" {
+			return nil, fmt.Errorf("line %d: invalid htpasswd entry", lineNumber)
+		}
+
+		if !isSupportedHtpasswdHash(hash) {
+			return nil, fmt.Errorf("line %d: unsupported hash format for user %q", lineNumber, username)
+		}
+
+		users = append(users, User{
+			Enabled:      true,
+			Username:     username,
+			PasswordHash: hash,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+const (
+	htpasswdPrefixSHA1 = "{SHA}"
+	htpasswdPrefixAPR1 = "$apr1$"
+)
+
+func isSupportedHtpasswdHash(hash string) bool {
+	switch {
+	case isBcryptHash(hash):
+		return true
+	case strings.HasPrefix(hash, htpasswdPrefixSHA1):
+		return true
+	case strings.HasPrefix(hash, htpasswdPrefixAPR1):
+		return true
+	default:
+		return isDESCryptHash(hash)
+	}
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func compareHtpasswdHash(hash string, password string) bool {
+	switch {
+	case isBcryptHash(hash):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+
+	case strings.HasPrefix(hash, htpasswdPrefixSHA1):
+		sum := sha1.Sum([]byte(password))
+
+		return constantTimeEqual(hash[len(htpasswdPrefixSHA1):], base64.StdEncoding.EncodeToString(sum[:]))
+
+	case strings.HasPrefix(hash, htpasswdPrefixAPR1):
+		salt, _, ok := strings.Cut(hash[len(htpasswdPrefixAPR1):], "$")
+		if !ok {
+			return false
+		}
+
+		return constantTimeEqual(hash, apr1Crypt(password, salt))
+
+	case isDESCryptHash(hash):
+		return constantTimeEqual(hash, desCrypt(password, hash[:2]))
+	}
+
+	return false
+}
+
+func constantTimeEqual(x string, y string) bool {
+	return subtle.ConstantTimeCompare([]byte(x), []byte(y)) == 1
+}
@@ -0,0 +1,359 @@
+package authn
+
+import (
+	"crypto/md5"
+	"strings"
+)
+
+// cryptAlphabet is the base64 variant used by crypt(3) implementations.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1Crypt implements the Apache variant of the MD5-based crypt algorithm.
+//
+// See https://httpd.apache.org/docs/2.4/misc/password_encryptions.html
+func apr1Crypt(password string, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	pw := []byte(password)
+
+	alternate := md5.New()
+	alternate.Write(pw)
+	alternate.Write([]byte(salt))
+	alternate.Write(pw)
+	alternateSum := alternate.Sum(nil)
+
+	h := md5.New()
+	h.Write(pw)
+	h.Write([]byte(htpasswdPrefixAPR1))
+	h.Write([]byte(salt))
+
+	for i := len(pw); i > 0; i -= 16 {
+		h.Write(alternateSum[:min(i, 16)])
+	}
+
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+
+		if i&1 == 1 {
+			h.Write(pw)
+		} else {
+			h.Write(sum)
+		}
+
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+
+		if i&1 == 1 {
+			h.Write(sum)
+		} else {
+			h.Write(pw)
+		}
+
+		sum = h.Sum(nil)
+	}
+
+	var b strings.Builder
+
+	b.WriteString(htpasswdPrefixAPR1)
+	b.WriteString(salt)
+	b.WriteString("$")
+
+	for _, group := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		v := uint(sum[group[0]])<<16 | uint(sum[group[1]])<<8 | uint(sum[group[2]])
+
+		writeCrypt64(&b, v, 4)
+	}
+
+	writeCrypt64(&b, uint(sum[11]), 2)
+
+	return b.String()
+}
+
+// writeCrypt64 encodes the n least significant 6-bit groups of v (least significant group first).
+func writeCrypt64(b *strings.Builder, v uint, n int) {
+	for ; n > 0; n-- {
+		b.WriteByte(cryptAlphabet[v&0x3f])
+		v >>= 6
+	}
+}
+
+func isDESCryptHash(hash string) bool {
+	if len(hash) != 13 {
+		return false
+	}
+
+	for i := 0; i < len(hash); i++ {
+		if strings.IndexByte(cryptAlphabet, hash[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// desCrypt implements the traditional DES-based crypt(3) algorithm.
+//
+// It is only here to support legacy htpasswd files (created with htpasswd -d) and should never be used for anything else:
+// only the first 8 characters of the password are significant.
+func desCrypt(password string, salt string) string {
+	var c desCipher
+
+	// The password (up to 8 characters) is turned into a 56-bit key (7 bits per character).
+	var key [64]byte
+	for i := 0; i < len(password) && i < 8; i++ {
+		for j := 0; j < 7; j++ {
+			key[i*8+j] = (password[i] >> (6 - j)) & 1
+		}
+	}
+
+	c.setKey(key)
+
+	// Every bit of the salt swaps two entries in the expansion table.
+	c.e = desE
+	for i := 0; i < 2 && i < len(salt); i++ {
+		v := cryptCharValue(salt[i])
+
+		for j := 0; j < 6; j++ {
+			if (v>>j)&1 == 1 {
+				k := 6*i + j
+				c.e[k], c.e[k+24] = c.e[k+24], c.e[k]
+			}
+		}
+	}
+
+	var block [66]byte
+	for i := 0; i < 25; i++ {
+		c.encrypt((*[64]byte)(block[:64]))
+	}
+
+	var b strings.Builder
+
+	b.WriteString(salt[:2])
+
+	for i := 0; i < 11; i++ {
+		var v byte
+		for j := 0; j < 6; j++ {
+			v = v<<1 | block[i*6+j]
+		}
+
+		b.WriteByte(cryptAlphabet[v])
+	}
+
+	return b.String()
+}
+
+func cryptCharValue(c byte) byte {
+	if c > 'Z' {
+		c -= 6
+	}
+
+	if c > '9' {
+		c -= 7
+	}
+
+	return (c - '.') & 0x3f
+}
+
+// desCipher is a bit-oriented (and intentionally simple) DES implementation with a modifiable expansion table.
+// Bits are stored one per byte.
+type desCipher struct {
+	subkeys [16][48]byte
+	e       [48]byte
+}
+
+func (c *desCipher) setKey(key [64]byte) {
+	var cd [56]byte
+	for i, p := range desPC1 {
+		cd[i] = key[p-1]
+	}
+
+	for round, shift := range desShifts {
+		for ; shift > 0; shift-- {
+			c0, d0 := cd[0], cd[28]
+			copy(cd[0:27], cd[1:28])
+			copy(cd[28:55], cd[29:56])
+			cd[27], cd[55] = c0, d0
+		}
+
+		for i, p := range desPC2 {
+			c.subkeys[round][i] = cd[p-1]
+		}
+	}
+}
+
+func (c *desCipher) encrypt(block *[64]byte) {
+	var lr [64]byte
+	for i, p := range desIP {
+		lr[i] = block[p-1]
+	}
+
+	l, r := lr[:32], lr[32:]
+
+	for round := 0; round < 16; round++ {
+		var expanded [48]byte
+		for i, p := range c.e {
+			expanded[i] = r[p-1] ^ c.subkeys[round][i]
+		}
+
+		var f [32]byte
+		for box := 0; box < 8; box++ {
+			in := expanded[box*6 : box*6+6]
+			row := in[0]<<1 | in[5]
+			col := in[1]<<3 | in[2]<<2 | in[3]<<1 | in[4]
+			v := desS[box][row*16+col]
+
+			for j := 0; j < 4; j++ {
+				f[box*4+j] = (v >> (3 - j)) & 1
+			}
+		}
+
+		var next [32]byte
+		for i, p := range desP {
+			next[i] = l[i] ^ f[p-1]
+		}
+
+		copy(l, r)
+		copy(r, next[:])
+	}
+
+	// Undo the last swap
+	var rl [64]byte
+	copy(rl[:32], r)
+	copy(rl[32:], l)
+
+	for i, p := range desFP {
+		block[i] = rl[p-1]
+	}
+}
+
+var desIP = [64]byte{
+	58, 50, 42, 34, 26, 18, 10, 2,
+	60, 52, 44, 36, 28, 20, 12, 4,
+	62, 54, 46, 38, 30, 22, 14, 6,
+	64, 56, 48, 40, 32, 24, 16, 8,
+	57, 49, 41, 33, 25, 17, 9, 1,
+	59, 51, 43, 35, 27, 19, 11, 3,
+	61, 53, 45, 37, 29, 21, 13, 5,
+	63, 55, 47, 39, 31, 23, 15, 7,
+}
+
+var desFP = [64]byte{
+	40, 8, 48, 16, 56, 24, 64, 32,
+	39, 7, 47, 15, 55, 23, 63, 31,
+	38, 6, 46, 14, 54, 22, 62, 30,
+	37, 5, 45, 13, 53, 21, 61, 29,
+	36, 4, 44, 12, 52, 20, 60, 28,
+	35, 3, 43, 11, 51, 19, 59, 27,
+	34, 2, 42, 10, 50, 18, 58, 26,
+	33, 1, 41, 9, 49, 17, 57, 25,
+}
+
+var desE = [48]byte{
+	32, 1, 2, 3, 4, 5,
+	4, 5, 6, 7, 8, 9,
+	8, 9, 10, 11, 12, 13,
+	12, 13, 14, 15, 16, 17,
+	16, 17, 18, 19, 20, 21,
+	20, 21, 22, 23, 24, 25,
+	24, 25, 26, 27, 28, 29,
+	28, 29, 30, 31, 32, 1,
+}
+
+var desP = [32]byte{
+	16, 7, 20, 21, 29, 12, 28, 17,
+	1, 15, 23, 26, 5, 18, 31, 10,
+	2, 8, 24, 14, 32, 27, 3, 9,
+	19, 13, 30, 6, 22, 11, 4, 25,
+}
+
+var desPC1 = [56]byte{
+	57, 49, 41, 33, 25, 17, 9,
+	1, 58, 50, 42, 34, 26, 18,
+	10, 2, 59, 51, 43, 35, 27,
+	19, 11, 3, 60, 52, 44, 36,
+	63, 55, 47, 39, 31, 23, 15,
+	7, 62, 54, 46, 38, 30, 22,
+	14, 6, 61, 53, 45, 37, 29,
+	21, 13, 5, 28, 20, 12, 4,
+}
+
+var desPC2 = [48]byte{
+	14, 17, 11, 24, 1, 5,
+	3, 28, 15, 6, 21, 10,
+	23, 19, 12, 4, 26, 8,
+	16, 7, 27, 20, 13, 2,
+	41, 52, 31, 37, 47, 55,
+	30, 40, 51, 45, 33, 48,
+	44, 49, 39, 56, 34, 53,
+	46, 42, 50, 36, 29, 32,
+}
+
+var desShifts = [16]int{1, 1, 2, 2, 2, 2, 2, 2, 1, 2, 2, 2, 2, 2, 2, 1}
+
+var desS = [8][64]byte{
+	{
+		14, 4, 13, 1, 2, 15, 11, 8, 3, 10, 6, 12, 5, 9, 0, 7,
+		0, 15, 7, 4, 14, 2, 13, 1, 10, 6, 12, 11, 9, 5, 3, 8,
+		4, 1, 14, 8, 13, 6, 2, 11, 15, 12, 9, 7, 3, 10, 5, 0,
+		15, 12, 8, 2, 4, 9, 1, 7, 5, 11, 3, 14, 10, 0, 6, 13,
+	},
+	{
+		15, 1, 8, 14, 6, 11, 3, 4, 9, 7, 2, 13, 12, 0, 5, 10,
+		3, 13, 4, 7, 15, 2, 8, 14, 12, 0, 1, 10, 6, 9, 11, 5,
+		0, 14, 7, 11, 10, 4, 13, 1, 5, 8, 12, 6, 9, 3, 2, 15,
+		13, 8, 10, 1, 3, 15, 4, 2, 11, 6, 7, 12, 0, 5, 14, 9,
+	},
+	{
+		10, 0, 9, 14, 6, 3, 15, 5, 1, 13, 12, 7, 11, 4, 2, 8,
+		13, 7, 0, 9, 3, 4, 6, 10, 2, 8, 5, 14, 12, 11, 15, 1,
+		13, 6, 4, 9, 8, 15, 3, 0, 11, 1, 2, 12, 5, 10, 14, 7,
+		1, 10, 13, 0, 6, 9, 8, 7, 4, 15, 14, 3, 11, 5, 2, 12,
+	},
+	{
+		7, 13, 14, 3, 0, 6, 9, 10, 1, 2, 8, 5, 11, 12, 4, 15,
+		13, 8, 11, 5, 6, 15, 0, 3, 4, 7, 2, 12, 1, 10, 14, 9,
+		10, 6, 9, 0, 12, 11, 7, 13, 15, 1, 3, 14, 5, 2, 8, 4,
+		3, 15, 0, 6, 10, 1, 13, 8, 9, 4, 5, 11, 12, 7, 2, 14,
+	},
+	{
+		2, 12, 4, 1, 7, 10, 11, 6, 8, 5, 3, 15, 13, 0, 14, 9,
+		14, 11, 2, 12, 4, 7, 13, 1, 5, 0, 15, 10, 3, 9, 8, 6,
+		4, 2, 1, 11, 10, 13, 7, 8, 15, 9, 12, 5, 6, 3, 0, 14,
+		11, 8, 12, 7, 1, 14, 2, 13, 6, 15, 0, 9, 10, 4, 5, 3,
+	},
+	{
+		12, 1, 10, 15, 9, 2, 6, 8, 0, 13, 3, 4, 14, 7, 5, 11,
+		10, 15, 4, 2, 7, 12, 9, 5, 6, 1, 13, 14, 0, 11, 3, 8,
+		9, 14, 15, 5, 2, 8, 12, 3, 7, 0, 4, 10, 1, 13, 11, 6,
+		4, 3, 2, 12, 9, 5, 15, 10, 11, 14, 1, 7, 6, 0, 8, 13,
+	},
+	{
+		4, 11, 2, 14, 15, 0, 8, 13, 3, 12, 9, 7, 5, 10, 6, 1,
+		13, 0, 11, 7, 4, 9, 1, 10, 14, 3, 5, 12, 2, 15, 8, 6,
+		1, 4, 11, 13, 12, 3, 7, 14, 10, 15, 6, 8, 0, 5, 9, 2,
+		6, 11, 13, 8, 1, 4, 10, 7, 9, 5, 0, 15, 14, 2, 3, 12,
+	},
+	{
+		13, 2, 8, 4, 6, 15, 11, 1, 10, 9, 3, 14, 5, 0, 12, 7,
+		1, 15, 13, 8, 10, 3, 7, 4, 12, 5, 6, 11, 0, 14, 9, 2,
+		7, 11, 4, 1, 9, 12, 14, 2, 0, 6, 10, 13, 15, 3, 5, 8,
+		2, 1, 14, 7, 4, 10, 8, 13, 15, 12, 9, 0, 3, 5, 6, 11,
+	},
+}
@@ -0,0 +1,193 @@
+package authn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+func TestHtpasswdAuthenticator(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	htpasswd := strings.Join([]string{
+		"# comment",
+		"",
+		"bcrypt:" + strings.Replace(string(bcryptHash), "$2a$", "$2y$", 1),
+		"sha1:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		"apr1:$apr1$xxxxxxxx$/mULyOsdWlXlIt5U99q7h1",
+		"crypt:abJnggxhB/yWI",
+		"crypt2:ZzIyHEjAFZRko",
+	}, "\n")
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+
+	err = os.WriteFile(path, []byte(htpasswd), 0o600)
+	require.NoError(t, err)
+
+	authenticator, err := NewHtpasswdAuthenticator(path)
+	require.NoError(t, err)
+
+	t.Run("OK", func(t *testing.T) {
+		testCases := []struct {
+			username string
+			password string
+		}{
+			{"bcrypt", "password"},
+			{"sha1", "password"},
+			{"apr1", "secret"},
+			{"crypt", "password"},
+			{"crypt2", "longpass"}, // only the first 8 characters are significant
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.username, func(t *testing.T) {
+				subject, err := authenticator.AuthenticatePassword(context.Background(), testCase.username, testCase.password)
+				require.NoError(t, err)
+
+				assert.Equal(t, auth.SubjectIDFromString(testCase.username), subject.ID())
+
+				subject, err = authenticator.GetSubjectByID(context.Background(), subject.ID())
+				require.NoError(t, err)
+
+				assert.Equal(t, auth.SubjectIDFromString(testCase.username), subject.ID())
+			})
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		testCases := []struct {
+			username string
+			password string
+		}{
+			{"bcrypt", "otherPassword"},
+			{"sha1", "otherPassword"},
+			{"apr1", "otherPassword"},
+			{"crypt", "otherPassword"},
+			{"unknown", "password"},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.username, func(t *testing.T) {
+				_, err := authenticator.AuthenticatePassword(context.Background(), testCase.username, testCase.password)
+				require.Error(t, err)
+
+				assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+			})
+		}
+	})
+}
+
+func TestHtpasswdAuthenticator_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "htpasswd")
+
+	err := os.WriteFile(path, []byte("user:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="), 0o600)
+	require.NoError(t, err)
+
+	authenticator, err := NewHtpasswdAuthenticator(path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- authenticator.Watch(ctx, nil)
+	}()
+
+	// Give the watcher some time to start
+	time.Sleep(100 * time.Millisecond)
+
+	// Atomically replace the file
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, []byte("other:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="), 0o600)
+	require.NoError(t, err)
+
+	err = os.Rename(tmp, path)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		_, err := authenticator.AuthenticatePassword(context.Background(), "other", "password")
+
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_, err = authenticator.AuthenticatePassword(context.Background(), "user", "password")
+	assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+	// Invalid files are ignored
+	err = os.WriteFile(path, []byte("invalid"), 0o600)
+	require.NoError(t, err)
+
+	err = authenticator.Reload()
+	require.Error(t, err)
+
+	_, err = authenticator.AuthenticatePassword(context.Background(), "other", "password")
+	require.NoError(t, err)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestHtpasswdDummyHash(t *testing.T) {
+	hash := func(cost int) string {
+		hash, err := bcrypt.GenerateFromPassword([]byte("password"), cost)
+		require.NoError(t, err)
+
+		return string(hash)
+	}
+
+	t.Run("Bcrypt", func(t *testing.T) {
+		users := []User{
+			{Username: "user1", PasswordHash: hash(bcrypt.MinCost)},
+			{Username: "user2", PasswordHash: hash(bcrypt.MinCost + 1)},
+			{Username: "user3", PasswordHash: hash(bcrypt.MinCost + 1)},
+			{Username: "user4", PasswordHash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+		}
+
+		dummyHash, err := htpasswdDummyHash(users)
+		require.NoError(t, err)
+
+		cost, err := bcrypt.Cost([]byte(dummyHash))
+		require.NoError(t, err)
+
+		assert.Equal(t, bcrypt.MinCost+1, cost)
+	})
+
+	t.Run("NoBcrypt", func(t *testing.T) {
+		users := []User{
+			{Username: "user", PasswordHash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="},
+		}
+
+		dummyHash, err := htpasswdDummyHash(users)
+		require.NoError(t, err)
+
+		assert.Equal(t, htpasswdDummySHA1Hash, dummyHash)
+	})
+}
+
+func TestParseHtpasswd(t *testing.T) {
+	t.Run("UnsupportedHash", func(t *testing.T) {
+		_, err := ParseHtpasswd(strings.NewReader("user:$6$salt$hash"))
+		require.Error(t, err)
+	})
+
+	t.Run("InvalidEntry", func(t *testing.T) {
+		_, err := ParseHtpasswd(strings.NewReader("user"))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,389 @@
+// Package ldap authenticates users against an LDAP directory (eg. OpenLDAP or Active Directory).
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"maps"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// Config describes how users and groups are looked up in the directory.
+type Config struct {
+	// BindDN and BindPassword are the credentials of the service account used for searching the directory.
+	// If empty, searches are performed anonymously.
+	BindDN       string
+	BindPassword string
+
+	// BaseDN is the base of the user search (eg. "ou=people,dc=example,dc=com").
+	BaseDN string
+
+	// UserFilter is the filter used to find a user.
+	// The {username} placeholder is replaced with the (escaped) username.
+	//
+	// Defaults to "(uid={username})". For Active Directory use "(sAMAccountName={username})".
+	UserFilter string
+
+	// UsernameAttribute is the attribute used as the [auth.SubjectID].
+	//
+	// Defaults to "uid". For Active Directory use "sAMAccountName".
+	UsernameAttribute string
+
+	// Attributes maps directory attributes to [auth.Subject] attributes.
+	// Only the first value of each attribute is mapped.
+	Attributes map[string]string
+
+	// MemberOfAttribute is a multivalued attribute (eg. "memberOf") on the user entry containing group DNs.
+	// The value of the first RDN (usually CN) of each group is used as the group name.
+	MemberOfAttribute string
+
+	// GroupBaseDN is the base of the group search (eg. "ou=groups,dc=example,dc=com").
+	// If empty, no group search is performed.
+	GroupBaseDN string
+
+	// GroupFilter is the filter used to find groups of a user.
+	// The {dn} and {username} placeholders are replaced with the (escaped) user DN and username.
+	//
+	// Defaults to "(member={dn})".
+	GroupFilter string
+
+	// GroupNameAttribute is the attribute of group entries used as the group name.
+	//
+	// Defaults to "cn".
+	GroupNameAttribute string
+
+	// GroupsAttribute is the [auth.Subject] attribute group names are stored in (as a []string).
+	//
+	// Defaults to "groups".
+	GroupsAttribute string
+}
+
+func (c Config) withDefaults() Config {
+	if c.UserFilter == "" {
+		c.UserFilter = "(uid={username})"
+	}
+
+	if c.UsernameAttribute == "" {
+		c.UsernameAttribute = "uid"
+	}
+
+	if c.GroupFilter == "" {
+		c.GroupFilter = "(member={dn})"
+	}
+
+	if c.GroupNameAttribute == "" {
+		c.GroupNameAttribute = "cn"
+	}
+
+	if c.GroupsAttribute == "" {
+		c.GroupsAttribute = "groups"
+	}
+
+	return c
+}
+
+// Conn is the subset of LDAP operations used by [Authenticator].
+//
+// [ldap.Conn] implements this interface.
+type Conn interface {
+	Bind(username string, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// Dialer opens a new connection to an LDAP server.
+type Dialer interface {
+	Dial(ctx context.Context) (Conn, error)
+}
+
+// URLDialer connects to an LDAP server using a URL (eg. ldaps://ldap.example.com:636).
+type URLDialer struct {
+	URL string
+
+	// TLSConfig is used for ldaps:// URLs and StartTLS.
+	TLSConfig *tls.Config
+
+	// StartTLS upgrades ldap:// connections to TLS.
+	StartTLS bool
+
+	// Timeout limits dialing and every request sent to the server.
+	// If the context passed to Dial has an earlier deadline, that is used instead.
+	Timeout time.Duration
+}
+
+// Dial implements [Dialer].
+func (d URLDialer) Dial(ctx context.Context) (Conn, error) {
+	timeout := d.Timeout
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+
+	conn, err := ldap.DialURL(d.URL, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}), ldap.DialWithTLSConfig(d.TLSConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout > 0 {
+		conn.SetTimeout(timeout)
+	}
+
+	if d.StartTLS {
+		err := conn.StartTLS(d.TLSConfig)
+		if err != nil {
+			conn.Close()
+
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// Authenticator authenticates users using the search-then-bind method:
+// it looks up the user entry with a service account, then binds as the user with the provided password.
+//
+// Authenticator returns [auth.ErrAuthenticationFailed] if the user cannot be found, is ambiguous or the password is invalid.
+// Every other error (eg. connection problems) is returned wrapped, so callers can tell infrastructure errors from bad credentials.
+type Authenticator struct {
+	config Config
+	dialer Dialer
+}
+
+// NewAuthenticator returns a new [Authenticator].
+func NewAuthenticator(config Config, dialer Dialer) Authenticator {
+	return Authenticator{
+		config: config.withDefaults(),
+		dialer: dialer,
+	}
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+func (a Authenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	// An empty password would result in an unauthenticated bind, which succeeds on most servers.
+	if username == "" || password == "" {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	conn, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Bind(entry.DN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, fmt.Errorf("ldap: binding as user: %w", err)
+	}
+
+	// Search for groups as the service account (users may not have the necessary permissions)
+	if err := a.bind(conn); err != nil {
+		return nil, err
+	}
+
+	return a.newUser(conn, entry)
+}
+
+// GetSubjectByID implements [authn.SubjectRepository].
+func (a Authenticator) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	conn, err := a.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := a.findUser(conn, id.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return a.newUser(conn, entry)
+}
+
+func (a Authenticator) connect(ctx context.Context) (Conn, error) {
+	conn, err := a.dialer.Dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: connecting to server: %w", err)
+	}
+
+	if err := a.bind(conn); err != nil {
+		conn.Close()
+
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (a Authenticator) bind(conn Conn) error {
+	if a.config.BindDN == "" {
+		return nil
+	}
+
+	if err := conn.Bind(a.config.BindDN, a.config.BindPassword); err != nil {
+		return fmt.Errorf("ldap: binding as service account: %w", err)
+	}
+
+	return nil
+}
+
+func (a Authenticator) findUser(conn Conn, username string) (*ldap.Entry, error) {
+	attributes := []string{a.config.UsernameAttribute}
+
+	for attr := range a.config.Attributes {
+		attributes = append(attributes, attr)
+	}
+
+	if a.config.MemberOfAttribute != "" {
+		attributes = append(attributes, a.config.MemberOfAttribute)
+	}
+
+	request := ldap.NewSearchRequest(
+		a.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		strings.ReplaceAll(a.config.UserFilter, "{username}", ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return nil, auth.ErrAuthenticationFailed
+	} else if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		// More than one user matches the filter
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, fmt.Errorf("ldap: searching user: %w", err)
+	}
+
+	if len(result.Entries) != 1 {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	entry := result.Entries[0]
+
+	// Make sure the filter matched the user we were looking for (and not eg. an alias)
+	if entry.GetAttributeValue(a.config.UsernameAttribute) == "" {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	return entry, nil
+}
+
+func (a Authenticator) newUser(conn Conn, entry *ldap.Entry) (User, error) {
+	attrs := make(map[string]any, len(a.config.Attributes)+1)
+
+	for ldapAttr, subjectAttr := range a.config.Attributes {
+		if v := entry.GetAttributeValue(ldapAttr); v != "" {
+			attrs[subjectAttr] = v
+		}
+	}
+
+	groups, err := a.findGroups(conn, entry)
+	if err != nil {
+		return User{}, err
+	}
+
+	if groups != nil {
+		attrs[a.config.GroupsAttribute] = groups
+	}
+
+	return User{
+		DN:       entry.DN,
+		Username: entry.GetAttributeValue(a.config.UsernameAttribute),
+		Attrs:    attrs,
+	}, nil
+}
+
+func (a Authenticator) findGroups(conn Conn, entry *ldap.Entry) ([]string, error) {
+	if a.config.MemberOfAttribute == "" && a.config.GroupBaseDN == "" {
+		return nil, nil
+	}
+
+	groups := []string{}
+
+	if a.config.MemberOfAttribute != "" {
+		for _, groupDN := range entry.GetAttributeValues(a.config.MemberOfAttribute) {
+			dn, err := ldap.ParseDN(groupDN)
+			if err != nil || len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+				continue
+			}
+
+			groups = append(groups, dn.RDNs[0].Attributes[0].Value)
+		}
+	}
+
+	if a.config.GroupBaseDN != "" {
+		filter := strings.NewReplacer(
+			"{dn}", ldap.EscapeFilter(entry.DN),
+			"{username}", ldap.EscapeFilter(entry.GetAttributeValue(a.config.UsernameAttribute)),
+		).Replace(a.config.GroupFilter)
+
+		request := ldap.NewSearchRequest(
+			a.config.GroupBaseDN,
+			ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+			filter,
+			[]string{a.config.GroupNameAttribute},
+			nil,
+		)
+
+		result, err := conn.Search(request)
+		if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, fmt.Errorf("ldap: searching groups: %w", err)
+		}
+
+		if result != nil {
+			for _, group := range result.Entries {
+				if name := group.GetAttributeValue(a.config.GroupNameAttribute); name != "" {
+					groups = append(groups, name)
+				}
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// User is an [auth.Subject] found in an LDAP directory.
+type User struct {
+	DN       string
+	Username string
+	Attrs    map[string]any
+}
+
+// ID implements [auth.Subject].
+func (u User) ID() auth.SubjectID {
+	return auth.SubjectIDFromString(u.Username)
+}
+
+// Attribute implements [auth.Subject].
+func (u User) Attribute(key string) (any, bool) {
+	if u.Attrs == nil {
+		return "", false
+	}
+
+	v, ok := u.Attrs[key]
+
+	return v, ok
+}
+
+// Attributes implements [auth.Subject].
+func (u User) Attributes() map[string]any {
+	return maps.Clone(u.Attrs)
+}
@@ -0,0 +1,258 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// directory is an in-process LDAP stand-in.
+type directory struct {
+	entries   []*ldap.Entry
+	passwords map[string]string
+
+	err error
+}
+
+func (d *directory) add(dn string, password string, attributes map[string][]string) {
+	d.entries = append(d.entries, ldap.NewEntry(dn, attributes))
+
+	if password != "" {
+		if d.passwords == nil {
+			d.passwords = make(map[string]string)
+		}
+
+		d.passwords[dn] = password
+	}
+}
+
+func (d *directory) Dial(_ context.Context) (Conn, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return directoryConn{d}, nil
+}
+
+type directoryConn struct {
+	directory *directory
+}
+
+func (c directoryConn) Bind(username string, password string) error {
+	if p, ok := c.directory.passwords[username]; !ok || p != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+
+	return nil
+}
+
+func (c directoryConn) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	filter, err := ldap.CompileFilter(request.Filter)
+	if err != nil {
+		return nil, ldap.NewError(ldap.LDAPResultFilterError, err)
+	}
+
+	result := &ldap.SearchResult{}
+
+	for _, entry := range c.directory.entries {
+		if !strings.HasSuffix(strings.ToLower(entry.DN), ","+strings.ToLower(request.BaseDN)) {
+			continue
+		}
+
+		if !matchFilter(filter, entry) {
+			continue
+		}
+
+		if request.SizeLimit > 0 && len(result.Entries) == request.SizeLimit {
+			return result, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+		}
+
+		result.Entries = append(result.Entries, entry)
+	}
+
+	return result, nil
+}
+
+func (c directoryConn) Close() error {
+	return nil
+}
+
+func matchFilter(filter *ber.Packet, entry *ldap.Entry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+
+		return true
+
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+
+		return false
+
+	case ldap.FilterEqualityMatch:
+		attribute, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+
+		if strings.EqualFold(attribute, "dn") {
+			return strings.EqualFold(entry.DN, value)
+		}
+
+		for _, v := range entry.GetAttributeValues(attribute) {
+			if strings.EqualFold(v, value) {
+				return true
+			}
+		}
+
+		return false
+
+	case ldap.FilterPresent:
+		return entry.GetAttributeValue(ber.DecodeString(filter.Data.Bytes())) != ""
+	}
+
+	return false
+}
+
+func newDirectory() *directory {
+	d := &directory{}
+
+	d.add("cn=service,dc=example,dc=com", "service", nil)
+	d.add("uid=john,ou=people,dc=example,dc=com", "password", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"john"},
+		"mail":        {"john@example.com"},
+		"memberOf":    {"cn=admins,ou=groups,dc=example,dc=com"},
+	})
+	d.add("uid=jane,ou=people,dc=example,dc=com", "password", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"jane"},
+		"mail":        {"jane@example.com"},
+	})
+	d.add("cn=developers,ou=groups,dc=example,dc=com", "", map[string][]string{
+		"cn":     {"developers"},
+		"member": {"uid=john,ou=people,dc=example,dc=com", "uid=jane,ou=people,dc=example,dc=com"},
+	})
+
+	return d
+}
+
+func TestAuthenticator(t *testing.T) {
+	config := Config{
+		BindDN:            "cn=service,dc=example,dc=com",
+		BindPassword:      "service",
+		BaseDN:            "ou=people,dc=example,dc=com",
+		UserFilter:        "(&(objectClass=person)(uid={username}))",
+		Attributes:        map[string]string{"mail": "email"},
+		MemberOfAttribute: "memberOf",
+		GroupBaseDN:       "ou=groups,dc=example,dc=com",
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		authenticator := NewAuthenticator(config, newDirectory())
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "john", "password")
+		require.NoError(t, err)
+
+		expected := User{
+			DN:       "uid=john,ou=people,dc=example,dc=com",
+			Username: "john",
+			Attrs: map[string]any{
+				"email":  "john@example.com",
+				"groups": []string{"admins", "developers"},
+			},
+		}
+
+		assert.Equal(t, expected, subject)
+
+		subject, err = authenticator.GetSubjectByID(context.Background(), auth.SubjectIDFromString("john"))
+		require.NoError(t, err)
+
+		assert.Equal(t, expected, subject)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("PasswordMismatch", func(t *testing.T) {
+			authenticator := NewAuthenticator(config, newDirectory())
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "john", "otherPassword")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("EmptyPassword", func(t *testing.T) {
+			authenticator := NewAuthenticator(config, newDirectory())
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "john", "")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("UnknownUser", func(t *testing.T) {
+			authenticator := NewAuthenticator(config, newDirectory())
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "unknown", "password")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+			_, err = authenticator.GetSubjectByID(context.Background(), auth.SubjectIDFromString("unknown"))
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("AmbiguousUser", func(t *testing.T) {
+			config := config
+			config.UserFilter = "(|(uid={username})(objectClass=person))"
+
+			authenticator := NewAuthenticator(config, newDirectory())
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "john", "password")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("ServiceAccount", func(t *testing.T) {
+			config := config
+			config.BindPassword = "otherPassword"
+
+			authenticator := NewAuthenticator(config, newDirectory())
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "john", "password")
+			require.Error(t, err)
+
+			assert.NotErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("Connection", func(t *testing.T) {
+			directory := newDirectory()
+			directory.err = errors.New("connection refused")
+
+			authenticator := NewAuthenticator(config, directory)
+
+			_, err := authenticator.AuthenticatePassword(context.Background(), "john", "password")
+			require.Error(t, err)
+
+			assert.NotErrorIs(t, err, auth.ErrAuthenticationFailed)
+			assert.ErrorIs(t, err, directory.err)
+		})
+	})
+}
@@ -0,0 +1,337 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// LockoutPolicy describes how repeated authentication failures are penalized.
+//
+// After FreeAttempts consecutive failures, every further failure blocks authentication for an exponentially growing period
+// (BaseDelay, 2*BaseDelay, 4*BaseDelay...), capped at MaxDelay (effectively a temporary lock).
+//
+// A zero BaseDelay disables the policy.
+type LockoutPolicy struct {
+	// FreeAttempts is the number of failures tolerated without any delay.
+	FreeAttempts int
+
+	// BaseDelay is the delay applied after the first failure that exceeds FreeAttempts.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay. If zero, the delay is not capped.
+	MaxDelay time.Duration
+
+	// ResetAfter is the amount of time after the last failure when the failure counter is reset.
+	// If zero, failures are never forgotten (only a successful authentication resets the counter).
+	ResetAfter time.Duration
+}
+
+func (p LockoutPolicy) enabled() bool {
+	return p.BaseDelay > 0
+}
+
+// lockedUntil returns the time authentication is blocked until.
+func (p LockoutPolicy) lockedUntil(record FailureRecord) time.Time {
+	excess := record.Count - p.FreeAttempts
+	if excess <= 0 {
+		return time.Time{}
+	}
+
+	delay := p.BaseDelay
+
+	for i := 1; i < excess; i++ {
+		delay *= 2
+
+		if (p.MaxDelay > 0 && delay >= p.MaxDelay) || delay <= 0 {
+			delay = p.MaxDelay
+
+			break
+		}
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return record.LastFailure.Add(delay)
+}
+
+// FailureRecord describes consecutive authentication failures.
+type FailureRecord struct {
+	Count       int
+	LastFailure time.Time
+}
+
+// FailureStore keeps track of authentication failures.
+//
+// Implementations MUST be safe for concurrent use.
+type FailureStore interface {
+	// UpdateFailures atomically updates the failures recorded for a key and returns the updated record.
+	//
+	// update receives the current record (a zero record if there are none) and returns the new one (a zero record removes the key).
+	// Other updates of the same key MUST NOT interleave (eg. hold a lock or run update in a transaction).
+	UpdateFailures(ctx context.Context, key string, update func(FailureRecord) FailureRecord) (FailureRecord, error)
+}
+
+// LockoutConfig configures a [LockoutAuthenticator] (or the lockout of a [ClientRegistry], see [WithClientLockout]).
+type LockoutConfig struct {
+	// Username is applied to failures per username.
+	Username LockoutPolicy
+
+	// ClientIP is applied to failures per client IP (see [auth.ClientInfo]).
+	ClientIP LockoutPolicy
+
+	// ClientID is applied to failures per client ID (client secrets, see [WithClientLockout]).
+	ClientID LockoutPolicy
+
+	// Clock is used to determine the current time. Defaults to the real time.
+	Clock clockwork.Clock
+}
+
+// LockoutAuthenticator protects a [auth.PasswordAuthenticator] from brute-force attacks.
+//
+// It tracks failed attempts per username and per client IP and temporarily blocks authentication after too many failures.
+// Blocked attempts are rejected with an [auth.TooManyAttemptsError] without consulting the underlying authenticator.
+type LockoutAuthenticator struct {
+	authenticator auth.PasswordAuthenticator
+	lockout       lockout
+}
+
+// NewLockoutAuthenticator returns a new [LockoutAuthenticator].
+func NewLockoutAuthenticator(authenticator auth.PasswordAuthenticator, store FailureStore, config LockoutConfig) LockoutAuthenticator {
+	return LockoutAuthenticator{
+		authenticator: authenticator,
+		lockout:       newLockout(store, config),
+	}
+}
+
+// lockout records authentication attempts in a [FailureStore] and blocks them after too many failures.
+type lockout struct {
+	store  FailureStore
+	config LockoutConfig
+	clock  clockwork.Clock
+}
+
+func newLockout(store FailureStore, config LockoutConfig) lockout {
+	l := lockout{
+		store:  store,
+		config: config,
+		clock:  config.Clock,
+	}
+
+	if l.clock == nil {
+		l.clock = clockwork.NewRealClock()
+	}
+
+	return l
+}
+
+type lockoutKey struct {
+	key    string
+	policy LockoutPolicy
+
+	// resetOnSuccess resets the counter after a successful authentication.
+	resetOnSuccess bool
+}
+
+// keys returns the keys of an attempt: the key of the identity (if its policy is enabled) and the key of the client IP (if known).
+func (l lockout) keys(ctx context.Context, identity lockoutKey) []lockoutKey {
+	var keys []lockoutKey
+
+	if identity.policy.enabled() {
+		keys = append(keys, identity)
+	}
+
+	if info, ok := auth.ClientInfoFromContext(ctx); ok && info.IP != "" && l.config.ClientIP.enabled() {
+		keys = append(keys, lockoutKey{"ip:" + info.IP, l.config.ClientIP, false})
+	}
+
+	return keys
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+//
+// Every attempt is recorded as a failure before the underlying authenticator is consulted (and released if it does not fail),
+// so concurrent attempts cannot bypass the lockout.
+func (a LockoutAuthenticator) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	// Only reset the username counter: a valid account should not help an attacker to reset the counter of an IP.
+	keys := a.lockout.keys(ctx, lockoutKey{"username:" + username, a.lockout.config.Username, true})
+
+	var subject auth.Subject
+
+	err := a.lockout.attempt(ctx, keys, func() error {
+		var err error
+
+		subject, err = a.authenticator.AuthenticatePassword(ctx, username, password)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return subject, nil
+}
+
+// attempt runs verify unless a key is locked.
+//
+// The attempt is recorded as a failure before verify runs and released unless verify returns [auth.ErrAuthenticationFailed].
+func (l lockout) attempt(ctx context.Context, keys []lockoutKey, verify func() error) error {
+	now := l.clock.Now()
+
+	attempts := make([]lockoutAttempt, 0, len(keys))
+
+	for _, key := range keys {
+		attempt, err := l.begin(ctx, key, now)
+		if err != nil {
+			return l.abort(ctx, attempts, err)
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	err := verify()
+	if errors.Is(err, auth.ErrAuthenticationFailed) {
+		// The failure is already recorded
+		return err
+	} else if err != nil {
+		// Infrastructure errors are not failed attempts
+		return l.abort(ctx, attempts, err)
+	}
+
+	return l.release(ctx, attempts, true)
+}
+
+// lockoutAttempt is an authentication attempt recorded as a failure in advance.
+type lockoutAttempt struct {
+	key      lockoutKey
+	previous FailureRecord
+	recorded FailureRecord
+}
+
+// begin records an attempt as a failure unless the key is locked.
+func (l lockout) begin(ctx context.Context, key lockoutKey, now time.Time) (lockoutAttempt, error) {
+	result := lockoutAttempt{
+		key: key,
+	}
+
+	var lockedUntil time.Time
+
+	_, err := l.store.UpdateFailures(ctx, key.key, func(record FailureRecord) FailureRecord {
+		result.previous = record
+
+		if key.policy.ResetAfter > 0 && now.Sub(record.LastFailure) > key.policy.ResetAfter {
+			record = FailureRecord{}
+		}
+
+		lockedUntil = key.policy.lockedUntil(record)
+		if now.Before(lockedUntil) {
+			return result.previous
+		}
+
+		record.Count++
+		record.LastFailure = now
+
+		result.recorded = record
+
+		return record
+	})
+	if err != nil {
+		return lockoutAttempt{}, err
+	}
+
+	if now.Before(lockedUntil) {
+		return lockoutAttempt{}, auth.TooManyAttemptsError{
+			RetryAfter: lockedUntil.Sub(now),
+		}
+	}
+
+	return result, nil
+}
+
+// abort releases attempts and returns err (along with release errors).
+func (l lockout) abort(ctx context.Context, attempts []lockoutAttempt, err error) error {
+	if releaseErr := l.release(ctx, attempts, false); releaseErr != nil {
+		return errors.Join(err, releaseErr)
+	}
+
+	return err
+}
+
+// release takes back failures recorded for attempts that did not fail.
+//
+// Records are restored unless other failures were recorded in the meantime (then only the counter is decremented).
+// After a successful authentication, keys resetting on success are reset instead.
+func (l lockout) release(ctx context.Context, attempts []lockoutAttempt, success bool) error {
+	var errs []error
+
+	for _, attempt := range attempts {
+		_, err := l.store.UpdateFailures(ctx, attempt.key.key, func(record FailureRecord) FailureRecord {
+			if success && attempt.key.resetOnSuccess {
+				return FailureRecord{}
+			}
+
+			if record == attempt.recorded {
+				return attempt.previous
+			}
+
+			if record.Count > 0 {
+				record.Count--
+			}
+
+			return record
+		})
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// InMemoryFailureStore is a [FailureStore] keeping records in memory.
+type InMemoryFailureStore struct {
+	mu      sync.Mutex
+	records map[string]FailureRecord
+}
+
+// NewInMemoryFailureStore returns a new [InMemoryFailureStore].
+func NewInMemoryFailureStore() *InMemoryFailureStore {
+	return &InMemoryFailureStore{
+		records: make(map[string]FailureRecord),
+	}
+}
+
+// UpdateFailures implements [FailureStore].
+func (s *InMemoryFailureStore) UpdateFailures(_ context.Context, key string, update func(FailureRecord) FailureRecord) (FailureRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record := update(s.records[key])
+
+	if record == (FailureRecord{}) {
+		delete(s.records, key)
+	} else {
+		s.records[key] = record
+	}
+
+	return record, nil
+}
+
+// Prune removes records whose last failure happened more than maxAge before now.
+// Call it periodically to keep memory usage bounded.
+func (s *InMemoryFailureStore) Prune(now time.Time, maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, record := range s.records {
+		if now.Sub(record.LastFailure) > maxAge {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+func TestLockoutAuthenticator(t *testing.T) {
+	config := LockoutConfig{
+		Username: LockoutPolicy{
+			FreeAttempts: 2,
+			BaseDelay:    time.Second,
+			MaxDelay:     4 * time.Second,
+			ResetAfter:   time.Hour,
+		},
+		ClientIP: LockoutPolicy{
+			FreeAttempts: 5,
+			BaseDelay:    time.Minute,
+		},
+	}
+
+	newAuthenticator := func(inner auth.PasswordAuthenticator) (LockoutAuthenticator, *clockwork.FakeClock) {
+		clock := clockwork.NewFakeClock()
+
+		config := config
+		config.Clock = clock
+
+		return NewLockoutAuthenticator(inner, NewInMemoryFailureStore(), config), clock
+	}
+
+	ctx := auth.ContextWithClientInfo(context.Background(), auth.ClientInfo{IP: "10.0.0.1"})
+
+	t.Run("OK", func(t *testing.T) {
+		inner := &passwordAuthenticatorStub{subject: User{Username: "user"}}
+		authenticator, _ := newAuthenticator(inner)
+
+		subject, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectIDFromString("user"), subject.ID())
+	})
+
+	t.Run("ExponentialDelay", func(t *testing.T) {
+		inner := &passwordAuthenticatorStub{err: auth.ErrAuthenticationFailed}
+		authenticator, clock := newAuthenticator(inner)
+
+		// Free attempts
+		for i := 0; i < 2; i++ {
+			_, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+			require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		}
+
+		expectedDelays := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+
+		for _, expectedDelay := range expectedDelays {
+			_, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+			require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+			calls := inner.calls
+
+			_, err = authenticator.AuthenticatePassword(ctx, "user", "password")
+			require.ErrorIs(t, err, auth.ErrTooManyAttempts)
+
+			var tooManyAttemptsErr auth.TooManyAttemptsError
+			require.True(t, errors.As(err, &tooManyAttemptsErr))
+
+			assert.Equal(t, expectedDelay, tooManyAttemptsErr.RetryAfter)
+			assert.Equal(t, calls, inner.calls, "locked attempts must not reach the authenticator")
+
+			clock.Advance(expectedDelay)
+		}
+	})
+
+	t.Run("ResetOnSuccess", func(t *testing.T) {
+		inner := &passwordAuthenticatorStub{err: auth.ErrAuthenticationFailed}
+		authenticator, clock := newAuthenticator(inner)
+
+		for i := 0; i < 3; i++ {
+			_, _ = authenticator.AuthenticatePassword(ctx, "user", "password")
+		}
+
+		clock.Advance(time.Second)
+
+		inner.err = nil
+		inner.subject = User{Username: "user"}
+
+		_, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+		require.NoError(t, err)
+
+		inner.err = auth.ErrAuthenticationFailed
+
+		_, err = authenticator.AuthenticatePassword(ctx, "user", "password")
+		assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("ResetAfter", func(t *testing.T) {
+		inner := &passwordAuthenticatorStub{err: auth.ErrAuthenticationFailed}
+		authenticator, clock := newAuthenticator(inner)
+
+		for i := 0; i < 3; i++ {
+			_, _ = authenticator.AuthenticatePassword(ctx, "user", "password")
+		}
+
+		clock.Advance(2 * time.Hour)
+
+		_, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+		assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+		// Counter restarted: the next failure is still free
+		_, err = authenticator.AuthenticatePassword(ctx, "user", "password")
+		assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("ClientIP", func(t *testing.T) {
+		inner := &passwordAuthenticatorStub{err: auth.ErrAuthenticationFailed}
+		authenticator, _ := newAuthenticator(inner)
+
+		// Spray different usernames from the same IP
+		for i := 0; i < 6; i++ {
+			_, err := authenticator.AuthenticatePassword(ctx, string(rune('a'+i)), "password")
+			require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		}
+
+		_, err := authenticator.AuthenticatePassword(ctx, "other", "password")
+		assert.ErrorIs(t, err, auth.ErrTooManyAttempts)
+
+		// Other clients are not affected
+		otherCtx := auth.ContextWithClientInfo(context.Background(), auth.ClientInfo{IP: "10.0.0.2"})
+
+		_, err = authenticator.AuthenticatePassword(otherCtx, "other", "password")
+		assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		inner := &blockingPasswordAuthenticator{
+			release: make(chan struct{}),
+		}
+		authenticator, _ := newAuthenticator(inner)
+
+		const attempts = 10
+
+		errs := make(chan error, attempts)
+
+		for i := 0; i < attempts; i++ {
+			go func() {
+				_, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+				errs <- err
+			}()
+		}
+
+		// Two free attempts and the one triggering the first delay are admitted before any of them fails
+		for i := 0; i < attempts-3; i++ {
+			select {
+			case err := <-errs:
+				require.ErrorIs(t, err, auth.ErrTooManyAttempts)
+			case <-time.After(5 * time.Second):
+				t.Fatal("too many attempts reached the authenticator")
+			}
+		}
+
+		close(inner.release)
+
+		for i := 0; i < 3; i++ {
+			require.ErrorIs(t, <-errs, auth.ErrAuthenticationFailed)
+		}
+
+		assert.Equal(t, int32(3), inner.calls.Load())
+	})
+
+	t.Run("Infrastructure", func(t *testing.T) {
+		infraErr := errors.New("connection refused")
+		inner := &passwordAuthenticatorStub{err: infraErr}
+		authenticator, _ := newAuthenticator(inner)
+
+		for i := 0; i < 5; i++ {
+			_, err := authenticator.AuthenticatePassword(ctx, "user", "password")
+			require.ErrorIs(t, err, infraErr)
+		}
+	})
+}
+
+// blockingPasswordAuthenticator fails every attempt once released.
+type blockingPasswordAuthenticator struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (a *blockingPasswordAuthenticator) AuthenticatePassword(_ context.Context, _ string, _ string) (auth.Subject, error) {
+	a.calls.Add(1)
+
+	<-a.release
+
+	return nil, auth.ErrAuthenticationFailed
+}
@@ -0,0 +1,325 @@
+// Package oidc authenticates workloads (eg. CI jobs) presenting an OIDC ID token as their password.
+//
+// Most CI systems (GitHub Actions, GitLab CI, Kubernetes projected service account tokens, etc.)
+// can issue signed JWTs describing the running workload.
+// Those tokens can be used to log in to a registry (eg. docker login -u oidc -p $TOKEN) instead of long-lived secrets.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// Provider describes a trusted token issuer.
+type Provider struct {
+	// Name is used to qualify subject IDs authenticated by this provider (eg. "github").
+	Name string
+
+	// Issuer is the expected value of the "iss" claim (eg. "https://token.actions.githubusercontent.com").
+	Issuer string
+
+	// Audiences lists accepted "aud" values. The token must contain at least one of them.
+	Audiences []string
+
+	// JWKS is a JSON Web Key Set document containing the public keys of the issuer.
+	JWKS []byte
+
+	// Username, if not empty, restricts the username that has to accompany the token.
+	// Otherwise, the username is ignored.
+	Username string
+
+	// SubjectClaim is the claim used as the subject ID (within the provider).
+	//
+	// Defaults to "sub".
+	SubjectClaim string
+
+	// Claims lists claim matching rules: every listed claim MUST match at least one of the patterns.
+	//
+	// Patterns follow the syntax of [path.Match] (eg. "refs/heads/*").
+	// Non-string claim values are formatted using [fmt.Sprint] before matching.
+	//
+	// Nested claims can be referenced using slashes (eg. "kubernetes.io/namespace").
+	Claims map[string][]string
+
+	// Attributes maps token claims (referenced the same way as in Claims) to [auth.Subject] attributes.
+	Attributes map[string]string
+}
+
+var validMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+type provider struct {
+	Provider
+
+	keys jose.JSONWebKeySet
+}
+
+// Authenticator authenticates OIDC ID tokens presented as passwords.
+//
+// Tokens are verified against locally supplied key sets: no network requests are made during authentication.
+type Authenticator struct {
+	providers map[string]provider
+}
+
+// NewAuthenticator returns a new [Authenticator].
+//
+// It returns an error if a provider is misconfigured (eg. the key set is invalid or multiple providers share an issuer).
+func NewAuthenticator(providers []Provider) (Authenticator, error) {
+	a := Authenticator{
+		providers: make(map[string]provider, len(providers)),
+	}
+
+	for _, p := range providers {
+		if p.Name == "" {
+			return Authenticator{}, errors.New("oidc: provider name is required")
+		}
+
+		if p.Issuer == "" {
+			return Authenticator{}, fmt.Errorf("oidc: provider %q: issuer is required", p.Name)
+		}
+
+		if len(p.Audiences) == 0 {
+			return Authenticator{}, fmt.Errorf("oidc: provider %q: at least one audience is required", p.Name)
+		}
+
+		if _, ok := a.providers[p.Issuer]; ok {
+			return Authenticator{}, fmt.Errorf("oidc: provider %q: duplicate issuer %q", p.Name, p.Issuer)
+		}
+
+		for claim, patterns := range p.Claims {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return Authenticator{}, fmt.Errorf("oidc: provider %q: invalid pattern for claim %q: %w", p.Name, claim, err)
+				}
+			}
+		}
+
+		var keys jose.JSONWebKeySet
+
+		if err := json.Unmarshal(p.JWKS, &keys); err != nil {
+			return Authenticator{}, fmt.Errorf("oidc: provider %q: parsing key set: %w", p.Name, err)
+		}
+
+		if p.SubjectClaim == "" {
+			p.SubjectClaim = "sub"
+		}
+
+		a.providers[p.Issuer] = provider{
+			Provider: p,
+			keys:     keys,
+		}
+	}
+
+	return a, nil
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+//
+// The password is expected to be a JWT issued by one of the configured providers.
+func (a Authenticator) AuthenticatePassword(_ context.Context, username string, password string) (auth.Subject, error) {
+	// Look up the issuer before verifying the signature to find the right key set
+	var unverifiedClaims jwt.MapClaims
+
+	_, _, err := jwt.NewParser().ParseUnverified(password, &unverifiedClaims)
+	if err != nil {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	issuer, err := unverifiedClaims.GetIssuer()
+	if err != nil {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	p, ok := a.providers[issuer]
+	if !ok {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	if p.Username != "" && p.Username != username {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	var claims jwt.MapClaims
+
+	_, err = jwt.ParseWithClaims(
+		password,
+		&claims,
+		p.keyFunc,
+		jwt.WithValidMethods(validMethods),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(5*time.Second),
+	)
+	if err != nil {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	if !p.matchAudience(claims) || !p.matchClaims(claims) {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	v, _ := lookupClaim(claims, p.SubjectClaim)
+
+	sub, ok := v.(string)
+	if !ok || sub == "" {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	attrs := make(map[string]any, len(p.Attributes))
+
+	for claim, attr := range p.Attributes {
+		if v, ok := lookupClaim(claims, claim); ok {
+			attrs[attr] = v
+		}
+	}
+
+	return Subject{
+		Provider: p.Name,
+		Subject:  sub,
+		Attrs:    attrs,
+	}, nil
+}
+
+// keyFunc returns every usable key of the provider matching the key ID of the token (if any):
+// tokens without a key ID are accepted if any of them verifies the signature.
+func (p provider) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var keys []jose.JSONWebKey
+
+	if kid != "" {
+		keys = p.keys.Key(kid)
+	} else {
+		keys = p.keys.Keys
+	}
+
+	var keySet jwt.VerificationKeySet
+
+	for _, key := range keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		if key.Algorithm != "" && key.Algorithm != token.Method.Alg() {
+			continue
+		}
+
+		keySet.Keys = append(keySet.Keys, key.Key)
+	}
+
+	if len(keySet.Keys) == 0 {
+		return nil, errors.New("no matching key found")
+	}
+
+	return keySet, nil
+}
+
+func (p provider) matchAudience(claims jwt.MapClaims) bool {
+	audiences, err := claims.GetAudience()
+	if err != nil {
+		return false
+	}
+
+	for _, aud := range audiences {
+		for _, expected := range p.Audiences {
+			if aud == expected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p provider) matchClaims(claims jwt.MapClaims) bool {
+	for claim, patterns := range p.Claims {
+		v, ok := lookupClaim(claims, claim)
+		if !ok {
+			return false
+		}
+
+		if !matchAny(patterns, fmt.Sprint(v)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lookupClaim finds a claim by name.
+// If there is no claim with the exact name, slashes are treated as separators for nested claims.
+func lookupClaim(claims map[string]any, name string) (any, bool) {
+	if v, ok := claims[name]; ok {
+		return v, true
+	}
+
+	parent, child, ok := strings.Cut(name, "/")
+	if !ok {
+		return nil, false
+	}
+
+	nested, ok := claims[parent].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+
+	return lookupClaim(nested, child)
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subject is an [auth.Subject] authenticated by an OIDC provider.
+type Subject struct {
+	Provider string
+	Subject  string
+	Attrs    map[string]any
+}
+
+// ID implements [auth.Subject].
+//
+// The ID is qualified by the provider name (eg. "github:repo:org/repo:ref:refs/heads/main")
+// to avoid collisions between providers.
+func (s Subject) ID() auth.SubjectID {
+	return auth.SubjectIDFromString(s.Provider + ":" + s.Subject)
+}
+
+// Attribute implements [auth.Subject].
+func (s Subject) Attribute(key string) (any, bool) {
+	if s.Attrs == nil {
+		return nil, false
+	}
+
+	v, ok := s.Attrs[key]
+
+	return v, ok
+}
+
+// Attributes implements [auth.Subject].
+func (s Subject) Attributes() map[string]any {
+	return maps.Clone(s.Attrs)
+}
+
+// Transient implements [auth.TransientSubject].
+//
+// Subjects only exist for as long as the identity token they were authenticated with, so they never receive refresh tokens.
+func (s Subject) Transient() bool {
+	return true
+}
@@ -0,0 +1,291 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+const (
+	issuer   = "https://token.actions.githubusercontent.com"
+	audience = "registry.example.com"
+	keyID    = "key"
+)
+
+func newKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{
+				Key:       &key.PublicKey,
+				KeyID:     keyID,
+				Algorithm: "RS256",
+				Use:       "sig",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	return key, jwks
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+
+	signedToken, err := token.SignedString(key)
+	require.NoError(t, err)
+
+	return signedToken
+}
+
+func TestAuthenticator(t *testing.T) {
+	key, jwks := newKey(t)
+
+	authenticator, err := NewAuthenticator([]Provider{
+		{
+			Name:      "github",
+			Issuer:    issuer,
+			Audiences: []string{audience},
+			JWKS:      jwks,
+			Claims: map[string][]string{
+				"repository": {"org/*"},
+				"ref":        {"refs/heads/main", "refs/tags/*"},
+			},
+			Attributes: map[string]string{
+				"repository": "repository",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	validClaims := func() jwt.MapClaims {
+		now := time.Now()
+
+		return jwt.MapClaims{
+			"iss":        issuer,
+			"aud":        audience,
+			"sub":        "repo:org/repo:ref:refs/heads/main",
+			"iat":        now.Unix(),
+			"exp":        now.Add(5 * time.Minute).Unix(),
+			"repository": "org/repo",
+			"ref":        "refs/heads/main",
+		}
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		token := signToken(t, key, validClaims())
+
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "oidc", token)
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.SubjectIDFromString("github:repo:org/repo:ref:refs/heads/main"), subject.ID())
+
+		repository, ok := subject.Attribute("repository")
+		assert.True(t, ok)
+		assert.Equal(t, "org/repo", repository)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		otherKey, _ := newKey(t)
+
+		testCases := map[string]struct {
+			key    *rsa.PrivateKey
+			claims func(claims jwt.MapClaims)
+		}{
+			"InvalidSignature": {
+				key: otherKey,
+			},
+			"UnknownIssuer": {
+				claims: func(claims jwt.MapClaims) { claims["iss"] = "https://gitlab.example.com" },
+			},
+			"AudienceMismatch": {
+				claims: func(claims jwt.MapClaims) { claims["aud"] = "other.example.com" },
+			},
+			"Expired": {
+				claims: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			},
+			"MissingExpiration": {
+				claims: func(claims jwt.MapClaims) { delete(claims, "exp") },
+			},
+			"ClaimMismatch": {
+				claims: func(claims jwt.MapClaims) { claims["repository"] = "other/repo" },
+			},
+			"MissingClaim": {
+				claims: func(claims jwt.MapClaims) { delete(claims, "ref") },
+			},
+			"MissingSubject": {
+				claims: func(claims jwt.MapClaims) { delete(claims, "sub") },
+			},
+		}
+
+		for name, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(name, func(t *testing.T) {
+				claims := validClaims()
+				if testCase.claims != nil {
+					testCase.claims(claims)
+				}
+
+				signingKey := key
+				if testCase.key != nil {
+					signingKey = testCase.key
+				}
+
+				token := signToken(t, signingKey, claims)
+
+				_, err := authenticator.AuthenticatePassword(context.Background(), "oidc", token)
+				require.Error(t, err)
+
+				assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+			})
+		}
+
+		t.Run("NotAToken", func(t *testing.T) {
+			_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+	})
+}
+
+func TestAuthenticator_NoKeyID(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// Keys are rotated: the token is signed with the second key
+	jwks, err := json.Marshal(jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{
+			{Key: &oldKey.PublicKey, KeyID: "old", Algorithm: "RS256", Use: "sig"},
+			{Key: &key.PublicKey, KeyID: "new", Algorithm: "RS256", Use: "sig"},
+		},
+	})
+	require.NoError(t, err)
+
+	authenticator, err := NewAuthenticator([]Provider{
+		{
+			Name:      "github",
+			Issuer:    issuer,
+			Audiences: []string{audience},
+			JWKS:      jwks,
+		},
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": issuer,
+		"aud": audience,
+		"sub": "repo:org/repo:ref:refs/heads/main",
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}).SignedString(key)
+	require.NoError(t, err)
+
+	subject, err := authenticator.AuthenticatePassword(context.Background(), "oidc", token)
+	require.NoError(t, err)
+
+	assert.Equal(t, auth.SubjectIDFromString("github:repo:org/repo:ref:refs/heads/main"), subject.ID())
+}
+
+func TestAuthenticator_NestedClaims(t *testing.T) {
+	key, jwks := newKey(t)
+
+	authenticator, err := NewAuthenticator([]Provider{
+		{
+			Name:         "kubernetes",
+			Issuer:       "https://kubernetes.default.svc.cluster.local",
+			Audiences:    []string{audience},
+			JWKS:         jwks,
+			SubjectClaim: "kubernetes.io/serviceaccount/name",
+			Claims: map[string][]string{
+				"kubernetes.io/namespace": {"ci"},
+			},
+			Attributes: map[string]string{
+				"kubernetes.io/namespace": "namespace",
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	claims := func(namespace string) jwt.MapClaims {
+		now := time.Now()
+
+		return jwt.MapClaims{
+			"iss": "https://kubernetes.default.svc.cluster.local",
+			"aud": []string{audience},
+			"sub": "system:serviceaccount:" + namespace + ":builder",
+			"iat": now.Unix(),
+			"exp": now.Add(5 * time.Minute).Unix(),
+			"kubernetes.io": map[string]any{
+				"namespace": namespace,
+				"serviceaccount": map[string]any{
+					"name": "builder",
+				},
+			},
+		}
+	}
+
+	subject, err := authenticator.AuthenticatePassword(context.Background(), "oidc", signToken(t, key, claims("ci")))
+	require.NoError(t, err)
+
+	assert.Equal(t, auth.SubjectIDFromString("kubernetes:builder"), subject.ID())
+
+	namespace, ok := subject.Attribute("namespace")
+	assert.True(t, ok)
+	assert.Equal(t, "ci", namespace)
+
+	_, err = authenticator.AuthenticatePassword(context.Background(), "oidc", signToken(t, key, claims("default")))
+	require.Error(t, err)
+
+	assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	_, jwks := newKey(t)
+
+	t.Run("InvalidKeySet", func(t *testing.T) {
+		_, err := NewAuthenticator([]Provider{
+			{
+				Name:      "github",
+				Issuer:    issuer,
+				Audiences: []string{audience},
+				JWKS:      []byte("invalid"),
+			},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("DuplicateIssuer", func(t *testing.T) {
+		provider := Provider{
+			Name:      "github",
+			Issuer:    issuer,
+			Audiences: []string{audience},
+			JWKS:      jwks,
+		}
+
+		_, err := NewAuthenticator([]Provider{provider, provider})
+		require.Error(t, err)
+	})
+}
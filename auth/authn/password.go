@@ -0,0 +1,407 @@
+package authn
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Supported password hashing algorithms.
+const (
+	PasswordHashBcrypt       = "bcrypt"
+	PasswordHashArgon2id     = "argon2id"
+	PasswordHashScrypt       = "scrypt"
+	PasswordHashPBKDF2SHA256 = "pbkdf2-sha256"
+	PasswordHashPBKDF2SHA512 = "pbkdf2-sha512"
+)
+
+// Argon2idParams are the parameters of the argon2id algorithm.
+type Argon2idParams struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// ScryptParams are the parameters of the scrypt algorithm.
+type ScryptParams struct {
+	LogN uint8 // N = 2^LogN
+	R    int
+	P    int
+}
+
+// PBKDF2Params are the parameters of the PBKDF2 algorithm.
+type PBKDF2Params struct {
+	Iterations int
+}
+
+// PasswordHasher hashes and verifies passwords.
+//
+// Hashes of the preferred Algorithm are created with the configured parameters and encoded in the [PHC string format]
+// (eg. "$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>").
+// Bcrypt hashes use the standard modular crypt format ("$2a$", "$2b$" or "$2y$").
+//
+// Any supported algorithm can be verified, regardless of the preferred one.
+//
+// [PHC string format]: https://github.com/P-H-C/phc-string-format/blob/master/phc-sf-spec.md
+type PasswordHasher struct {
+	// Algorithm is the preferred algorithm used for new hashes. Defaults to [PasswordHashBcrypt].
+	Algorithm string
+
+	// BcryptCost defaults to [bcrypt.DefaultCost].
+	BcryptCost int
+
+	// Argon2id defaults to m=65536 (64 MiB), t=3, p=4.
+	Argon2id Argon2idParams
+
+	// Scrypt defaults to ln=15, r=8, p=1.
+	Scrypt ScryptParams
+
+	// PBKDF2 defaults to 600000 iterations for SHA-256 and 210000 for SHA-512.
+	PBKDF2 PBKDF2Params
+}
+
+// DefaultPasswordHasher hashes passwords using bcrypt with the default cost.
+var DefaultPasswordHasher = PasswordHasher{}
+
+const (
+	saltLength = 16
+	keyLength  = 32
+)
+
+var phcEncoding = base64.RawStdEncoding
+
+func (h PasswordHasher) withDefaults() PasswordHasher {
+	if h.Algorithm == "" {
+		h.Algorithm = PasswordHashBcrypt
+	}
+
+	if h.BcryptCost == 0 {
+		h.BcryptCost = bcrypt.DefaultCost
+	}
+
+	if h.Argon2id == (Argon2idParams{}) {
+		h.Argon2id = Argon2idParams{Memory: 64 * 1024, Iterations: 3, Parallelism: 4}
+	}
+
+	if h.Scrypt == (ScryptParams{}) {
+		h.Scrypt = ScryptParams{LogN: 15, R: 8, P: 1}
+	}
+
+	if h.PBKDF2 == (PBKDF2Params{}) {
+		switch h.Algorithm {
+		case PasswordHashPBKDF2SHA512:
+			h.PBKDF2 = PBKDF2Params{Iterations: 210000}
+
+		default:
+			h.PBKDF2 = PBKDF2Params{Iterations: 600000}
+		}
+	}
+
+	return h
+}
+
+// Hash hashes a password with the preferred algorithm.
+func (h PasswordHasher) Hash(password string) (string, error) {
+	h = h.withDefaults()
+
+	if h.Algorithm == PasswordHashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+
+		return string(hash), nil
+	}
+
+	salt := make([]byte, saltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	var params phcHash
+
+	switch h.Algorithm {
+	case PasswordHashArgon2id:
+		params = phcHash{
+			id:      PasswordHashArgon2id,
+			version: argon2.Version,
+			params:  argon2idParamsString(h.Argon2id),
+		}
+
+	case PasswordHashScrypt:
+		params = phcHash{
+			id:     PasswordHashScrypt,
+			params: scryptParamsString(h.Scrypt),
+		}
+
+	case PasswordHashPBKDF2SHA256, PasswordHashPBKDF2SHA512:
+		params = phcHash{
+			id:     h.Algorithm,
+			params: "i=" + strconv.Itoa(h.PBKDF2.Iterations),
+		}
+
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm: %s", h.Algorithm)
+	}
+
+	params.salt = salt
+
+	key, err := params.derive(password, keyLength)
+	if err != nil {
+		return "", err
+	}
+
+	params.hash = key
+
+	return params.String(), nil
+}
+
+// Verify compares a password with a hash.
+//
+// It returns whether the password matches and whether the hash should be replaced by a new one
+// (because it uses a different algorithm or weaker parameters than the preferred ones).
+// Hashes with stronger parameters than the preferred ones are kept.
+// Unsupported or malformed hashes never match.
+func (h PasswordHasher) Verify(hash string, password string) (ok bool, needsRehash bool) {
+	h = h.withDefaults()
+
+	if isBcryptHash(hash) {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false, false
+		}
+
+		cost, err := bcrypt.Cost([]byte(hash))
+
+		return true, h.Algorithm != PasswordHashBcrypt || err != nil || cost < h.BcryptCost
+	}
+
+	parsed, err := parsePHCHash(hash)
+	if err != nil {
+		return false, false
+	}
+
+	key, err := parsed.derive(password, len(parsed.hash))
+	if err != nil || subtle.ConstantTimeCompare(key, parsed.hash) != 1 {
+		return false, false
+	}
+
+	return true, parsed.id != h.Algorithm || h.weakerParams(parsed)
+}
+
+// weakerParams checks if any parameter of a hash is lower than the preferred one.
+func (h PasswordHasher) weakerParams(hash phcHash) bool {
+	params, err := hash.paramMap()
+	if err != nil {
+		return true
+	}
+
+	preferred, err := phcHash{params: h.preferredParams(hash.id)}.paramMap()
+	if err != nil {
+		return true
+	}
+
+	for key, value := range preferred {
+		if params[key] < value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VerifyDummy burns the same amount of work as verifying a hash of the preferred algorithm.
+//
+// Call it when a user does not exist (or is disabled) to avoid leaking that information through response times.
+func (h PasswordHasher) VerifyDummy(password string) {
+	_, _ = h.Hash(password)
+}
+
+func (h PasswordHasher) preferredParams(id string) string {
+	switch id {
+	case PasswordHashArgon2id:
+		return argon2idParamsString(h.Argon2id)
+
+	case PasswordHashScrypt:
+		return scryptParamsString(h.Scrypt)
+
+	case PasswordHashPBKDF2SHA256, PasswordHashPBKDF2SHA512:
+		return "i=" + strconv.Itoa(h.PBKDF2.Iterations)
+	}
+
+	return ""
+}
+
+func argon2idParamsString(p Argon2idParams) string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Iterations, p.Parallelism)
+}
+
+func scryptParamsString(p ScryptParams) string {
+	return fmt.Sprintf("ln=%d,r=%d,p=%d", p.LogN, p.R, p.P)
+}
+
+// phcHash is a hash in the PHC string format: $<id>[$v=<version>][$<params>]$<salt>$<hash>
+type phcHash struct {
+	id      string
+	version int
+	params  string
+	salt    []byte
+	hash    []byte
+}
+
+func (p phcHash) String() string {
+	var b strings.Builder
+
+	b.WriteString("$" + p.id)
+
+	if p.version != 0 {
+		b.WriteString("$v=" + strconv.Itoa(p.version))
+	}
+
+	b.WriteString("$" + p.params)
+	b.WriteString("$" + phcEncoding.EncodeToString(p.salt))
+	b.WriteString("$" + phcEncoding.EncodeToString(p.hash))
+
+	return b.String()
+}
+
+func parsePHCHash(s string) (phcHash, error) {
+	parts := strings.Split(s, "$")
+
+	// Leading empty part, id, (version), params, salt, hash
+	if (len(parts) != 5 && len(parts) != 6) || parts[0] != "" {
+		return phcHash{}, errors.New("malformed hash")
+	}
+
+	p := phcHash{
+		id: parts[1],
+	}
+
+	parts = parts[2:]
+
+	if len(parts) == 4 {
+		version, ok := strings.CutPrefix(parts[0], "v=")
+		if !ok {
+			return phcHash{}, errors.New("malformed hash version")
+		}
+
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return phcHash{}, fmt.Errorf("malformed hash version: %w", err)
+		}
+
+		p.version = v
+		parts = parts[1:]
+	}
+
+	p.params = parts[0]
+
+	var err error
+
+	p.salt, err = phcEncoding.DecodeString(parts[1])
+	if err != nil {
+		return phcHash{}, fmt.Errorf("malformed salt: %w", err)
+	}
+
+	p.hash, err = phcEncoding.DecodeString(parts[2])
+	if err != nil {
+		return phcHash{}, fmt.Errorf("malformed hash: %w", err)
+	}
+
+	if len(p.hash) == 0 {
+		return phcHash{}, errors.New("empty hash")
+	}
+
+	return p, nil
+}
+
+func (p phcHash) paramMap() (map[string]int, error) {
+	params := make(map[string]int)
+
+	for _, param := range strings.Split(p.params, ",") {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed parameter: %s", param)
+		}
+
+		v, err := strconv.Atoi(value)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("malformed parameter: %s", param)
+		}
+
+		params[key] = v
+	}
+
+	return params, nil
+}
+
+// Upper bounds prevent stored hashes from exhausting resources (eg. a hash with m=2^31 would allocate 2 TiB).
+// Every parameter that scales the work or memory of a verification is bounded, including the length of the derived key.
+const (
+	maxArgon2idMemory     = 4 * 1024 * 1024 // 4 GiB
+	maxArgon2idIterations = 64
+	maxScryptLogN         = 24
+	maxScryptMemory       = 4 * 1024 * 1024 * 1024 // 4 GiB (128 * r * N bytes)
+	maxScryptParallelism  = 64
+	maxPBKDF2Iterations   = 10_000_000
+	maxPHCHashKeyLength   = 64
+)
+
+func (p phcHash) derive(password string, keyLength int) ([]byte, error) {
+	if keyLength <= 0 || keyLength > maxPHCHashKeyLength {
+		return nil, errors.New("invalid key length")
+	}
+
+	params, err := p.paramMap()
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.id {
+	case PasswordHashArgon2id:
+		if p.version != argon2.Version {
+			return nil, fmt.Errorf("unsupported argon2 version: %d", p.version)
+		}
+
+		m, t, par := params["m"], params["t"], params["p"]
+		if m == 0 || t == 0 || par == 0 || par > 255 || m > maxArgon2idMemory || t > maxArgon2idIterations {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+
+		return argon2.IDKey([]byte(password), p.salt, uint32(t), uint32(m), uint8(par), uint32(keyLength)), nil
+
+	case PasswordHashScrypt:
+		ln, r, par := params["ln"], params["r"], params["p"]
+		if ln == 0 || r == 0 || par == 0 || ln > maxScryptLogN || par > maxScryptParallelism || r > (maxScryptMemory/128)>>ln {
+			return nil, errors.New("invalid scrypt parameters")
+		}
+
+		return scrypt.Key([]byte(password), p.salt, 1<<ln, r, par, keyLength)
+
+	case PasswordHashPBKDF2SHA256, PasswordHashPBKDF2SHA512:
+		i := params["i"]
+		if i == 0 || i > maxPBKDF2Iterations {
+			return nil, errors.New("invalid pbkdf2 parameters")
+		}
+
+		h := sha256.New
+		if p.id == PasswordHashPBKDF2SHA512 {
+			h = sha512.New
+		}
+
+		return pbkdf2.Key([]byte(password), p.salt, i, keyLength, h), nil
+	}
+
+	return nil, fmt.Errorf("unsupported password hash algorithm: %s", p.id)
+}
@@ -0,0 +1,219 @@
+package authn
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// Cheap parameters to keep tests fast.
+var testPasswordHasher = PasswordHasher{
+	BcryptCost: bcrypt.MinCost,
+	Argon2id:   Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1},
+	Scrypt:     ScryptParams{LogN: 4, R: 8, P: 1},
+	PBKDF2:     PBKDF2Params{Iterations: 10},
+}
+
+func TestPasswordHasher(t *testing.T) {
+	algorithms := []struct {
+		algorithm string
+		prefix    string
+	}{
+		{PasswordHashBcrypt, "$2a$04$"},
+		{PasswordHashArgon2id, "$argon2id$v=19$m=64,t=1,p=1$"},
+		{PasswordHashScrypt, "$scrypt$ln=4,r=8,p=1$"},
+		{PasswordHashPBKDF2SHA256, "$pbkdf2-sha256$i=10$"},
+		{PasswordHashPBKDF2SHA512, "$pbkdf2-sha512$i=10$"},
+	}
+
+	for _, testCase := range algorithms {
+		testCase := testCase
+
+		t.Run(testCase.algorithm, func(t *testing.T) {
+			hasher := testPasswordHasher
+			hasher.Algorithm = testCase.algorithm
+
+			hash, err := hasher.Hash("password")
+			require.NoError(t, err)
+
+			assert.True(t, strings.HasPrefix(hash, testCase.prefix), hash)
+
+			ok, needsRehash := hasher.Verify(hash, "password")
+			assert.True(t, ok)
+			assert.False(t, needsRehash)
+
+			ok, _ = hasher.Verify(hash, "otherPassword")
+			assert.False(t, ok)
+
+			// Any other algorithm verifies the hash, but wants to upgrade it
+			for _, other := range algorithms {
+				if other.algorithm == testCase.algorithm {
+					continue
+				}
+
+				otherHasher := testPasswordHasher
+				otherHasher.Algorithm = other.algorithm
+
+				ok, needsRehash := otherHasher.Verify(hash, "password")
+				assert.True(t, ok)
+				assert.True(t, needsRehash)
+			}
+		})
+	}
+
+	t.Run("OutdatedParameters", func(t *testing.T) {
+		hasher := testPasswordHasher
+		hasher.Algorithm = PasswordHashArgon2id
+
+		hash, err := hasher.Hash("password")
+		require.NoError(t, err)
+
+		hasher.Argon2id.Iterations = 2
+
+		ok, needsRehash := hasher.Verify(hash, "password")
+		assert.True(t, ok)
+		assert.True(t, needsRehash)
+
+		bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+		require.NoError(t, err)
+
+		bcryptHasher := testPasswordHasher
+		bcryptHasher.BcryptCost = bcrypt.MinCost + 1
+
+		ok, needsRehash = bcryptHasher.Verify(string(bcryptHash), "password")
+		assert.True(t, ok)
+		assert.True(t, needsRehash)
+	})
+
+	t.Run("StrongerParameters", func(t *testing.T) {
+		hasher := testPasswordHasher
+		hasher.Algorithm = PasswordHashArgon2id
+		hasher.Argon2id.Memory = 128
+
+		hash, err := hasher.Hash("password")
+		require.NoError(t, err)
+
+		hasher.Argon2id.Memory = 64
+
+		ok, needsRehash := hasher.Verify(hash, "password")
+		assert.True(t, ok)
+		assert.False(t, needsRehash)
+
+		bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost+1)
+		require.NoError(t, err)
+
+		ok, needsRehash = testPasswordHasher.Verify(string(bcryptHash), "password")
+		assert.True(t, ok)
+		assert.False(t, needsRehash)
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		hashes := []string{
+			"",
+			"password",
+			"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+			"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$aGFzaA",
+			"$argon2id$v=19$m=99999999,t=1,p=1$c2FsdA$aGFzaA",
+			"$argon2id$v=19$m=64,t=99999999,p=1$c2FsdA$aGFzaA",
+			"$scrypt$ln=4,r=8$c2FsdA$aGFzaA",
+			"$scrypt$ln=24,r=8,p=1$c2FsdA$aGFzaA",
+			"$scrypt$ln=4,r=8,p=99999999$c2FsdA$aGFzaA",
+			"$pbkdf2-sha256$i=0$c2FsdA$aGFzaA",
+			"$pbkdf2-sha256$i=99999999$c2FsdA$aGFzaA",
+			"$pbkdf2-sha256$i=10$c2FsdA$aGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGhoaGg",
+			"$pbkdf2-sha256$i=10$c2FsdA$",
+			"$md5$i=10$c2FsdA$aGFzaA",
+		}
+
+		for _, hash := range hashes {
+			ok, _ := testPasswordHasher.Verify(hash, "password")
+			assert.False(t, ok, hash)
+		}
+	})
+}
+
+type passwordHashUpdaterStub struct {
+	hashes map[string]string
+	err    error
+}
+
+func (u *passwordHashUpdaterStub) UpdatePasswordHash(_ context.Context, username string, passwordHash string) error {
+	if u.err != nil {
+		return u.err
+	}
+
+	u.hashes[username] = passwordHash
+
+	return nil
+}
+
+type errorHandlerStub struct {
+	errs []error
+}
+
+func (h *errorHandlerStub) Handle(err error) {
+	h.errs = append(h.errs, err)
+}
+
+func TestUserAuthenticator_Rehash(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := User{
+		Enabled:      true,
+		Username:     "user",
+		PasswordHash: string(passwordHash),
+	}
+
+	hasher := testPasswordHasher
+	hasher.Algorithm = PasswordHashArgon2id
+
+	t.Run("OK", func(t *testing.T) {
+		updater := &passwordHashUpdaterStub{hashes: map[string]string{}}
+
+		authenticator := NewUserAuthenticator([]User{user}, WithPasswordHasher(hasher), WithPasswordHashUpdater(updater, nil))
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		require.Contains(t, updater.hashes, "user")
+
+		ok, needsRehash := hasher.Verify(updater.hashes["user"], "password")
+		assert.True(t, ok)
+		assert.False(t, needsRehash)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		updaterErr := errors.New("read-only")
+		errorHandler := &errorHandlerStub{}
+
+		authenticator := NewUserAuthenticator([]User{user}, WithPasswordHasher(hasher), WithPasswordHashUpdater(&passwordHashUpdaterStub{err: updaterErr}, errorHandler))
+
+		// Upgrade failures do not fail the login
+		subject, err := authenticator.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, user.ID(), subject.ID())
+
+		require.Len(t, errorHandler.errs, 1)
+		assert.ErrorIs(t, errorHandler.errs[0], updaterErr)
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		updater := &passwordHashUpdaterStub{hashes: map[string]string{}}
+
+		authenticator := NewUserAuthenticator([]User{user}, WithPasswordHasher(hasher), WithPasswordHashUpdater(updater, nil))
+
+		_, err := authenticator.AuthenticatePassword(context.Background(), "user", "otherPassword")
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+		assert.Empty(t, updater.hashes)
+	})
+}
@@ -0,0 +1,246 @@
+// Package pat implements personal access tokens.
+//
+// Personal access tokens allow users to log in to a registry without using their real password.
+// Every token has a name, an optional expiration and an upper bound of scopes it may be granted
+// (intersected with the scopes granted to the owner of the token).
+//
+// Only a hash of each token is stored: the token itself is only available when it's created.
+package pat
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authn"
+	"github.com/portward/registry-auth/internal/secret"
+)
+
+// Prefix is prepended to every token to make them easy to recognize (eg. by secret scanners).
+const Prefix = "pat_"
+
+// ErrTokenNotFound is returned by a [Store] when a token cannot be found.
+var ErrTokenNotFound = errors.New("personal access token not found")
+
+// Token describes a personal access token.
+type Token struct {
+	ID        string
+	Name      string
+	SubjectID string
+
+	// Hash is the hex encoded SHA-256 hash of the token.
+	Hash string
+
+	// Scopes is the upper bound of scopes the token may be granted.
+	Scopes []auth.Scope
+
+	CreatedAt time.Time
+
+	// ExpiresAt is the time the token expires at. A zero value means the token never expires.
+	ExpiresAt time.Time
+
+	// LastUsedAt is the time the token was last used for authentication (if ever).
+	LastUsedAt time.Time
+}
+
+// Expired returns true if the token is expired at a given time.
+func (t Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// Store persists personal access tokens.
+type Store interface {
+	// CreateToken stores a new token.
+	CreateToken(ctx context.Context, token Token) error
+
+	// GetTokenByHash returns a token by its hash or [ErrTokenNotFound].
+	GetTokenByHash(ctx context.Context, hash string) (Token, error)
+
+	// ListTokens returns every token of a subject.
+	ListTokens(ctx context.Context, subjectID string) ([]Token, error)
+
+	// UpdateLastUsedAt records the last time a token was used.
+	UpdateLastUsedAt(ctx context.Context, id string, lastUsedAt time.Time) error
+
+	// DeleteToken deletes a token of a subject or returns [ErrTokenNotFound].
+	DeleteToken(ctx context.Context, subjectID string, id string) error
+}
+
+// Service manages personal access tokens and authenticates subjects using them.
+type Service struct {
+	store             Store
+	subjectRepository authn.SubjectRepository
+
+	clock clockwork.Clock
+}
+
+// Option configures a [Service].
+type Option interface {
+	apply(s *Service)
+}
+
+// WithClock configures a [Service] to use a Clock.
+func WithClock(clock clockwork.Clock) Option {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock clockwork.Clock
+}
+
+func (w withClock) apply(s *Service) {
+	s.clock = w.clock
+}
+
+// NewService returns a new [Service].
+//
+// subjectRepository is used to look up the owner of a token during authentication,
+// so that tokens of deleted or disabled subjects stop working.
+func NewService(store Store, subjectRepository authn.SubjectRepository, opts ...Option) Service {
+	s := Service{
+		store:             store,
+		subjectRepository: subjectRepository,
+	}
+
+	for _, opt := range opts {
+		opt.apply(&s)
+	}
+
+	if s.clock == nil {
+		s.clock = clockwork.NewRealClock()
+	}
+
+	return s
+}
+
+// CreateTokenRequest describes a new personal access token.
+type CreateTokenRequest struct {
+	SubjectID auth.SubjectID
+	Name      string
+
+	// ExpiresAt is the time the token expires at. A zero value means the token never expires.
+	ExpiresAt time.Time
+
+	// Scopes is the upper bound of scopes the token may be granted.
+	// Resource names may contain wildcards (see [auth.IntersectScopes]).
+	Scopes []auth.Scope
+}
+
+// CreateToken mints a new personal access token.
+//
+// The returned secret is the token itself: it is not stored anywhere, so it must be passed on to the user.
+func (s Service) CreateToken(ctx context.Context, r CreateTokenRequest) (string, Token, error) {
+	if r.SubjectID == nil || r.SubjectID.String() == "" {
+		return "", Token{}, errors.New("subject ID is required")
+	}
+
+	if r.Name == "" {
+		return "", Token{}, errors.New("name is required")
+	}
+
+	if len(r.Scopes) == 0 {
+		return "", Token{}, errors.New("at least one scope is required")
+	}
+
+	now := s.clock.Now()
+
+	if !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(now) {
+		return "", Token{}, errors.New("expiration must be in the future")
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	tokenSecret, err := secret.New(Prefix)
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	token := Token{
+		ID:        id.String(),
+		Name:      r.Name,
+		SubjectID: r.SubjectID.String(),
+		Hash:      secret.Hash(tokenSecret),
+		Scopes:    slices.Clone(r.Scopes),
+		CreatedAt: now,
+		ExpiresAt: r.ExpiresAt,
+	}
+
+	if err := s.store.CreateToken(ctx, token); err != nil {
+		return "", Token{}, err
+	}
+
+	return tokenSecret, token, nil
+}
+
+// ListTokens returns every token of a subject.
+func (s Service) ListTokens(ctx context.Context, subjectID auth.SubjectID) ([]Token, error) {
+	return s.store.ListTokens(ctx, subjectID.String())
+}
+
+// RevokeToken revokes a token of a subject.
+func (s Service) RevokeToken(ctx context.Context, subjectID auth.SubjectID, id string) error {
+	return s.store.DeleteToken(ctx, subjectID.String(), id)
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+//
+// The username must match the ID of the subject the token belongs to.
+// The returned subject implements [auth.BoundedSubject],
+// so no refresh token is issued for it: clients have to present the token again.
+func (s Service) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	if !strings.HasPrefix(password, Prefix) {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	token, err := s.store.GetTokenByHash(ctx, secret.Hash(password))
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+
+	if token.SubjectID != username || token.Expired(now) {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	subject, err := s.subjectRepository.GetSubjectByID(ctx, auth.SubjectIDFromString(token.SubjectID))
+	if err != nil {
+		return nil, err
+	}
+
+	// The token may have been revoked concurrently
+	err = s.store.UpdateLastUsedAt(ctx, token.ID, now)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, err
+	}
+
+	return Subject{
+		Subject: subject,
+		Token:   token,
+	}, nil
+}
+
+// Subject is an [auth.Subject] authenticated with a personal access token.
+type Subject struct {
+	auth.Subject
+
+	Token Token
+}
+
+// ScopeBounds implements [auth.BoundedSubject].
+func (s Subject) ScopeBounds() []auth.Scope {
+	return s.Token.Scopes
+}
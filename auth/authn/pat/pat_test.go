@@ -0,0 +1,181 @@
+package pat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authn"
+)
+
+// revokingStore revokes tokens right after they are looked up (as if they were revoked concurrently).
+type revokingStore struct {
+	*InMemoryStore
+}
+
+func (s revokingStore) GetTokenByHash(ctx context.Context, hash string) (Token, error) {
+	token, err := s.InMemoryStore.GetTokenByHash(ctx, hash)
+	if err != nil {
+		return Token{}, err
+	}
+
+	return token, s.DeleteToken(ctx, token.SubjectID, token.ID)
+}
+
+func TestService(t *testing.T) {
+	user := authn.User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "user/*",
+			},
+			Actions: []string{"pull"},
+		},
+	}
+
+	newService := func() (Service, *clockwork.FakeClock) {
+		clock := clockwork.NewFakeClockAt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		return NewService(NewInMemoryStore(), authn.NewUserAuthenticator([]authn.User{user}), WithClock(clock)), clock
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		service, clock := newService()
+
+		secret, token, err := service.CreateToken(context.Background(), CreateTokenRequest{
+			SubjectID: user.ID(),
+			Name:      "laptop",
+			ExpiresAt: clock.Now().Add(24 * time.Hour),
+			Scopes:    scopes,
+		})
+		require.NoError(t, err)
+
+		assert.NotContains(t, token.Hash, secret)
+
+		clock.Advance(time.Hour)
+
+		subject, err := service.AuthenticatePassword(context.Background(), "user", secret)
+		require.NoError(t, err)
+
+		assert.Equal(t, user.ID(), subject.ID())
+
+		boundedSubject, ok := subject.(auth.BoundedSubject)
+		require.True(t, ok)
+
+		assert.Equal(t, scopes, boundedSubject.ScopeBounds())
+
+		tokens, err := service.ListTokens(context.Background(), user.ID())
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+
+		assert.Equal(t, "laptop", tokens[0].Name)
+		assert.Equal(t, clock.Now(), tokens[0].LastUsedAt)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("Revoked", func(t *testing.T) {
+			service, _ := newService()
+
+			secret, token, err := service.CreateToken(context.Background(), CreateTokenRequest{
+				SubjectID: user.ID(),
+				Name:      "laptop",
+				Scopes:    scopes,
+			})
+			require.NoError(t, err)
+
+			err = service.RevokeToken(context.Background(), user.ID(), token.ID)
+			require.NoError(t, err)
+
+			_, err = service.AuthenticatePassword(context.Background(), "user", secret)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("RevokedConcurrently", func(t *testing.T) {
+			service := NewService(revokingStore{NewInMemoryStore()}, authn.NewUserAuthenticator([]authn.User{user}))
+
+			secret, _, err := service.CreateToken(context.Background(), CreateTokenRequest{
+				SubjectID: user.ID(),
+				Name:      "laptop",
+				Scopes:    scopes,
+			})
+			require.NoError(t, err)
+
+			_, err = service.AuthenticatePassword(context.Background(), "user", secret)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("Expired", func(t *testing.T) {
+			service, clock := newService()
+
+			secret, _, err := service.CreateToken(context.Background(), CreateTokenRequest{
+				SubjectID: user.ID(),
+				Name:      "laptop",
+				ExpiresAt: clock.Now().Add(time.Hour),
+				Scopes:    scopes,
+			})
+			require.NoError(t, err)
+
+			clock.Advance(time.Hour)
+
+			_, err = service.AuthenticatePassword(context.Background(), "user", secret)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("UsernameMismatch", func(t *testing.T) {
+			service, _ := newService()
+
+			secret, _, err := service.CreateToken(context.Background(), CreateTokenRequest{
+				SubjectID: user.ID(),
+				Name:      "laptop",
+				Scopes:    scopes,
+			})
+			require.NoError(t, err)
+
+			_, err = service.AuthenticatePassword(context.Background(), "other", secret)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("UnknownToken", func(t *testing.T) {
+			service, _ := newService()
+
+			_, err := service.AuthenticatePassword(context.Background(), "user", Prefix+"unknown")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("RevokeOtherSubject", func(t *testing.T) {
+			service, _ := newService()
+
+			_, token, err := service.CreateToken(context.Background(), CreateTokenRequest{
+				SubjectID: user.ID(),
+				Name:      "laptop",
+				Scopes:    scopes,
+			})
+			require.NoError(t, err)
+
+			err = service.RevokeToken(context.Background(), auth.SubjectIDFromString("other"), token.ID)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, ErrTokenNotFound)
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package pat
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/portward/registry-auth/internal/secret"
+)
+
+// InMemoryStore is a [Store] keeping tokens in memory.
+//
+// It is primarily useful for testing and single instance deployments: tokens are lost when the process exits.
+type InMemoryStore struct {
+	tokens *secret.Store[Token]
+}
+
+// NewInMemoryStore returns a new [InMemoryStore].
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		tokens: secret.NewStore(
+			func(token Token) string { return token.ID },
+			func(token Token) []string { return []string{token.Hash} },
+		),
+	}
+}
+
+// CreateToken implements [Store].
+func (s *InMemoryStore) CreateToken(_ context.Context, token Token) error {
+	if !s.tokens.Add(token) {
+		return errors.New("personal access token hash collision")
+	}
+
+	return nil
+}
+
+// GetTokenByHash implements [Store].
+func (s *InMemoryStore) GetTokenByHash(_ context.Context, hash string) (Token, error) {
+	token, ok := s.tokens.Lookup(hash)
+	if !ok {
+		return Token{}, ErrTokenNotFound
+	}
+
+	return token, nil
+}
+
+// ListTokens implements [Store].
+func (s *InMemoryStore) ListTokens(_ context.Context, subjectID string) ([]Token, error) {
+	tokens := s.tokens.Filter(func(token Token) bool {
+		return token.SubjectID == subjectID
+	})
+
+	slices.SortFunc(tokens, func(a Token, b Token) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return tokens, nil
+}
+
+// UpdateLastUsedAt implements [Store].
+func (s *InMemoryStore) UpdateLastUsedAt(_ context.Context, id string, lastUsedAt time.Time) error {
+	ok := s.tokens.Update(id, func(token *Token) bool {
+		token.LastUsedAt = lastUsedAt
+
+		return true
+	})
+	if !ok {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
+
+// DeleteToken implements [Store].
+func (s *InMemoryStore) DeleteToken(_ context.Context, subjectID string, id string) error {
+	ok := s.tokens.Delete(id, func(token Token) bool {
+		return token.SubjectID == subjectID
+	})
+	if !ok {
+		return ErrTokenNotFound
+	}
+
+	return nil
+}
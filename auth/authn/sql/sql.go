@@ -0,0 +1,423 @@
+// Package sql stores users in a relational database using [database/sql].
+//
+// The package does not import any database driver: register the one you need (eg. PostgreSQL, MySQL or SQLite)
+// and pass the resulting [*sql.DB] to [NewStore].
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authn"
+)
+
+// ErrUserNotFound is returned when a user does not exist in the store.
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUserExists is returned when trying to create a user that already exists.
+var ErrUserExists = errors.New("user already exists")
+
+// Dialect describes the differences between supported databases.
+type Dialect int
+
+// Supported dialects.
+const (
+	// DialectSQLite uses "?" placeholders.
+	DialectSQLite Dialect = iota
+
+	// DialectPostgres uses "$1" placeholders.
+	DialectPostgres
+
+	// DialectMySQL uses "?" placeholders.
+	//
+	// Enable the clientFoundRows option of the driver: otherwise updates that do not change anything report a missing user.
+	DialectMySQL
+)
+
+// rebind replaces "?" placeholders in a query with the style of the dialect.
+func (d Dialect) rebind(query string) string {
+	if d != DialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+
+	n := 0
+
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+
+			continue
+		}
+
+		n++
+
+		b.WriteString("$")
+		b.WriteString(strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+// migrations are applied in order. Never change an existing migration: append a new one instead.
+var migrations = []string{
+	`CREATE TABLE registry_auth_users (
+		username VARCHAR(255) NOT NULL PRIMARY KEY,
+		password_hash VARCHAR(255) NOT NULL,
+		enabled BOOLEAN NOT NULL,
+		attributes TEXT NOT NULL
+	)`,
+}
+
+// Store is a user store backed by a SQL database.
+//
+// It implements [auth.PasswordAuthenticator] and [authn.SubjectRepository].
+// Authenticated subjects are [authn.User] values (with their password hash).
+//
+// Outdated password hashes (see [authn.PasswordHasher]) are transparently upgraded after a successful login.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+
+	hasher       authn.PasswordHasher
+	errorHandler auth.ErrorHandler
+}
+
+// Option configures a [Store].
+type Option interface {
+	apply(s *Store)
+}
+
+// WithPasswordHasher sets the [authn.PasswordHasher] used to verify and upgrade passwords.
+// Defaults to [authn.DefaultPasswordHasher].
+func WithPasswordHasher(hasher authn.PasswordHasher) Option {
+	return withPasswordHasher{hasher}
+}
+
+type withPasswordHasher struct {
+	hasher authn.PasswordHasher
+}
+
+func (w withPasswordHasher) apply(s *Store) {
+	s.hasher = w.hasher
+}
+
+// WithErrorHandler sets an [auth.ErrorHandler] that receives non-fatal errors (eg. failed password hash upgrades).
+func WithErrorHandler(errorHandler auth.ErrorHandler) Option {
+	return withErrorHandler{errorHandler}
+}
+
+type withErrorHandler struct {
+	errorHandler auth.ErrorHandler
+}
+
+func (w withErrorHandler) apply(s *Store) {
+	s.errorHandler = w.errorHandler
+}
+
+// NewStore returns a new [Store].
+//
+// Call [Store.Migrate] before using the store to make sure the schema is up-to-date.
+func NewStore(db *sql.DB, dialect Dialect, opts ...Option) Store {
+	s := Store{
+		db:      db,
+		dialect: dialect,
+		hasher:  authn.DefaultPasswordHasher,
+	}
+
+	for _, opt := range opts {
+		opt.apply(&s)
+	}
+
+	return s
+}
+
+// Migrate creates or upgrades the database schema.
+//
+// It is safe to call Migrate on an up-to-date database.
+func (s Store) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS registry_auth_migrations (version INTEGER NOT NULL PRIMARY KEY)`)
+	if err != nil {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+
+	var version int
+
+	err = s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM registry_auth_migrations`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("reading schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+				return err
+			}
+
+			_, err := tx.ExecContext(ctx, s.dialect.rebind(`INSERT INTO registry_auth_migrations (version) VALUES (?)`), i+1)
+
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("applying migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (s Store) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AuthenticatePassword implements [auth.PasswordAuthenticator].
+func (s Store) AuthenticatePassword(ctx context.Context, username string, password string) (auth.Subject, error) {
+	user, err := s.GetUser(ctx, username)
+	if errors.Is(err, ErrUserNotFound) || (err == nil && !user.Enabled) {
+		// timing attack paranoia
+		s.hasher.VerifyDummy(password)
+
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, err
+	}
+
+	ok, needsRehash := s.hasher.Verify(user.PasswordHash, password)
+	if !ok {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	if needsRehash {
+		passwordHash, err := s.hasher.Hash(password)
+		if err == nil {
+			err = s.UpdatePasswordHash(ctx, username, passwordHash)
+		}
+
+		if err != nil {
+			s.handleError(fmt.Errorf("upgrading password hash of user %q: %w", username, err))
+		} else {
+			user.PasswordHash = passwordHash
+		}
+	}
+
+	return user, nil
+}
+
+func (s Store) handleError(err error) {
+	if s.errorHandler == nil {
+		return
+	}
+
+	s.errorHandler.Handle(err)
+}
+
+// GetSubjectByID implements [authn.SubjectRepository].
+func (s Store) GetSubjectByID(ctx context.Context, id auth.SubjectID) (auth.Subject, error) {
+	user, err := s.GetUser(ctx, id.String())
+	if errors.Is(err, ErrUserNotFound) || (err == nil && !user.Enabled) {
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+const selectUsers = `SELECT username, password_hash, enabled, attributes FROM registry_auth_users`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row scanner) (authn.User, error) {
+	var (
+		user       authn.User
+		attributes string
+	)
+
+	err := row.Scan(&user.Username, &user.PasswordHash, &user.Enabled, &attributes)
+	if err != nil {
+		return authn.User{}, err
+	}
+
+	if err := json.Unmarshal([]byte(attributes), &user.Attrs); err != nil {
+		return authn.User{}, fmt.Errorf("decoding attributes of user %q: %w", user.Username, err)
+	}
+
+	return user, nil
+}
+
+func encodeAttributes(attrs map[string]any) (string, error) {
+	if attrs == nil {
+		return "{}", nil
+	}
+
+	b, err := json.Marshal(attrs)
+	if err != nil {
+		return "", fmt.Errorf("encoding attributes: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// GetUser returns a user (regardless of whether it's enabled or not).
+func (s Store) GetUser(ctx context.Context, username string) (authn.User, error) {
+	row := s.db.QueryRowContext(ctx, s.dialect.rebind(selectUsers+` WHERE username = ?`), username)
+
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authn.User{}, ErrUserNotFound
+	} else if err != nil {
+		return authn.User{}, fmt.Errorf("getting user: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsers returns every user ordered by username.
+func (s Store) ListUsers(ctx context.Context) ([]authn.User, error) {
+	rows, err := s.db.QueryContext(ctx, selectUsers+` ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("listing users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []authn.User
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("listing users: %w", err)
+		}
+
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("listing users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CreateUser stores a new user.
+//
+// PasswordHash must be a hash supported by [authn.PasswordHasher].
+func (s Store) CreateUser(ctx context.Context, user authn.User) error {
+	attributes, err := encodeAttributes(user.Attrs)
+	if err != nil {
+		return err
+	}
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+
+		err := tx.QueryRowContext(ctx, s.dialect.rebind(`SELECT 1 FROM registry_auth_users WHERE username = ?`), user.Username).Scan(&exists)
+		if err == nil {
+			return ErrUserExists
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("creating user: %w", err)
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			s.dialect.rebind(`INSERT INTO registry_auth_users (username, password_hash, enabled, attributes) VALUES (?, ?, ?, ?)`),
+			user.Username, user.PasswordHash, user.Enabled, attributes,
+		)
+		if err != nil {
+			return fmt.Errorf("creating user: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// UpdateUser replaces the password hash, state and attributes of an existing user.
+func (s Store) UpdateUser(ctx context.Context, user authn.User) error {
+	attributes, err := encodeAttributes(user.Attrs)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(
+		ctx,
+		s.dialect.rebind(`UPDATE registry_auth_users SET password_hash = ?, enabled = ?, attributes = ? WHERE username = ?`),
+		user.PasswordHash, user.Enabled, attributes, user.Username,
+	)
+	if err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+
+	return checkAffected(result)
+}
+
+// UpdatePasswordHash replaces the password hash of a user.
+//
+// It implements [authn.PasswordHashUpdater].
+func (s Store) UpdatePasswordHash(ctx context.Context, username string, passwordHash string) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		s.dialect.rebind(`UPDATE registry_auth_users SET password_hash = ? WHERE username = ?`),
+		passwordHash, username,
+	)
+	if err != nil {
+		return fmt.Errorf("updating password hash: %w", err)
+	}
+
+	return checkAffected(result)
+}
+
+// SetEnabled enables or disables a user.
+func (s Store) SetEnabled(ctx context.Context, username string, enabled bool) error {
+	result, err := s.db.ExecContext(
+		ctx,
+		s.dialect.rebind(`UPDATE registry_auth_users SET enabled = ? WHERE username = ?`),
+		enabled, username,
+	)
+	if err != nil {
+		return fmt.Errorf("updating user: %w", err)
+	}
+
+	return checkAffected(result)
+}
+
+// DeleteUser removes a user.
+func (s Store) DeleteUser(ctx context.Context, username string) error {
+	result, err := s.db.ExecContext(ctx, s.dialect.rebind(`DELETE FROM registry_auth_users WHERE username = ?`), username)
+	if err != nil {
+		return fmt.Errorf("deleting user: %w", err)
+	}
+
+	return checkAffected(result)
+}
+
+func checkAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
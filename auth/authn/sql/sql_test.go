@@ -0,0 +1,14 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialect_rebind(t *testing.T) {
+	query := `UPDATE t SET a = ?, b = ? WHERE c = ?`
+
+	assert.Equal(t, query, DialectSQLite.rebind(query))
+	assert.Equal(t, `UPDATE t SET a = $1, b = $2 WHERE c = $3`, DialectPostgres.rebind(query))
+}
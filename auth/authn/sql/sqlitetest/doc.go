@@ -0,0 +1,4 @@
+// Package sqlitetest tests the SQL-backed user store against SQLite.
+//
+// It is a separate module, so that users of the library do not depend on an SQLite driver.
+package sqlitetest
@@ -0,0 +1,193 @@
+package sqlitetest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	_ "modernc.org/sqlite"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authn"
+	authnsql "github.com/portward/registry-auth/auth/authn/sql"
+)
+
+func newStore(t *testing.T, opts ...authnsql.Option) authnsql.Store {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+
+	// Every connection would get its own in-memory database
+	db.SetMaxOpenConns(1)
+
+	t.Cleanup(func() { db.Close() })
+
+	// Match the cost of test hashes to avoid upgrading them
+	opts = append([]authnsql.Option{authnsql.WithPasswordHasher(authn.PasswordHasher{BcryptCost: bcrypt.MinCost})}, opts...)
+
+	store := authnsql.NewStore(db, authnsql.DialectSQLite, opts...)
+
+	err = store.Migrate(context.Background())
+	require.NoError(t, err)
+
+	return store
+}
+
+func TestStore(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user := authn.User{
+		Enabled:      true,
+		Username:     "user",
+		PasswordHash: string(passwordHash),
+		Attrs: map[string]any{
+			"groups": []any{"admins"},
+		},
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		store := newStore(t)
+
+		err := store.CreateUser(context.Background(), user)
+		require.NoError(t, err)
+
+		subject, err := store.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		assert.Equal(t, user, subject)
+
+		subject, err = store.GetSubjectByID(context.Background(), user.ID())
+		require.NoError(t, err)
+
+		assert.Equal(t, user, subject)
+	})
+
+	t.Run("Migrate", func(t *testing.T) {
+		store := newStore(t)
+
+		err := store.Migrate(context.Background())
+		require.NoError(t, err)
+	})
+
+	t.Run("Manage", func(t *testing.T) {
+		store := newStore(t)
+
+		err := store.CreateUser(context.Background(), user)
+		require.NoError(t, err)
+
+		err = store.CreateUser(context.Background(), authn.User{Username: "other"})
+		require.NoError(t, err)
+
+		err = store.CreateUser(context.Background(), user)
+		assert.ErrorIs(t, err, authnsql.ErrUserExists)
+
+		users, err := store.ListUsers(context.Background())
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+
+		assert.Equal(t, "other", users[0].Username)
+		assert.Equal(t, map[string]any{}, users[0].Attrs)
+		assert.Equal(t, user, users[1])
+
+		updated := user
+		updated.Attrs = map[string]any{"team": "platform"}
+
+		err = store.UpdateUser(context.Background(), updated)
+		require.NoError(t, err)
+
+		actual, err := store.GetUser(context.Background(), "user")
+		require.NoError(t, err)
+
+		assert.Equal(t, updated, actual)
+
+		err = store.DeleteUser(context.Background(), "other")
+		require.NoError(t, err)
+
+		_, err = store.GetUser(context.Background(), "other")
+		assert.ErrorIs(t, err, authnsql.ErrUserNotFound)
+
+		err = store.DeleteUser(context.Background(), "other")
+		assert.ErrorIs(t, err, authnsql.ErrUserNotFound)
+
+		err = store.UpdateUser(context.Background(), authn.User{Username: "other"})
+		assert.ErrorIs(t, err, authnsql.ErrUserNotFound)
+	})
+
+	t.Run("Rehash", func(t *testing.T) {
+		hasher := authn.PasswordHasher{
+			Algorithm: authn.PasswordHashArgon2id,
+			Argon2id:  authn.Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1},
+		}
+
+		store := newStore(t, authnsql.WithPasswordHasher(hasher))
+
+		err := store.CreateUser(context.Background(), user)
+		require.NoError(t, err)
+
+		subject, err := store.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+
+		actual, err := store.GetUser(context.Background(), "user")
+		require.NoError(t, err)
+
+		assert.Equal(t, actual, subject)
+		assert.True(t, strings.HasPrefix(actual.PasswordHash, "$argon2id$"), actual.PasswordHash)
+
+		_, err = store.AuthenticatePassword(context.Background(), "user", "password")
+		require.NoError(t, err)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("WrongPassword", func(t *testing.T) {
+			store := newStore(t)
+
+			err := store.CreateUser(context.Background(), user)
+			require.NoError(t, err)
+
+			_, err = store.AuthenticatePassword(context.Background(), "user", "otherPassword")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("UnknownUser", func(t *testing.T) {
+			store := newStore(t)
+
+			_, err := store.AuthenticatePassword(context.Background(), "user", "password")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+			_, err = store.GetSubjectByID(context.Background(), user.ID())
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("Disabled", func(t *testing.T) {
+			store := newStore(t)
+
+			err := store.CreateUser(context.Background(), user)
+			require.NoError(t, err)
+
+			err = store.SetEnabled(context.Background(), "user", false)
+			require.NoError(t, err)
+
+			_, err = store.AuthenticatePassword(context.Background(), "user", "password")
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+			_, err = store.GetSubjectByID(context.Background(), user.ID())
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+	})
+}
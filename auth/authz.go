@@ -14,3 +14,19 @@ var ErrUnauthorized = errors.New("unauthorized")
 type Authorizer interface {
 	Authorize(ctx context.Context, subject Subject, requestedScopes []Scope) ([]Scope, error)
 }
+
+type serviceKey struct{}
+
+// ContextWithService returns a copy of ctx carrying the name of the service access is requested to.
+//
+// The authorization service attaches the service to the context passed to [Authorizer] implementations.
+func ContextWithService(ctx context.Context, service string) context.Context {
+	return context.WithValue(ctx, serviceKey{}, service)
+}
+
+// ServiceFromContext returns the name of the service (if any) carried by ctx.
+func ServiceFromContext(ctx context.Context) (string, bool) {
+	service, ok := ctx.Value(serviceKey{}).(string)
+
+	return service, ok
+}
@@ -0,0 +1,418 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/pkg/fswatch"
+)
+
+// ACL rule effects.
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// DefaultGroupsAttribute is the subject attribute holding the groups of a subject.
+const DefaultGroupsAttribute = "groups"
+
+// ACLPolicy is a list of repository access rules.
+//
+// Policies are usually loaded from a YAML (or JSON) file:
+//
+//	groupsAttribute: groups
+//	rules:
+//	  - repository: "team-a/*"
+//	    groups: ["team-a"]
+//	    actions: ["pull", "push"]
+//	  - repositoryRegexp: "^team-a/.+-prod$"
+//	    groups: ["team-a"]
+//	    actions: ["push"]
+//	    effect: deny
+//	  - repository: "library/*"
+//	    anonymous: true
+//	    actions: ["pull"]
+//
+// Rules are evaluated for every requested action separately:
+// among the rules that match the repository, the subject and the action, the rules with the highest priority decide.
+// If both allow and deny rules have the highest priority, deny wins.
+// Actions without a matching rule are denied.
+type ACLPolicy struct {
+	// GroupsAttribute is the subject attribute holding the groups of a subject. Defaults to [DefaultGroupsAttribute].
+	GroupsAttribute string `yaml:"groupsAttribute" json:"groupsAttribute"`
+
+	Rules []ACLRule `yaml:"rules" json:"rules"`
+}
+
+// ACLRule grants (or denies) actions on repositories to subjects.
+type ACLRule struct {
+	// Repository is a glob pattern following the syntax of [path.Match] (eg. "team/*").
+	Repository string `yaml:"repository" json:"repository"`
+
+	// RepositoryRegexp is a regular expression matched against the repository name (use anchors to match the whole name).
+	// Exactly one of Repository and RepositoryRegexp must be set.
+	RepositoryRegexp string `yaml:"repositoryRegexp" json:"repositoryRegexp"`
+
+	// Subjects lists the subject IDs the rule applies to.
+	Subjects []string `yaml:"subjects" json:"subjects"`
+
+	// Groups lists the groups the rule applies to: subjects must be a member of at least one of them.
+	Groups []string `yaml:"groups" json:"groups"`
+
+	// Attributes lists subject attributes the rule applies to: every attribute must match.
+	// Multi-valued attributes match if any of their values does.
+	Attributes map[string]string `yaml:"attributes" json:"attributes"`
+
+	// Anonymous rules only apply to anonymous subjects (other rules never do).
+	Anonymous bool `yaml:"anonymous" json:"anonymous"`
+
+	// Actions the rule applies to. "*" matches every action.
+	Actions []string `yaml:"actions" json:"actions"`
+
+	// Effect is either [EffectAllow] (default) or [EffectDeny].
+	Effect string `yaml:"effect" json:"effect"`
+
+	// Priority determines the precedence of rules (higher first).
+	Priority int `yaml:"priority" json:"priority"`
+}
+
+// ParseACLPolicy parses and validates a policy in YAML (or JSON) format.
+//
+// Unknown fields are rejected.
+func ParseACLPolicy(r io.Reader) (ACLPolicy, error) {
+	policy, err := decodeACLPolicy(r)
+	if err != nil {
+		return ACLPolicy{}, err
+	}
+
+	if _, err := compileACLPolicy(policy); err != nil {
+		return ACLPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+func decodeACLPolicy(r io.Reader) (ACLPolicy, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	var policy ACLPolicy
+
+	// An empty file is an empty policy
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return ACLPolicy{}, err
+	}
+
+	return policy, nil
+}
+
+type aclPolicy struct {
+	groupsAttribute string
+	rules           []aclRule
+}
+
+type aclRule struct {
+	ACLRule
+
+	index            int
+	repositoryRegexp *regexp.Regexp
+	deny             bool
+}
+
+func compileACLPolicy(policy ACLPolicy) (*aclPolicy, error) {
+	compiled := &aclPolicy{
+		groupsAttribute: policy.GroupsAttribute,
+		rules:           make([]aclRule, 0, len(policy.Rules)),
+	}
+
+	if compiled.groupsAttribute == "" {
+		compiled.groupsAttribute = DefaultGroupsAttribute
+	}
+
+	for i, rule := range policy.Rules {
+		compiledRule, err := compileACLRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+
+		compiledRule.index = i
+
+		compiled.rules = append(compiled.rules, compiledRule)
+	}
+
+	return compiled, nil
+}
+
+func compileACLRule(rule ACLRule) (aclRule, error) {
+	compiled := aclRule{
+		ACLRule: rule,
+	}
+
+	switch {
+	case rule.Repository != "" && rule.RepositoryRegexp != "":
+		return aclRule{}, errors.New("repository and repositoryRegexp are mutually exclusive")
+
+	case rule.Repository != "":
+		if _, err := path.Match(rule.Repository, ""); err != nil {
+			return aclRule{}, fmt.Errorf("invalid repository pattern %q: %w", rule.Repository, err)
+		}
+
+	case rule.RepositoryRegexp != "":
+		re, err := regexp.Compile(rule.RepositoryRegexp)
+		if err != nil {
+			return aclRule{}, fmt.Errorf("invalid repository regexp: %w", err)
+		}
+
+		compiled.repositoryRegexp = re
+
+	default:
+		return aclRule{}, errors.New("repository or repositoryRegexp is required")
+	}
+
+	if len(rule.Actions) == 0 {
+		return aclRule{}, errors.New("at least one action is required")
+	}
+
+	if rule.Anonymous && (len(rule.Subjects) > 0 || len(rule.Groups) > 0 || len(rule.Attributes) > 0) {
+		return aclRule{}, errors.New("anonymous rules cannot match subjects, groups or attributes")
+	}
+
+	switch rule.Effect {
+	case "", EffectAllow:
+	case EffectDeny:
+		compiled.deny = true
+
+	default:
+		return aclRule{}, fmt.Errorf("unknown effect %q", rule.Effect)
+	}
+
+	return compiled, nil
+}
+
+func (r aclRule) matchesRepository(name string) bool {
+	if r.repositoryRegexp != nil {
+		return r.repositoryRegexp.MatchString(name)
+	}
+
+	ok, _ := path.Match(r.Repository, name)
+
+	return ok
+}
+
+func (r aclRule) matchesSubject(subject auth.Subject, groupsAttribute string) bool {
+	if auth.IsAnonymous(subject) {
+		return r.Anonymous
+	}
+
+	if r.Anonymous {
+		return false
+	}
+
+	if len(r.Subjects) > 0 && !slices.Contains(r.Subjects, subject.ID().String()) {
+		return false
+	}
+
+	if len(r.Groups) > 0 && !slices.ContainsFunc(r.Groups, func(group string) bool { return attributeMatches(subject, groupsAttribute, group) }) {
+		return false
+	}
+
+	for key, value := range r.Attributes {
+		if !attributeMatches(subject, key, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r aclRule) matchesAction(action string) bool {
+	return slices.Contains(r.Actions, "*") || slices.Contains(r.Actions, action)
+}
+
+// attributeMatches checks if a (single or multi-valued) subject attribute has a value.
+func attributeMatches(subject auth.Subject, key string, value string) bool {
+	v, ok := subject.Attribute(key)
+	if !ok {
+		return false
+	}
+
+	switch v := v.(type) {
+	case []string:
+		return slices.Contains(v, value)
+
+	case []any:
+		return slices.ContainsFunc(v, func(e any) bool { return fmt.Sprint(e) == value })
+
+	default:
+		return fmt.Sprint(v) == value
+	}
+}
+
+// String describes the rule in explanations.
+func (r aclRule) String() string {
+	effect := EffectAllow
+	if r.deny {
+		effect = EffectDeny
+	}
+
+	repository := r.Repository
+	if r.repositoryRegexp != nil {
+		repository = r.RepositoryRegexp
+	}
+
+	return fmt.Sprintf("rule %d (%s %q)", r.index, effect, repository)
+}
+
+func (p *aclPolicy) explain(name string, subject auth.Subject, requestedActions []string) []auth.ActionExplanation {
+	var rules []aclRule
+
+	for _, rule := range p.rules {
+		if rule.matchesRepository(name) && rule.matchesSubject(subject, p.groupsAttribute) {
+			rules = append(rules, rule)
+		}
+	}
+
+	explanations := make([]auth.ActionExplanation, 0, len(requestedActions))
+
+	for _, action := range requestedActions {
+		var (
+			matched  bool
+			priority int
+			allow    *aclRule
+			deny     *aclRule
+		)
+
+		for _, rule := range rules {
+			rule := rule
+
+			if !rule.matchesAction(action) {
+				continue
+			}
+
+			if !matched || rule.Priority > priority {
+				matched = true
+				priority = rule.Priority
+				allow, deny = nil, nil
+			} else if rule.Priority < priority {
+				continue
+			}
+
+			if rule.deny && deny == nil {
+				deny = &rule
+			} else if !rule.deny && allow == nil {
+				allow = &rule
+			}
+		}
+
+		explanation := auth.ActionExplanation{
+			Action: action,
+		}
+
+		switch {
+		case deny != nil:
+			explanation.Reason = "denied by " + deny.String()
+
+		case allow != nil:
+			explanation.Granted = true
+			explanation.Reason = "allowed by " + allow.String()
+
+		default:
+			explanation.Reason = "no matching rule"
+		}
+
+		explanations = append(explanations, explanation)
+	}
+
+	return explanations
+}
+
+// ACLRepositoryAuthorizer authorizes access to repositories using an [ACLPolicy] loaded from a file.
+//
+// The policy is replaced atomically on every (successful) reload,
+// so ACLRepositoryAuthorizer is safe for concurrent use while watching the file for changes.
+type ACLRepositoryAuthorizer struct {
+	path   string
+	policy atomic.Pointer[aclPolicy]
+}
+
+// NewACLRepositoryAuthorizer returns a new [ACLRepositoryAuthorizer] and loads the policy from the file at path.
+func NewACLRepositoryAuthorizer(path string) (*ACLRepositoryAuthorizer, error) {
+	a := &ACLRepositoryAuthorizer{
+		path: path,
+	}
+
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Reload reads the policy file and replaces the current policy.
+//
+// If the file cannot be read or the policy is invalid, the current policy is kept.
+func (a *ACLRepositoryAuthorizer) Reload() error {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	policy, err := decodeACLPolicy(file)
+	if err != nil {
+		return fmt.Errorf("parsing ACL policy file %q: %w", a.path, err)
+	}
+
+	compiled, err := compileACLPolicy(policy)
+	if err != nil {
+		return fmt.Errorf("validating ACL policy file %q: %w", a.path, err)
+	}
+
+	a.policy.Store(compiled)
+
+	return nil
+}
+
+// Watch watches the policy file and reloads the policy whenever the file changes.
+//
+// Reload errors are passed to errorHandler (if any) and the previous policy remains in use.
+//
+// Watch blocks until ctx is canceled.
+func (a *ACLRepositoryAuthorizer) Watch(ctx context.Context, errorHandler auth.ErrorHandler) error {
+	return fswatch.Watch(ctx, a.path, fswatch.DefaultDebounce, func() {
+		err := a.Reload()
+		if err != nil && errorHandler != nil {
+			errorHandler.Handle(err)
+		}
+	})
+}
+
+// Authorize implements [RepositoryAuthorizer].
+func (a *ACLRepositoryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	explanations, err := a.ExplainRepository(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return grantedActionsOf(explanations), nil
+}
+
+// ExplainRepository implements [RepositoryExplainer].
+func (a *ACLRepositoryAuthorizer) ExplainRepository(_ context.Context, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error) {
+	policy := a.policy.Load()
+	if policy == nil {
+		policy = &aclPolicy{}
+	}
+
+	return policy.explain(name, subject, requestedActions), nil
+}
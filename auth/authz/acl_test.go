@@ -0,0 +1,222 @@
+package authz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+const testACLPolicy = `
+rules:
+  - repository: "team-a/*"
+    groups: ["team-a"]
+    actions: ["pull", "push"]
+  - repositoryRegexp: "^team-a/.+-prod$"
+    groups: ["team-a"]
+    actions: ["push"]
+    effect: deny
+  - repositoryRegexp: "^team-a/.+-prod$"
+    subjects: ["release-bot"]
+    actions: ["*"]
+    priority: 10
+  - repository: "*/*"
+    attributes:
+      role: auditor
+    actions: ["pull"]
+  - repository: "library/*"
+    anonymous: true
+    actions: ["pull"]
+`
+
+func TestACLRepositoryAuthorizer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl.yaml")
+
+	err := os.WriteFile(path, []byte(testACLPolicy), 0o600)
+	require.NoError(t, err)
+
+	authorizer, err := NewACLRepositoryAuthorizer(path)
+	require.NoError(t, err)
+
+	developer := subject{
+		id:         auth.SubjectIDFromString("developer"),
+		attributes: map[string]any{"groups": []any{"team-a", "team-b"}},
+	}
+
+	releaseBot := subject{
+		id: auth.SubjectIDFromString("release-bot"),
+	}
+
+	auditor := subject{
+		id:         auth.SubjectIDFromString("auditor"),
+		attributes: map[string]any{"role": "auditor"},
+	}
+
+	testCases := []struct {
+		name            string
+		repository      string
+		subject         auth.Subject
+		actions         []string
+		expectedActions []string
+	}{
+		{
+			name:            "GroupMember",
+			repository:      "team-a/app",
+			subject:         developer,
+			actions:         []string{"pull", "push", "delete"},
+			expectedActions: []string{"pull", "push"},
+		},
+		{
+			name:            "DenyOverridesAllow",
+			repository:      "team-a/app-prod",
+			subject:         developer,
+			actions:         []string{"pull", "push"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "Priority",
+			repository:      "team-a/app-prod",
+			subject:         releaseBot,
+			actions:         []string{"pull", "push", "delete"},
+			expectedActions: []string{"pull", "push", "delete"},
+		},
+		{
+			name:            "NoMatchingRule",
+			repository:      "team-a/app",
+			subject:         releaseBot,
+			actions:         []string{"pull"},
+			expectedActions: []string{},
+		},
+		{
+			name:            "Attribute",
+			repository:      "team-b/app",
+			subject:         auditor,
+			actions:         []string{"pull", "push"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "Anonymous",
+			repository:      "library/alpine",
+			subject:         auth.AnonymousSubject{},
+			actions:         []string{"pull", "push"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "AnonymousRuleDoesNotApplyToSubjects",
+			repository:      "library/alpine",
+			subject:         developer,
+			actions:         []string{"pull"},
+			expectedActions: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			actions, err := authorizer.Authorize(context.Background(), testCase.repository, testCase.subject, testCase.actions)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedActions, actions)
+		})
+	}
+
+	t.Run("Explain", func(t *testing.T) {
+		explanations, err := authorizer.ExplainRepository(context.Background(), "team-a/app-prod", developer, []string{"pull", "push", "delete"})
+		require.NoError(t, err)
+
+		expected := []auth.ActionExplanation{
+			{Action: "pull", Granted: true, Reason: `allowed by rule 0 (allow "team-a/*")`},
+			{Action: "push", Reason: `denied by rule 1 (deny "^team-a/.+-prod$")`},
+			{Action: "delete", Reason: "no matching rule"},
+		}
+
+		assert.Equal(t, expected, explanations)
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "acl.json")
+
+		err := os.WriteFile(path, []byte(`{"rules": [{"repository": "*", "subjects": ["developer"], "actions": ["pull"]}]}`), 0o600)
+		require.NoError(t, err)
+
+		authorizer, err := NewACLRepositoryAuthorizer(path)
+		require.NoError(t, err)
+
+		actions, err := authorizer.Authorize(context.Background(), "app", developer, []string{"pull"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pull"}, actions)
+
+		// Invalid policies are not loaded
+		err = os.WriteFile(path, []byte(`{"rules": [{"repository": "[", "actions": ["pull"]}]}`), 0o600)
+		require.NoError(t, err)
+
+		err = authorizer.Reload()
+		require.Error(t, err)
+
+		actions, err = authorizer.Authorize(context.Background(), "app", developer, []string{"pull"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"pull"}, actions)
+
+		err = os.WriteFile(path, []byte(`{"rules": []}`), 0o600)
+		require.NoError(t, err)
+
+		err = authorizer.Reload()
+		require.NoError(t, err)
+
+		actions, err = authorizer.Authorize(context.Background(), "app", developer, []string{"pull"})
+		require.NoError(t, err)
+		assert.Empty(t, actions)
+	})
+}
+
+func TestParseACLPolicy(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy string
+	}{
+		{
+			name:   "UnknownField",
+			policy: `rules: [{repository: "*", actions: [pull], unknown: true}]`,
+		},
+		{
+			name:   "MissingRepository",
+			policy: `rules: [{actions: [pull]}]`,
+		},
+		{
+			name:   "BothRepositoryMatchers",
+			policy: `rules: [{repository: "*", repositoryRegexp: ".*", actions: [pull]}]`,
+		},
+		{
+			name:   "InvalidRegexp",
+			policy: `rules: [{repositoryRegexp: "(", actions: [pull]}]`,
+		},
+		{
+			name:   "MissingActions",
+			policy: `rules: [{repository: "*"}]`,
+		},
+		{
+			name:   "UnknownEffect",
+			policy: `rules: [{repository: "*", actions: [pull], effect: maybe}]`,
+		},
+		{
+			name:   "AnonymousWithSubjects",
+			policy: `rules: [{repository: "*", actions: [pull], anonymous: true, subjects: [user]}]`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := ParseACLPolicy(strings.NewReader(testCase.policy))
+			require.Error(t, err)
+		})
+	}
+}
@@ -10,11 +10,15 @@ import (
 )
 
 // DefaultAuthorizer implements a basic set of authorization rules
-// and delegates authorization for repository resources.
+// and delegates authorization for repository and registry resources.
 // Access to everything else is denied.
+//
+// Without a [RegistryAuthorizer] (see [WithRegistryAuthorizer]), every subject may access the catalog
+// and access to other registry resources is denied.
 type DefaultAuthorizer struct {
-	repoAuthorizer RepositoryAuthorizer
-	allowAnonymous bool
+	repoAuthorizer     RepositoryAuthorizer
+	registryAuthorizer RegistryAuthorizer
+	allowAnonymous     bool
 }
 
 // RepositoryAuthorizer authorizes access requests to a specific repository.
@@ -22,53 +26,152 @@ type RepositoryAuthorizer interface {
 	Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error)
 }
 
+// DefaultAuthorizerOption configures a [DefaultAuthorizer].
+type DefaultAuthorizerOption interface {
+	applyDefaultAuthorizer(*DefaultAuthorizer)
+}
+
+type withRegistryAuthorizer struct {
+	authorizer RegistryAuthorizer
+}
+
+func (o withRegistryAuthorizer) applyDefaultAuthorizer(a *DefaultAuthorizer) {
+	a.registryAuthorizer = o.authorizer
+}
+
+// WithRegistryAuthorizer delegates authorization for registry resources (eg. the catalog).
+func WithRegistryAuthorizer(authorizer RegistryAuthorizer) DefaultAuthorizerOption {
+	return withRegistryAuthorizer{authorizer}
+}
+
 // NewDefaultAuthorizer returns a new DefaultAuthorizer.
-func NewDefaultAuthorizer(repoAuthorizer RepositoryAuthorizer, allowAnonymous bool) DefaultAuthorizer {
-	return DefaultAuthorizer{
+func NewDefaultAuthorizer(repoAuthorizer RepositoryAuthorizer, allowAnonymous bool, opts ...DefaultAuthorizerOption) DefaultAuthorizer {
+	a := DefaultAuthorizer{
 		repoAuthorizer: repoAuthorizer,
 		allowAnonymous: allowAnonymous,
 	}
+
+	for _, opt := range opts {
+		opt.applyDefaultAuthorizer(&a)
+	}
+
+	if a.registryAuthorizer == nil {
+		a.registryAuthorizer = catalogRegistryAuthorizer{}
+	}
+
+	return a
 }
 
 func (a DefaultAuthorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
-	if !a.allowAnonymous && subject == nil {
+	explanations, err := a.Explain(ctx, subject, requestedScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.GrantedScopes(explanations), nil
+}
+
+// Explain implements [auth.Explainer].
+//
+// Decisions about repositories and registry resources are explained by the respective authorizers
+// if they implement [RepositoryExplainer] and [RegistryExplainer].
+func (a DefaultAuthorizer) Explain(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.ScopeExplanation, error) {
+	if !a.allowAnonymous && auth.IsAnonymous(subject) {
 		return nil, auth.ErrUnauthorized
 	}
-	// Let's be optimistic about the amount of granted scopes
-	grantedScopes := make([]auth.Scope, 0, len(requestedScopes))
+
+	explanations := make([]auth.ScopeExplanation, 0, len(requestedScopes))
 
 	for _, scope := range requestedScopes {
-		if scope.Type == "repository" {
-			grantedActions, err := a.repoAuthorizer.Authorize(ctx, scope.Name, subject, scope.Actions)
+		var explanation auth.ScopeExplanation
+
+		switch scope.Type {
+		case "repository":
+			actions, err := ExplainRepository(ctx, a.repoAuthorizer, scope.Name, subject, scope.Actions)
 			if err != nil {
 				// TODO: collect errors?
 				return nil, err
 			}
 
-			// Don't add a scope with no actions
-			if len(grantedActions) == 0 {
-				continue
+			explanation = auth.ScopeExplanation{
+				Resource: scope.Resource,
+				Actions:  actions,
+			}
+
+		case "registry":
+			actions, err := ExplainRegistry(ctx, a.registryAuthorizer, scope.Name, subject, scope.Actions)
+			if err != nil {
+				return nil, err
 			}
 
-			scope.Actions = grantedActions
-		} else if scope.Type == "registry" {
-			// TODO: Limit some actions to "admin" users
-			if scope.Name != "catalog" {
-				// TODO: log: unknown registry resource
-				continue
+			explanation = auth.ScopeExplanation{
+				Resource: scope.Resource,
+				Actions:  actions,
 			}
-		} else {
-			// TODO: log: unsupported resource type
-			continue
+
+		default:
+			explanation = auth.ExplainScope(scope, false, "unsupported resource type")
 		}
 
-		grantedScopes = append(grantedScopes, scope)
+		explanations = append(explanations, explanation)
 	}
 
-	return grantedScopes, nil
+	return explanations, nil
+}
+
+// RepositoryExplainer is implemented by a [RepositoryAuthorizer] that can explain its decisions.
+type RepositoryExplainer interface {
+	// ExplainRepository authorizes an access request the same way Authorize does and explains the decision about every requested action.
+	ExplainRepository(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error)
 }
 
-// DefaultRepositoryAuthorizer implements a simple authorization logic for authenticated users.
+// ExplainRepository explains the decision of a repository authorizer about an access request.
+//
+// If the authorizer does not implement [RepositoryExplainer], explanations are derived from the actions it grants (without reasons).
+func ExplainRepository(ctx context.Context, authorizer RepositoryAuthorizer, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error) {
+	if explainer, ok := authorizer.(RepositoryExplainer); ok {
+		return explainer.ExplainRepository(ctx, name, subject, requestedActions)
+	}
+
+	grantedActions, err := authorizer.Authorize(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return explainGrantedActions(grantedActions, requestedActions), nil
+}
+
+// explainGrantedActions derives explanations (without reasons) from granted actions.
+func explainGrantedActions(grantedActions []string, requestedActions []string) []auth.ActionExplanation {
+	explanations := make([]auth.ActionExplanation, 0, len(requestedActions))
+
+	for _, action := range requestedActions {
+		explanations = append(explanations, auth.ActionExplanation{
+			Action:  action,
+			Granted: slices.Contains(grantedActions, action),
+		})
+	}
+
+	return explanations
+}
+
+// grantedActionsOf returns the granted actions of explanations.
+func grantedActionsOf(explanations []auth.ActionExplanation) []string {
+	actions := []string{}
+
+	for _, explanation := range explanations {
+		if explanation.Granted {
+			actions = append(actions, explanation.Action)
+		}
+	}
+
+	return actions
+}
+
+// DefaultRepositoryAuthorizer implements a simple authorization logic for authenticated users:
+// users have full access to repositories under their own namespace (eg. "user/*").
+//
+// If anonymous access is allowed, anonymous subjects may pull any repository.
 type DefaultRepositoryAuthorizer struct {
 	allowAnonymous bool
 }
@@ -80,14 +183,55 @@ func NewDefaultRepositoryAuthorizer(allowAnonymous bool) DefaultRepositoryAuthor
 	}
 }
 
-func (a DefaultRepositoryAuthorizer) Authorize(_ context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
-	if !a.allowAnonymous && subject == nil {
-		return nil, auth.ErrUnauthorized
+func (a DefaultRepositoryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	explanations, err := a.ExplainRepository(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return grantedActionsOf(explanations), nil
+}
+
+// ExplainRepository implements [RepositoryExplainer].
+func (a DefaultRepositoryAuthorizer) ExplainRepository(_ context.Context, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error) {
+	explanations := make([]auth.ActionExplanation, 0, len(requestedActions))
+
+	if auth.IsAnonymous(subject) {
+		if !a.allowAnonymous {
+			return nil, auth.ErrUnauthorized
+		}
+
+		for _, action := range requestedActions {
+			explanation := auth.ActionExplanation{
+				Action: action,
+				Reason: "anonymous subjects may only pull",
+			}
+
+			if action == "pull" {
+				explanation.Granted = true
+				explanation.Reason = "anonymous access is allowed"
+			}
+
+			explanations = append(explanations, explanation)
+		}
+
+		return explanations, nil
+	}
+
+	granted := strings.HasPrefix(name, fmt.Sprintf("%s/", subject.ID().String()))
+
+	reason := "repository is in the namespace of the subject"
+	if !granted {
+		reason = "repository is outside the namespace of the subject"
 	}
 
-	if !strings.HasPrefix(name, fmt.Sprintf("%s/", subject.ID().String())) {
-		return []string{}, nil
+	for _, action := range requestedActions {
+		explanations = append(explanations, auth.ActionExplanation{
+			Action:  action,
+			Granted: granted,
+			Reason:  reason,
+		})
 	}
 
-	return slices.Clone(requestedActions), nil
+	return explanations, nil
 }
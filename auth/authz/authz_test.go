@@ -120,3 +120,48 @@ func TestDefaultAuthorizer(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultAuthorizer_Anonymous(t *testing.T) {
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "library/alpine",
+			},
+			Actions: []string{"pull", "push"},
+		},
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		authorizer := NewDefaultAuthorizer(NewDefaultRepositoryAuthorizer(true), true)
+
+		grantedScopes, err := authorizer.Authorize(context.Background(), auth.AnonymousSubject{}, scopes)
+		require.NoError(t, err)
+
+		expected := []auth.Scope{
+			{
+				Resource: auth.Resource{
+					Type: "repository",
+					Name: "library/alpine",
+				},
+				Actions: []string{"pull"},
+			},
+		}
+
+		assert.Equal(t, expected, grantedScopes)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		authorizer := NewDefaultAuthorizer(NewDefaultRepositoryAuthorizer(false), false)
+
+		_, err := authorizer.Authorize(context.Background(), auth.AnonymousSubject{}, scopes)
+		require.Error(t, err)
+
+		assert.ErrorIs(t, err, auth.ErrUnauthorized)
+
+		_, err = NewDefaultRepositoryAuthorizer(false).Authorize(context.Background(), "library/alpine", nil, []string{"pull"})
+		require.Error(t, err)
+
+		assert.ErrorIs(t, err, auth.ErrUnauthorized)
+	})
+}
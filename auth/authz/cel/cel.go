@@ -0,0 +1,218 @@
+// Package cel implements authorizers evaluating [CEL] expressions.
+//
+// It lives in its own package to keep the dependencies of CEL out of the core authorizers.
+//
+// [CEL]: https://cel.dev
+package cel
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	celgo "github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// Policy is a set of compiled [CEL] expressions granting access to resources.
+//
+// Expressions are evaluated for every requested scope with the following variables:
+//   - subject: a map with the ID ("id"), the attributes ("attrs") of the subject and whether it is anonymous ("anonymous")
+//   - resource: a map with the type ("type") and the name ("name") of the requested resource
+//   - actions: the list of requested actions
+//   - service: the service access is requested to (see [auth.ServiceFromContext])
+//
+// Expressions either return a boolean (true grants every requested action) or a list of actions to grant:
+//
+//	subject.attrs.team == resource.name.split('/')[0] && 'push' in actions
+//	resource.type == 'repository' && resource.name.startsWith('library/') ? ['pull'] : []
+//
+// Granted actions are the union of the actions granted by every expression (limited to the requested actions).
+// Accessing a missing attribute is an evaluation error: use optional field selection for attributes that may be missing
+// (eg. subject.attrs.?role.orValue("") == "admin").
+// The [string] and [list] extensions are available.
+//
+// [CEL]: https://cel.dev
+// [string]: https://pkg.go.dev/github.com/google/cel-go/ext#Strings
+// [list]: https://pkg.go.dev/github.com/google/cel-go/ext#Lists
+type Policy struct {
+	programs []compiledExpression
+}
+
+type compiledExpression struct {
+	expression string
+	program    celgo.Program
+}
+
+var actionsType = reflect.TypeOf([]string{})
+
+// CompilePolicy compiles and type checks CEL expressions.
+func CompilePolicy(expressions ...string) (Policy, error) {
+	env, err := celgo.NewEnv(
+		celgo.Variable("subject", celgo.MapType(celgo.StringType, celgo.DynType)),
+		celgo.Variable("resource", celgo.MapType(celgo.StringType, celgo.StringType)),
+		celgo.Variable("actions", celgo.ListType(celgo.StringType)),
+		celgo.Variable("service", celgo.StringType),
+		celgo.OptionalTypes(),
+		ext.Strings(),
+		ext.Lists(),
+	)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	programs := make([]compiledExpression, 0, len(expressions))
+
+	for _, expression := range expressions {
+		ast, issues := env.Compile(expression)
+		if err := issues.Err(); err != nil {
+			return Policy{}, fmt.Errorf("compiling CEL expression %q: %w", expression, err)
+		}
+
+		outputType := ast.OutputType()
+		if !outputType.IsExactType(celgo.BoolType) && !outputType.IsExactType(celgo.ListType(celgo.StringType)) {
+			return Policy{}, fmt.Errorf("CEL expression %q must return bool or list(string), got %s", expression, outputType)
+		}
+
+		program, err := env.Program(ast, celgo.InterruptCheckFrequency(100))
+		if err != nil {
+			return Policy{}, fmt.Errorf("creating CEL program %q: %w", expression, err)
+		}
+
+		programs = append(programs, compiledExpression{
+			expression: expression,
+			program:    program,
+		})
+	}
+
+	return Policy{
+		programs: programs,
+	}, nil
+}
+
+// Authorizer grants access to any resource based on a [Policy].
+type Authorizer struct {
+	policy Policy
+}
+
+// NewAuthorizer returns a new [Authorizer].
+func NewAuthorizer(policy Policy) Authorizer {
+	return Authorizer{
+		policy: policy,
+	}
+}
+
+// Authorize implements [auth.Authorizer].
+func (a Authorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	grantedScopes := make([]auth.Scope, 0, len(requestedScopes))
+
+	for _, scope := range requestedScopes {
+		grantedActions, err := a.policy.authorize(ctx, scope.Resource, subject, scope.Actions)
+		if err != nil {
+			return nil, err
+		}
+
+		// Don't add a scope with no actions
+		if len(grantedActions) == 0 {
+			continue
+		}
+
+		scope.Actions = grantedActions
+
+		grantedScopes = append(grantedScopes, scope)
+	}
+
+	return grantedScopes, nil
+}
+
+// RepositoryAuthorizer grants access to repositories based on a [Policy].
+//
+// Use it with [authz.DefaultAuthorizer] to keep its rules for other resources.
+type RepositoryAuthorizer struct {
+	policy Policy
+}
+
+// NewRepositoryAuthorizer returns a new [RepositoryAuthorizer].
+func NewRepositoryAuthorizer(policy Policy) RepositoryAuthorizer {
+	return RepositoryAuthorizer{
+		policy: policy,
+	}
+}
+
+// Authorize implements [authz.RepositoryAuthorizer].
+func (a RepositoryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	return a.policy.authorize(ctx, auth.Resource{Type: "repository", Name: name}, subject, requestedActions)
+}
+
+func (p Policy) authorize(ctx context.Context, resource auth.Resource, subject auth.Subject, requestedActions []string) ([]string, error) {
+	vars := variables(ctx, resource, subject, requestedActions)
+
+	var allowedActions []string
+
+	for _, program := range p.programs {
+		out, _, err := program.program.ContextEval(ctx, vars)
+		if err != nil {
+			return nil, fmt.Errorf("evaluating CEL expression %q: %w", program.expression, err)
+		}
+
+		switch v := out.Value().(type) {
+		case bool:
+			if v {
+				return slices.Clone(requestedActions), nil
+			}
+
+		default:
+			actions, err := out.ConvertToNative(actionsType)
+			if err != nil {
+				return nil, fmt.Errorf("evaluating CEL expression %q: %w", program.expression, err)
+			}
+
+			allowedActions = append(allowedActions, actions.([]string)...)
+		}
+	}
+
+	grantedActions := []string{}
+
+	for _, action := range requestedActions {
+		if slices.Contains(allowedActions, action) {
+			grantedActions = append(grantedActions, action)
+		}
+	}
+
+	return grantedActions, nil
+}
+
+func variables(ctx context.Context, resource auth.Resource, subject auth.Subject, requestedActions []string) map[string]any {
+	subjectVar := map[string]any{
+		"id":        "",
+		"attrs":     map[string]any{},
+		"anonymous": auth.IsAnonymous(subject),
+	}
+
+	if subject != nil {
+		subjectVar["id"] = subject.ID().String()
+
+		if attrs := subject.Attributes(); attrs != nil {
+			subjectVar["attrs"] = attrs
+		}
+	}
+
+	service, _ := auth.ServiceFromContext(ctx)
+
+	if requestedActions == nil {
+		requestedActions = []string{}
+	}
+
+	return map[string]any{
+		"subject": subjectVar,
+		"resource": map[string]string{
+			"type": resource.Type,
+			"name": resource.Name,
+		},
+		"actions": requestedActions,
+		"service": service,
+	}
+}
@@ -0,0 +1,169 @@
+package cel
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+type subject struct {
+	id         auth.SubjectID
+	attributes map[string]any
+}
+
+func (s subject) ID() auth.SubjectID {
+	return s.id
+}
+
+func (s subject) Attribute(key string) (any, bool) {
+	v, ok := s.attributes[key]
+
+	return v, ok
+}
+
+func (s subject) Attributes() map[string]any {
+	return maps.Clone(s.attributes)
+}
+
+func TestAuthorizer(t *testing.T) {
+	policy, err := CompilePolicy(
+		`resource.type == 'repository' && subject.attrs.?team.orValue('') == resource.name.split('/')[0]`,
+		`resource.type == 'repository' && resource.name.startsWith('library/') ? ['pull'] : []`,
+		`resource.type == 'registry' && resource.name == 'catalog' && subject.attrs.?role.orValue('') == 'admin' && service == 'registry.example.com'`,
+	)
+	require.NoError(t, err)
+
+	authorizer := NewAuthorizer(policy)
+
+	developer := subject{
+		id:         auth.SubjectIDFromString("developer"),
+		attributes: map[string]any{"team": "team-a"},
+	}
+
+	admin := subject{
+		id:         auth.SubjectIDFromString("admin"),
+		attributes: map[string]any{"team": "ops", "role": "admin"},
+	}
+
+	ctx := auth.ContextWithService(context.Background(), "registry.example.com")
+
+	testCases := []struct {
+		name           string
+		subject        auth.Subject
+		scopes         []auth.Scope
+		expectedScopes []auth.Scope
+	}{
+		{
+			name:    "Team",
+			subject: developer,
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull", "push"}},
+				{Resource: auth.Resource{Type: "repository", Name: "team-b/app"}, Actions: []string{"pull", "push"}},
+			},
+			expectedScopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull", "push"}},
+			},
+		},
+		{
+			name:    "ActionList",
+			subject: auth.AnonymousSubject{},
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "library/alpine"}, Actions: []string{"pull", "push"}},
+			},
+			expectedScopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "library/alpine"}, Actions: []string{"pull"}},
+			},
+		},
+		{
+			name:    "Registry",
+			subject: admin,
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Actions: []string{"*"}},
+			},
+			expectedScopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Actions: []string{"*"}},
+			},
+		},
+		{
+			name:    "Denied",
+			subject: developer,
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Actions: []string{"*"}},
+			},
+			expectedScopes: []auth.Scope{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			scopes, err := authorizer.Authorize(ctx, testCase.subject, testCase.scopes)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedScopes, scopes)
+		})
+	}
+
+	t.Run("Repository", func(t *testing.T) {
+		authorizer := NewRepositoryAuthorizer(policy)
+
+		actions, err := authorizer.Authorize(ctx, "library/alpine", developer, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"pull"}, actions)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("Evaluation", func(t *testing.T) {
+			policy, err := CompilePolicy(`subject.attrs.team == 'team-a'`)
+			require.NoError(t, err)
+
+			// Missing attributes result in an evaluation error
+			actions, err := NewAuthorizer(policy).Authorize(ctx, auth.AnonymousSubject{}, []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull"}},
+			})
+			require.Error(t, err)
+
+			assert.Nil(t, actions)
+		})
+	})
+}
+
+func TestCompilePolicy(t *testing.T) {
+	testCases := []struct {
+		name       string
+		expression string
+	}{
+		{
+			name:       "Syntax",
+			expression: `subject.id ==`,
+		},
+		{
+			name:       "UndeclaredVariable",
+			expression: `user.id == 'admin'`,
+		},
+		{
+			name:       "TypeMismatch",
+			expression: `resource.name == 1`,
+		},
+		{
+			name:       "OutputType",
+			expression: `resource.name`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := CompilePolicy(testCase.expression)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package authz
+
+import (
+	"context"
+	"slices"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// AnyOf grants the union of the actions granted by its authorizers.
+//
+// Authorizers are called in order with the actions not granted yet:
+// once every requested action is granted, the remaining authorizers are skipped.
+// An error returned by any authorizer is returned immediately.
+type AnyOf []auth.Authorizer
+
+// Authorize implements [auth.Authorizer].
+func (a AnyOf) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	return anyOf(ctx, subject, requestedScopes, authorizeFuncs(a))
+}
+
+// Intersection grants the actions granted by every one of its authorizers.
+//
+// Authorizers are called in order with the actions granted by every previous authorizer:
+// once nothing is granted, the remaining authorizers are skipped.
+// An error returned by any authorizer is returned immediately.
+//
+// Use it to restrict what other authorizers grant (eg. with a blocklist granting everything but blocked repositories).
+type Intersection []auth.Authorizer
+
+// Authorize implements [auth.Authorizer].
+func (a Intersection) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	return intersection(ctx, subject, requestedScopes, authorizeFuncs(a))
+}
+
+// AllOf grants a scope only if every one of its authorizers grants every requested action of the scope.
+// Unlike [Intersection], a scope is either granted as requested or not at all.
+//
+// Authorizers are called in order with the scopes granted by every previous authorizer:
+// once nothing is granted, the remaining authorizers are skipped.
+// An error returned by any authorizer is returned immediately.
+type AllOf []auth.Authorizer
+
+// Authorize implements [auth.Authorizer].
+func (a AllOf) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	return allOf(ctx, subject, requestedScopes, authorizeFuncs(a))
+}
+
+// FirstMatch lets the first authorizer granting any action of a scope decide which actions are granted.
+//
+// Authorizers are called in order with the scopes no previous authorizer granted anything of:
+// once every scope is decided, the remaining authorizers are skipped.
+// An error returned by any authorizer is returned immediately.
+type FirstMatch []auth.Authorizer
+
+// Authorize implements [auth.Authorizer].
+func (a FirstMatch) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	return firstMatch(ctx, subject, requestedScopes, authorizeFuncs(a))
+}
+
+// RepositoryAnyOf is the [RepositoryAuthorizer] equivalent of [AnyOf].
+type RepositoryAnyOf []RepositoryAuthorizer
+
+// Authorize implements [RepositoryAuthorizer].
+func (a RepositoryAnyOf) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	return authorizeRepository(ctx, name, subject, requestedActions, a, anyOf)
+}
+
+// RepositoryIntersection is the [RepositoryAuthorizer] equivalent of [Intersection].
+type RepositoryIntersection []RepositoryAuthorizer
+
+// Authorize implements [RepositoryAuthorizer].
+func (a RepositoryIntersection) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	return authorizeRepository(ctx, name, subject, requestedActions, a, intersection)
+}
+
+// RepositoryAllOf is the [RepositoryAuthorizer] equivalent of [AllOf].
+type RepositoryAllOf []RepositoryAuthorizer
+
+// Authorize implements [RepositoryAuthorizer].
+func (a RepositoryAllOf) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	return authorizeRepository(ctx, name, subject, requestedActions, a, allOf)
+}
+
+// RepositoryFirstMatch is the [RepositoryAuthorizer] equivalent of [FirstMatch].
+type RepositoryFirstMatch []RepositoryAuthorizer
+
+// Authorize implements [RepositoryAuthorizer].
+func (a RepositoryFirstMatch) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	return authorizeRepository(ctx, name, subject, requestedActions, a, firstMatch)
+}
+
+// authorizeFunc is the common denominator of [auth.Authorizer] and [RepositoryAuthorizer].
+type authorizeFunc func(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error)
+
+type combinator func(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope, authorizers []authorizeFunc) ([]auth.Scope, error)
+
+func authorizeFuncs(authorizers []auth.Authorizer) []authorizeFunc {
+	funcs := make([]authorizeFunc, 0, len(authorizers))
+
+	for _, authorizer := range authorizers {
+		funcs = append(funcs, authorizer.Authorize)
+	}
+
+	return funcs
+}
+
+func authorizeRepository(ctx context.Context, name string, subject auth.Subject, requestedActions []string, authorizers []RepositoryAuthorizer, combine combinator) ([]string, error) {
+	funcs := make([]authorizeFunc, 0, len(authorizers))
+
+	for _, authorizer := range authorizers {
+		authorizer := authorizer
+
+		funcs = append(funcs, func(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+			grantedScopes := make([]auth.Scope, 0, len(requestedScopes))
+
+			for _, scope := range requestedScopes {
+				actions, err := authorizer.Authorize(ctx, scope.Name, subject, scope.Actions)
+				if err != nil {
+					return nil, err
+				}
+
+				scope.Actions = actions
+
+				grantedScopes = append(grantedScopes, scope)
+			}
+
+			return grantedScopes, nil
+		})
+	}
+
+	grantedScopes, err := combine(ctx, subject, []auth.Scope{{Resource: auth.Resource{Type: "repository", Name: name}, Actions: requestedActions}}, funcs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(grantedScopes) == 0 {
+		return []string{}, nil
+	}
+
+	return grantedScopes[0].Actions, nil
+}
+
+// grantedActions returns the requested actions of a resource present in granted scopes.
+func grantedActions(grantedScopes []auth.Scope, resource auth.Resource, requestedActions []string) []string {
+	actions := []string{}
+
+	for _, action := range requestedActions {
+		if slices.ContainsFunc(grantedScopes, func(scope auth.Scope) bool {
+			return scope.Resource == resource && slices.Contains(scope.Actions, action)
+		}) {
+			actions = append(actions, action)
+		}
+	}
+
+	return actions
+}
+
+// withoutEmptyScopes drops scopes with no actions (preserving the order of the rest).
+func withoutEmptyScopes(scopes []auth.Scope) []auth.Scope {
+	return slices.DeleteFunc(scopes, func(scope auth.Scope) bool { return len(scope.Actions) == 0 })
+}
+
+func cloneScopes(scopes []auth.Scope) []auth.Scope {
+	clone := make([]auth.Scope, 0, len(scopes))
+
+	for _, scope := range scopes {
+		scope.Actions = slices.Clone(scope.Actions)
+
+		clone = append(clone, scope)
+	}
+
+	return clone
+}
+
+func anyOf(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope, authorizers []authorizeFunc) ([]auth.Scope, error) {
+	granted := cloneScopes(requestedScopes)
+	remaining := cloneScopes(requestedScopes)
+
+	for i := range granted {
+		granted[i].Actions = []string{}
+	}
+
+	for _, authorize := range authorizers {
+		pending := withoutEmptyScopes(cloneScopes(remaining))
+		if len(pending) == 0 {
+			break
+		}
+
+		grantedScopes, err := authorize(ctx, subject, pending)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, scope := range remaining {
+			actions := grantedActions(grantedScopes, scope.Resource, scope.Actions)
+
+			granted[i].Actions = append(granted[i].Actions, actions...)
+			remaining[i].Actions = slices.DeleteFunc(remaining[i].Actions, func(action string) bool { return slices.Contains(actions, action) })
+		}
+	}
+
+	return withoutEmptyScopes(granted), nil
+}
+
+func intersection(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope, authorizers []authorizeFunc) ([]auth.Scope, error) {
+	granted := withoutEmptyScopes(cloneScopes(requestedScopes))
+
+	for _, authorize := range authorizers {
+		if len(granted) == 0 {
+			break
+		}
+
+		grantedScopes, err := authorize(ctx, subject, cloneScopes(granted))
+		if err != nil {
+			return nil, err
+		}
+
+		for i, scope := range granted {
+			granted[i].Actions = grantedActions(grantedScopes, scope.Resource, scope.Actions)
+		}
+
+		granted = withoutEmptyScopes(granted)
+	}
+
+	return granted, nil
+}
+
+func allOf(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope, authorizers []authorizeFunc) ([]auth.Scope, error) {
+	granted := withoutEmptyScopes(cloneScopes(requestedScopes))
+
+	for _, authorize := range authorizers {
+		if len(granted) == 0 {
+			break
+		}
+
+		grantedScopes, err := authorize(ctx, subject, cloneScopes(granted))
+		if err != nil {
+			return nil, err
+		}
+
+		granted = slices.DeleteFunc(granted, func(scope auth.Scope) bool {
+			return len(grantedActions(grantedScopes, scope.Resource, scope.Actions)) < len(scope.Actions)
+		})
+	}
+
+	return granted, nil
+}
+
+func firstMatch(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope, authorizers []authorizeFunc) ([]auth.Scope, error) {
+	granted := cloneScopes(requestedScopes)
+	decided := make([]bool, len(granted))
+
+	for i := range granted {
+		granted[i].Actions = []string{}
+	}
+
+	for _, authorize := range authorizers {
+		var pending []auth.Scope
+
+		for i, scope := range requestedScopes {
+			if !decided[i] && len(scope.Actions) > 0 {
+				pending = append(pending, auth.Scope{Resource: scope.Resource, Actions: slices.Clone(scope.Actions)})
+			}
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		grantedScopes, err := authorize(ctx, subject, pending)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, scope := range requestedScopes {
+			if decided[i] {
+				continue
+			}
+
+			if actions := grantedActions(grantedScopes, scope.Resource, scope.Actions); len(actions) > 0 {
+				granted[i].Actions = actions
+				decided[i] = true
+			}
+		}
+	}
+
+	return withoutEmptyScopes(granted), nil
+}
@@ -0,0 +1,259 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// grantStub grants the listed actions of repositories (intersected with the requested ones).
+type grantStub struct {
+	grants map[string][]string
+	err    error
+
+	calls *int
+}
+
+func (a grantStub) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	grantedScopes := []auth.Scope{}
+
+	for _, scope := range requestedScopes {
+		actions, err := a.AuthorizeRepository(ctx, scope.Name, subject, scope.Actions)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(actions) == 0 {
+			continue
+		}
+
+		scope.Actions = actions
+
+		grantedScopes = append(grantedScopes, scope)
+	}
+
+	return grantedScopes, nil
+}
+
+func (a grantStub) AuthorizeRepository(_ context.Context, name string, _ auth.Subject, requestedActions []string) ([]string, error) {
+	if a.calls != nil {
+		*a.calls++
+	}
+
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	actions := []string{}
+
+	for _, action := range requestedActions {
+		if slices.Contains(a.grants[name], action) {
+			actions = append(actions, action)
+		}
+	}
+
+	return actions, nil
+}
+
+type repositoryGrantStub struct {
+	grantStub
+}
+
+func (a repositoryGrantStub) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	return a.AuthorizeRepository(ctx, name, subject, requestedActions)
+}
+
+func repositoryScope(name string, actions ...string) auth.Scope {
+	return auth.Scope{
+		Resource: auth.Resource{Type: "repository", Name: name},
+		Actions:  actions,
+	}
+}
+
+func TestCombinators(t *testing.T) {
+	rbac := grantStub{grants: map[string][]string{
+		"team/app":  {"pull", "push"},
+		"team/lib":  {"pull"},
+		"other/app": {"pull"},
+	}}
+
+	ownership := grantStub{grants: map[string][]string{
+		"team/app":  {"delete"},
+		"team/lib":  {"push", "delete"},
+		"other/lib": {"pull"},
+	}}
+
+	blocklist := grantStub{grants: map[string][]string{
+		"team/app":  {"pull", "push", "delete"},
+		"team/lib":  {"pull"},
+		"other/app": {"pull", "push", "delete"},
+		"other/lib": {"pull", "push", "delete"},
+	}}
+
+	requestedScopes := []auth.Scope{
+		repositoryScope("team/app", "pull", "push", "delete"),
+		repositoryScope("team/lib", "pull", "push", "delete"),
+		repositoryScope("other/app", "pull", "push"),
+		repositoryScope("other/lib", "pull"),
+	}
+
+	testCases := []struct {
+		name           string
+		authorizer     auth.Authorizer
+		expectedScopes []auth.Scope
+	}{
+		{
+			name:       "AnyOf",
+			authorizer: AnyOf{rbac, ownership},
+			expectedScopes: []auth.Scope{
+				repositoryScope("team/app", "pull", "push", "delete"),
+				repositoryScope("team/lib", "pull", "push", "delete"),
+				repositoryScope("other/app", "pull"),
+				repositoryScope("other/lib", "pull"),
+			},
+		},
+		{
+			name:       "Intersection",
+			authorizer: Intersection{blocklist, AnyOf{rbac, ownership}},
+			expectedScopes: []auth.Scope{
+				repositoryScope("team/app", "pull", "push", "delete"),
+				repositoryScope("team/lib", "pull"),
+				repositoryScope("other/app", "pull"),
+				repositoryScope("other/lib", "pull"),
+			},
+		},
+		{
+			name:       "AllOf",
+			authorizer: AllOf{blocklist, AnyOf{rbac, ownership}},
+			expectedScopes: []auth.Scope{
+				repositoryScope("team/app", "pull", "push", "delete"),
+				repositoryScope("other/lib", "pull"),
+			},
+		},
+		{
+			name:       "FirstMatch",
+			authorizer: FirstMatch{rbac, ownership},
+			expectedScopes: []auth.Scope{
+				repositoryScope("team/app", "pull", "push"),
+				repositoryScope("team/lib", "pull"),
+				repositoryScope("other/app", "pull"),
+				repositoryScope("other/lib", "pull"),
+			},
+		},
+		{
+			name:           "Empty",
+			authorizer:     AnyOf{},
+			expectedScopes: []auth.Scope{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			scopes, err := testCase.authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedScopes, scopes)
+		})
+	}
+
+	t.Run("ShortCircuit", func(t *testing.T) {
+		var calls int
+
+		everything := grantStub{grants: map[string][]string{"team/app": {"pull", "push"}}}
+		nothing := grantStub{}
+		counter := grantStub{calls: &calls}
+
+		testCases := []struct {
+			name       string
+			authorizer auth.Authorizer
+		}{
+			{
+				name:       "AnyOf",
+				authorizer: AnyOf{everything, counter},
+			},
+			{
+				name:       "Intersection",
+				authorizer: Intersection{nothing, counter},
+			},
+			{
+				name:       "AllOf",
+				authorizer: AllOf{nothing, counter},
+			},
+			{
+				name:       "FirstMatch",
+				authorizer: FirstMatch{everything, counter},
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.name, func(t *testing.T) {
+				_, err := testCase.authorizer.Authorize(context.Background(), subject{}, []auth.Scope{repositoryScope("team/app", "pull", "push")})
+				require.NoError(t, err)
+
+				assert.Equal(t, 0, calls)
+			})
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		failing := grantStub{err: errors.New("something went wrong")}
+
+		for _, authorizer := range []auth.Authorizer{AnyOf{rbac, failing}, Intersection{rbac, failing}, AllOf{failing, rbac}, FirstMatch{failing, rbac}} {
+			_, err := authorizer.Authorize(context.Background(), subject{}, requestedScopes)
+			require.Error(t, err)
+		}
+	})
+}
+
+func TestRepositoryCombinators(t *testing.T) {
+	rbac := repositoryGrantStub{grantStub{grants: map[string][]string{"team/app": {"pull", "push"}}}}
+	ownership := repositoryGrantStub{grantStub{grants: map[string][]string{"team/app": {"push", "delete"}}}}
+
+	testCases := []struct {
+		name            string
+		authorizer      RepositoryAuthorizer
+		expectedActions []string
+	}{
+		{
+			name:            "AnyOf",
+			authorizer:      RepositoryAnyOf{rbac, ownership},
+			expectedActions: []string{"pull", "push", "delete"},
+		},
+		{
+			name:            "Intersection",
+			authorizer:      RepositoryIntersection{rbac, ownership},
+			expectedActions: []string{"push"},
+		},
+		{
+			name:            "AllOf",
+			authorizer:      RepositoryAllOf{rbac, ownership},
+			expectedActions: []string{},
+		},
+		{
+			name:            "FirstMatch",
+			authorizer:      RepositoryFirstMatch{rbac, ownership},
+			expectedActions: []string{"pull", "push"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			actions, err := testCase.authorizer.Authorize(context.Background(), "team/app", subject{}, []string{"pull", "push", "delete"})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedActions, actions)
+		})
+	}
+}
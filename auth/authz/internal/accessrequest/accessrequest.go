@@ -0,0 +1,50 @@
+// Package accessrequest implements the JSON representation of access requests passed to external policy engines
+// (eg. the webhook and the Rego authorizers).
+package accessrequest
+
+import (
+	"context"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// Request is the JSON representation of an access request.
+type Request struct {
+	Subject Subject      `json:"subject"`
+	Service string       `json:"service"`
+	Scopes  []auth.Scope `json:"scopes"`
+}
+
+// Subject is the JSON representation of the subject of an access request.
+type Subject struct {
+	ID         string         `json:"id"`
+	Attributes map[string]any `json:"attributes"`
+	Anonymous  bool           `json:"anonymous"`
+}
+
+// New returns the access request of a subject (the service is taken from ctx).
+func New(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) Request {
+	request := Request{
+		Subject: Subject{
+			Attributes: map[string]any{},
+			Anonymous:  auth.IsAnonymous(subject),
+		},
+		Scopes: requestedScopes,
+	}
+
+	if subject != nil {
+		request.Subject.ID = subject.ID().String()
+
+		if attrs := subject.Attributes(); attrs != nil {
+			request.Subject.Attributes = attrs
+		}
+	}
+
+	request.Service, _ = auth.ServiceFromContext(ctx)
+
+	if request.Scopes == nil {
+		request.Scopes = []auth.Scope{}
+	}
+
+	return request
+}
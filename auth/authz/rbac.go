@@ -0,0 +1,241 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sync"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// Predefined roles.
+const (
+	RoleReader    = "reader"
+	RoleDeveloper = "developer"
+	RoleAdmin     = "admin"
+)
+
+// DefaultRoles maps the predefined roles to the actions they grant.
+//
+// "*" grants every action.
+var DefaultRoles = map[string][]string{
+	RoleReader:    {"pull"},
+	RoleDeveloper: {"pull", "push"},
+	RoleAdmin:     {"*"},
+}
+
+// RoleBinding grants a role on repositories to subjects and groups.
+type RoleBinding struct {
+	// Role is the name of the granted role (eg. [RoleDeveloper]).
+	Role string
+
+	// Repository is a glob pattern following the syntax of [path.Match] (eg. "team/*").
+	Repository string
+
+	// Subjects lists the subject IDs the role is granted to.
+	Subjects []string
+
+	// Groups lists the groups the role is granted to.
+	Groups []string
+}
+
+func (b RoleBinding) appliesTo(subject auth.Subject, groupsAttribute string) bool {
+	if slices.Contains(b.Subjects, subject.ID().String()) {
+		return true
+	}
+
+	return slices.ContainsFunc(b.Groups, func(group string) bool { return attributeMatches(subject, groupsAttribute, group) })
+}
+
+// RoleBindingStore provides role bindings to [RBACRepositoryAuthorizer].
+type RoleBindingStore interface {
+	// ListRoleBindings returns the role bindings that may apply to a subject.
+	//
+	// Stores may return every role binding: the authorizer checks whether they apply to the subject.
+	ListRoleBindings(ctx context.Context, subject auth.Subject) ([]RoleBinding, error)
+}
+
+// InMemoryRoleBindingStore is a [RoleBindingStore] keeping role bindings in memory.
+type InMemoryRoleBindingStore struct {
+	mu       sync.RWMutex
+	bindings []RoleBinding
+}
+
+// NewInMemoryRoleBindingStore returns a new [InMemoryRoleBindingStore].
+func NewInMemoryRoleBindingStore(bindings ...RoleBinding) *InMemoryRoleBindingStore {
+	return &InMemoryRoleBindingStore{
+		bindings: slices.Clone(bindings),
+	}
+}
+
+// AddRoleBinding adds a role binding to the store.
+func (s *InMemoryRoleBindingStore) AddRoleBinding(binding RoleBinding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bindings = append(s.bindings, binding)
+}
+
+// SetRoleBindings replaces every role binding in the store.
+func (s *InMemoryRoleBindingStore) SetRoleBindings(bindings []RoleBinding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bindings = slices.Clone(bindings)
+}
+
+// ListRoleBindings implements [RoleBindingStore].
+func (s *InMemoryRoleBindingStore) ListRoleBindings(_ context.Context, _ auth.Subject) ([]RoleBinding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.bindings), nil
+}
+
+// RBACRepositoryAuthorizer grants access to repositories based on roles.
+//
+// Roles map to sets of actions (see [DefaultRoles]).
+// Role bindings (served by a [RoleBindingStore]) grant roles on repository patterns to subjects or groups.
+// Groups are taken from a subject attribute (see [DefaultGroupsAttribute]).
+//
+// Subjects are granted the requested actions included in any of the roles bound to them on the repository.
+// Anonymous subjects are never granted anything.
+type RBACRepositoryAuthorizer struct {
+	store           RoleBindingStore
+	roles           map[string][]string
+	groupsAttribute string
+}
+
+// RBACOption configures an [RBACRepositoryAuthorizer].
+type RBACOption interface {
+	applyRBAC(*RBACRepositoryAuthorizer)
+}
+
+type withRoles map[string][]string
+
+func (o withRoles) applyRBAC(a *RBACRepositoryAuthorizer) {
+	a.roles = o
+}
+
+// WithRoles replaces [DefaultRoles].
+func WithRoles(roles map[string][]string) RBACOption {
+	cloned := make(withRoles, len(roles))
+
+	for role, actions := range roles {
+		cloned[role] = slices.Clone(actions)
+	}
+
+	return cloned
+}
+
+type withGroupsAttribute string
+
+func (o withGroupsAttribute) applyRBAC(a *RBACRepositoryAuthorizer) {
+	a.groupsAttribute = string(o)
+}
+
+// WithGroupsAttribute sets the subject attribute holding the groups of a subject. Defaults to [DefaultGroupsAttribute].
+func WithGroupsAttribute(attribute string) RBACOption {
+	return withGroupsAttribute(attribute)
+}
+
+// NewRBACRepositoryAuthorizer returns a new [RBACRepositoryAuthorizer].
+func NewRBACRepositoryAuthorizer(store RoleBindingStore, opts ...RBACOption) RBACRepositoryAuthorizer {
+	a := RBACRepositoryAuthorizer{
+		store: store,
+	}
+
+	for _, opt := range opts {
+		opt.applyRBAC(&a)
+	}
+
+	if a.roles == nil {
+		a.roles = DefaultRoles
+	}
+
+	if a.groupsAttribute == "" {
+		a.groupsAttribute = DefaultGroupsAttribute
+	}
+
+	return a
+}
+
+// Authorize implements [RepositoryAuthorizer].
+//
+// Role bindings referencing an unknown role or containing an invalid repository pattern result in an error.
+func (a RBACRepositoryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	explanations, err := a.ExplainRepository(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return grantedActionsOf(explanations), nil
+}
+
+// ExplainRepository implements [RepositoryExplainer].
+func (a RBACRepositoryAuthorizer) ExplainRepository(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error) {
+	explanations := make([]auth.ActionExplanation, 0, len(requestedActions))
+
+	if auth.IsAnonymous(subject) {
+		for _, action := range requestedActions {
+			explanations = append(explanations, auth.ActionExplanation{
+				Action: action,
+				Reason: "roles are not granted to anonymous subjects",
+			})
+		}
+
+		return explanations, nil
+	}
+
+	bindings, err := a.store.ListRoleBindings(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("listing role bindings: %w", err)
+	}
+
+	var matchingBindings []RoleBinding
+
+	for _, binding := range bindings {
+		if !binding.appliesTo(subject, a.groupsAttribute) {
+			continue
+		}
+
+		ok, err := path.Match(binding.Repository, name)
+		if err != nil {
+			return nil, fmt.Errorf("role binding %q: invalid repository pattern %q: %w", binding.Role, binding.Repository, err)
+		}
+
+		if !ok {
+			continue
+		}
+
+		if _, ok := a.roles[binding.Role]; !ok {
+			return nil, fmt.Errorf("role binding %q: unknown role", binding.Role)
+		}
+
+		matchingBindings = append(matchingBindings, binding)
+	}
+
+	for _, action := range requestedActions {
+		explanation := auth.ActionExplanation{
+			Action: action,
+			Reason: "no role granting the action is bound to the subject",
+		}
+
+		for _, binding := range matchingBindings {
+			actions := a.roles[binding.Role]
+
+			if slices.Contains(actions, "*") || slices.Contains(actions, action) {
+				explanation.Granted = true
+				explanation.Reason = fmt.Sprintf("role %q is bound to the subject on %q", binding.Role, binding.Repository)
+
+				break
+			}
+		}
+
+		explanations = append(explanations, explanation)
+	}
+
+	return explanations, nil
+}
@@ -0,0 +1,170 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+func TestRBACRepositoryAuthorizer(t *testing.T) {
+	store := NewInMemoryRoleBindingStore(
+		RoleBinding{
+			Role:       RoleDeveloper,
+			Repository: "team-a/*",
+			Groups:     []string{"team-a"},
+		},
+		RoleBinding{
+			Role:       RoleReader,
+			Repository: "team-b/*",
+			Groups:     []string{"team-a"},
+		},
+		RoleBinding{
+			Role:       RoleAdmin,
+			Repository: "team-a/*",
+			Subjects:   []string{"lead"},
+		},
+	)
+
+	authorizer := NewRBACRepositoryAuthorizer(store)
+
+	developer := subject{
+		id:         auth.SubjectIDFromString("developer"),
+		attributes: map[string]any{"groups": []string{"team-a"}},
+	}
+
+	lead := subject{
+		id: auth.SubjectIDFromString("lead"),
+	}
+
+	testCases := []struct {
+		name            string
+		repository      string
+		subject         auth.Subject
+		actions         []string
+		expectedActions []string
+	}{
+		{
+			name:            "Developer",
+			repository:      "team-a/app",
+			subject:         developer,
+			actions:         []string{"pull", "push", "delete"},
+			expectedActions: []string{"pull", "push"},
+		},
+		{
+			name:            "Reader",
+			repository:      "team-b/app",
+			subject:         developer,
+			actions:         []string{"pull", "push"},
+			expectedActions: []string{"pull"},
+		},
+		{
+			name:            "Admin",
+			repository:      "team-a/app",
+			subject:         lead,
+			actions:         []string{"pull", "push", "delete"},
+			expectedActions: []string{"pull", "push", "delete"},
+		},
+		{
+			name:            "NoBinding",
+			repository:      "team-b/app",
+			subject:         lead,
+			actions:         []string{"pull"},
+			expectedActions: []string{},
+		},
+		{
+			name:            "Anonymous",
+			repository:      "team-a/app",
+			subject:         auth.AnonymousSubject{},
+			actions:         []string{"pull"},
+			expectedActions: []string{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			actions, err := authorizer.Authorize(context.Background(), testCase.repository, testCase.subject, testCase.actions)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedActions, actions)
+		})
+	}
+
+	t.Run("Explain", func(t *testing.T) {
+		explanations, err := authorizer.ExplainRepository(context.Background(), "team-b/app", developer, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		expected := []auth.ActionExplanation{
+			{Action: "pull", Granted: true, Reason: `role "reader" is bound to the subject on "team-b/*"`},
+			{Action: "push", Reason: "no role granting the action is bound to the subject"},
+		}
+
+		assert.Equal(t, expected, explanations)
+	})
+
+	t.Run("CustomRoles", func(t *testing.T) {
+		store := NewInMemoryRoleBindingStore(RoleBinding{
+			Role:       "deployer",
+			Repository: "*",
+			Groups:     []string{"ci"},
+		})
+
+		authorizer := NewRBACRepositoryAuthorizer(store, WithRoles(map[string][]string{"deployer": {"pull"}}), WithGroupsAttribute("teams"))
+
+		ci := subject{
+			id:         auth.SubjectIDFromString("ci"),
+			attributes: map[string]any{"teams": "ci"},
+		}
+
+		actions, err := authorizer.Authorize(context.Background(), "app", ci, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"pull"}, actions)
+	})
+
+	t.Run("Clone", func(t *testing.T) {
+		bindings := []RoleBinding{{Role: "deployer", Repository: "*", Subjects: []string{"ci"}}}
+		roles := map[string][]string{"deployer": {"pull"}}
+
+		authorizer := NewRBACRepositoryAuthorizer(NewInMemoryRoleBindingStore(bindings...), WithRoles(roles))
+
+		// Modifying the arguments does not affect the authorizer
+		bindings[0].Role = "admin"
+		roles["deployer"][0] = "push"
+		roles["admin"] = []string{"*"}
+
+		actions, err := authorizer.Authorize(context.Background(), "app", subject{id: auth.SubjectIDFromString("ci")}, []string{"pull", "push"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"pull"}, actions)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("UnknownRole", func(t *testing.T) {
+			store := NewInMemoryRoleBindingStore(RoleBinding{
+				Role:       "owner",
+				Repository: "*",
+				Subjects:   []string{"lead"},
+			})
+
+			_, err := NewRBACRepositoryAuthorizer(store).Authorize(context.Background(), "app", lead, []string{"pull"})
+			require.Error(t, err)
+		})
+
+		t.Run("InvalidPattern", func(t *testing.T) {
+			store := NewInMemoryRoleBindingStore(RoleBinding{
+				Role:       RoleReader,
+				Repository: "[",
+				Subjects:   []string{"lead"},
+			})
+
+			_, err := NewRBACRepositoryAuthorizer(store).Authorize(context.Background(), "app", lead, []string{"pull"})
+			require.Error(t, err)
+		})
+	})
+}
@@ -0,0 +1,149 @@
+package authz
+
+import (
+	"context"
+	"slices"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+// RegistryCatalog is the name of the registry resource granting access to the catalog (ie. listing repositories).
+const RegistryCatalog = "catalog"
+
+// RegistryAuthorizer authorizes access requests to a specific registry resource (eg. [RegistryCatalog]).
+type RegistryAuthorizer interface {
+	Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error)
+}
+
+// RegistryExplainer is implemented by a [RegistryAuthorizer] that can explain its decisions.
+type RegistryExplainer interface {
+	// ExplainRegistry authorizes an access request the same way Authorize does and explains the decision about every requested action.
+	ExplainRegistry(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error)
+}
+
+// ExplainRegistry explains the decision of a registry authorizer about an access request.
+//
+// If the authorizer does not implement [RegistryExplainer], explanations are derived from the actions it grants (without reasons).
+func ExplainRegistry(ctx context.Context, authorizer RegistryAuthorizer, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error) {
+	if explainer, ok := authorizer.(RegistryExplainer); ok {
+		return explainer.ExplainRegistry(ctx, name, subject, requestedActions)
+	}
+
+	grantedActions, err := authorizer.Authorize(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return explainGrantedActions(grantedActions, requestedActions), nil
+}
+
+// catalogRegistryAuthorizer grants access to the catalog to everyone and denies access to other registry resources.
+type catalogRegistryAuthorizer struct{}
+
+func (a catalogRegistryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	explanations, err := a.ExplainRegistry(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return grantedActionsOf(explanations), nil
+}
+
+func (catalogRegistryAuthorizer) ExplainRegistry(_ context.Context, name string, _ auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error) {
+	granted := name == RegistryCatalog
+
+	reason := "unknown registry resource"
+	if granted {
+		reason = ""
+	}
+
+	return explainActions(requestedActions, granted, reason), nil
+}
+
+// AdminRegistryAuthorizer grants access to registry resources to admin subjects.
+//
+// Subjects are admins if a subject attribute has a specific value (eg. "role" is "admin").
+// Multi-valued attributes match if any of their values does (eg. "roles" contains "admin").
+//
+// Admins are granted every requested action on any registry resource (eg. the catalog, garbage collection).
+// Other subjects are denied access, unless access to the catalog is allowed for everyone:
+// use [FilterCatalog] to hide repositories they may not pull from the catalog.
+type AdminRegistryAuthorizer struct {
+	attribute    string
+	value        string
+	allowCatalog bool
+}
+
+// NewAdminRegistryAuthorizer returns a new [AdminRegistryAuthorizer].
+//
+// If allowCatalog is true, every (non-anonymous) subject may access the catalog.
+func NewAdminRegistryAuthorizer(attribute string, value string, allowCatalog bool) AdminRegistryAuthorizer {
+	return AdminRegistryAuthorizer{
+		attribute:    attribute,
+		value:        value,
+		allowCatalog: allowCatalog,
+	}
+}
+
+// Authorize implements [RegistryAuthorizer].
+func (a AdminRegistryAuthorizer) Authorize(ctx context.Context, name string, subject auth.Subject, requestedActions []string) ([]string, error) {
+	explanations, err := a.ExplainRegistry(ctx, name, subject, requestedActions)
+	if err != nil {
+		return nil, err
+	}
+
+	return grantedActionsOf(explanations), nil
+}
+
+// ExplainRegistry implements [RegistryExplainer].
+func (a AdminRegistryAuthorizer) ExplainRegistry(_ context.Context, name string, subject auth.Subject, requestedActions []string) ([]auth.ActionExplanation, error) {
+	switch {
+	case auth.IsAnonymous(subject):
+		return explainActions(requestedActions, false, "anonymous subjects may not access registry resources"), nil
+
+	case attributeMatches(subject, a.attribute, a.value):
+		return explainActions(requestedActions, true, "subject is an admin"), nil
+
+	case a.allowCatalog && name == RegistryCatalog:
+		return explainActions(requestedActions, true, "catalog access is allowed for every subject"), nil
+
+	default:
+		return explainActions(requestedActions, false, "subject is not an admin"), nil
+	}
+}
+
+// explainActions returns explanations where the same decision applies to every requested action.
+func explainActions(requestedActions []string, granted bool, reason string) []auth.ActionExplanation {
+	explanations := make([]auth.ActionExplanation, 0, len(requestedActions))
+
+	for _, action := range requestedActions {
+		explanations = append(explanations, auth.ActionExplanation{
+			Action:  action,
+			Granted: granted,
+			Reason:  reason,
+		})
+	}
+
+	return explanations
+}
+
+// FilterCatalog returns the repositories a subject may pull.
+//
+// The registry lists every repository to anyone with access to the catalog:
+// use FilterCatalog in a proxy in front of the catalog endpoint (/v2/_catalog) to filter it per subject.
+func FilterCatalog(ctx context.Context, authorizer RepositoryAuthorizer, subject auth.Subject, repositories []string) ([]string, error) {
+	filtered := make([]string, 0, len(repositories))
+
+	for _, repository := range repositories {
+		actions, err := authorizer.Authorize(ctx, repository, subject, []string{"pull"})
+		if err != nil {
+			return nil, err
+		}
+
+		if slices.Contains(actions, "pull") {
+			filtered = append(filtered, repository)
+		}
+	}
+
+	return filtered, nil
+}
@@ -0,0 +1,103 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+func TestAdminRegistryAuthorizer(t *testing.T) {
+	admin := subject{
+		id:         auth.SubjectIDFromString("admin"),
+		attributes: map[string]any{"roles": []any{"developer", "admin"}},
+	}
+
+	developer := subject{
+		id:         auth.SubjectIDFromString("developer"),
+		attributes: map[string]any{"roles": []any{"developer"}},
+	}
+
+	catalog := auth.Scope{Resource: auth.Resource{Type: "registry", Name: RegistryCatalog}, Actions: []string{"*"}}
+	gc := auth.Scope{Resource: auth.Resource{Type: "registry", Name: "gc"}, Actions: []string{"*"}}
+
+	testCases := []struct {
+		name           string
+		allowCatalog   bool
+		subject        auth.Subject
+		expectedScopes []auth.Scope
+	}{
+		{
+			name:           "Admin",
+			subject:        admin,
+			expectedScopes: []auth.Scope{catalog, gc},
+		},
+		{
+			name:           "NotAdmin",
+			subject:        developer,
+			expectedScopes: []auth.Scope{},
+		},
+		{
+			name:           "AllowCatalog",
+			allowCatalog:   true,
+			subject:        developer,
+			expectedScopes: []auth.Scope{catalog},
+		},
+		{
+			name:           "Anonymous",
+			allowCatalog:   true,
+			subject:        auth.AnonymousSubject{},
+			expectedScopes: []auth.Scope{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			authorizer := NewDefaultAuthorizer(
+				NewDefaultRepositoryAuthorizer(true),
+				true,
+				WithRegistryAuthorizer(NewAdminRegistryAuthorizer("roles", "admin", testCase.allowCatalog)),
+			)
+
+			scopes, err := authorizer.Authorize(context.Background(), testCase.subject, []auth.Scope{catalog, gc})
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedScopes, scopes)
+		})
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		authorizer := NewDefaultAuthorizer(NewDefaultRepositoryAuthorizer(true), true)
+
+		scopes, err := authorizer.Authorize(context.Background(), developer, []auth.Scope{catalog, gc})
+		require.NoError(t, err)
+
+		assert.Equal(t, []auth.Scope{catalog}, scopes)
+	})
+
+	t.Run("Explain", func(t *testing.T) {
+		explanations, err := NewAdminRegistryAuthorizer("roles", "admin", false).ExplainRegistry(context.Background(), "gc", developer, []string{"*"})
+		require.NoError(t, err)
+
+		assert.Equal(t, []auth.ActionExplanation{{Action: "*", Reason: "subject is not an admin"}}, explanations)
+	})
+}
+
+func TestFilterCatalog(t *testing.T) {
+	authorizer := repositoryAuthorizerStub{
+		repositories: map[string]bool{
+			"team-a/app": true,
+			"team-a/lib": true,
+		},
+	}
+
+	repositories, err := FilterCatalog(context.Background(), authorizer, subject{}, []string{"team-a/app", "team-b/app", "team-a/lib"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"team-a/app", "team-a/lib"}, repositories)
+}
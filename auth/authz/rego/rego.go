@@ -0,0 +1,221 @@
+// Package rego implements an authorizer evaluating [Rego] policies with an embedded [Open Policy Agent].
+//
+// It lives in its own package to keep the dependencies of OPA out of the core authorizers.
+//
+// [Rego]: https://www.openpolicyagent.org/docs/latest/policy-language/
+// [Open Policy Agent]: https://www.openpolicyagent.org
+package rego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strings"
+
+	opa "github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/tester"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authz/internal/accessrequest"
+)
+
+// DefaultQuery is the query evaluated by [Authorizer] by default.
+const DefaultQuery = "data.registry.authz.granted_scopes"
+
+// Authorizer grants access based on [Rego] policies evaluated by an embedded [Open Policy Agent].
+//
+// Policies and data are loaded from local files (or directories); test files ("*_test.rego") are ignored.
+//
+// The query (see [DefaultQuery]) is evaluated with the following input:
+//
+//	{
+//	  "subject": {"id": "user", "attributes": {"groups": ["team-a"]}, "anonymous": false},
+//	  "service": "registry.example.com",
+//	  "scopes": [{"type": "repository", "name": "team-a/app", "actions": ["pull", "push"]}]
+//	}
+//
+// It must return a list of granted scopes with the same structure (an undefined result grants nothing):
+//
+//	package registry.authz
+//
+//	import rego.v1
+//
+//	granted_scopes contains {"type": "repository", "name": scope.name, "actions": ["pull", "push"]} if {
+//	  some scope in input.scopes
+//	  scope.type == "repository"
+//	  some group in input.subject.attributes.groups
+//	  startswith(scope.name, concat("", [group, "/"]))
+//	}
+//
+// Granted scopes are intersected with the requested scopes (see [auth.IntersectScopes]),
+// so policies may grant wildcard names (eg. "team-a/*") and actions ("*").
+//
+// [Rego]: https://www.openpolicyagent.org/docs/latest/policy-language/
+// [Open Policy Agent]: https://www.openpolicyagent.org
+type Authorizer struct {
+	query  string
+	logger *slog.Logger
+
+	prepared opa.PreparedEvalQuery
+}
+
+// Option configures an [Authorizer].
+type Option interface {
+	apply(*Authorizer)
+}
+
+type withQuery string
+
+func (o withQuery) apply(a *Authorizer) {
+	a.query = string(o)
+}
+
+// WithQuery sets the query returning granted scopes. Defaults to [DefaultQuery].
+func WithQuery(query string) Option {
+	return withQuery(query)
+}
+
+type withDecisionLogger struct {
+	logger *slog.Logger
+}
+
+func (o withDecisionLogger) apply(a *Authorizer) {
+	a.logger = o.logger
+}
+
+// WithDecisionLogger logs every decision (the input and the result of the query) using [slog.Logger].
+func WithDecisionLogger(logger *slog.Logger) Option {
+	return withDecisionLogger{logger}
+}
+
+// NewAuthorizer loads and compiles policies from paths and returns a new [Authorizer].
+func NewAuthorizer(ctx context.Context, paths []string, opts ...Option) (Authorizer, error) {
+	a := Authorizer{
+		query: DefaultQuery,
+	}
+
+	for _, opt := range opts {
+		opt.apply(&a)
+	}
+
+	prepared, err := opa.New(
+		opa.Query(a.query),
+		opa.Load(paths, skipTests),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return Authorizer{}, fmt.Errorf("preparing rego query: %w", err)
+	}
+
+	a.prepared = prepared
+
+	return a, nil
+}
+
+func skipTests(_ string, info fs.FileInfo, _ int) bool {
+	return !info.IsDir() && strings.HasSuffix(info.Name(), "_test.rego")
+}
+
+// Authorize implements [auth.Authorizer].
+func (a Authorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	input, err := newInput(ctx, subject, requestedScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	grantedScopes, err := a.evaluate(ctx, input)
+
+	if a.logger != nil {
+		attrs := []any{
+			slog.String("query", a.query),
+			slog.Any("input", input),
+		}
+
+		if err != nil {
+			a.logger.ErrorContext(ctx, "rego decision failed", append(attrs, slog.Any("error", err))...)
+		} else {
+			a.logger.InfoContext(ctx, "rego decision", append(attrs, slog.Any("result", grantedScopes))...)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.IntersectScopes(requestedScopes, grantedScopes), nil
+}
+
+// newInput converts the access request to a JSON compatible document.
+func newInput(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) (map[string]any, error) {
+	var input map[string]any
+
+	if err := roundTripJSON(accessrequest.New(ctx, subject, requestedScopes), &input); err != nil {
+		return nil, fmt.Errorf("encoding rego input: %w", err)
+	}
+
+	return input, nil
+}
+
+func (a Authorizer) evaluate(ctx context.Context, input map[string]any) ([]auth.Scope, error) {
+	resultSet, err := a.prepared.Eval(ctx, opa.EvalInput(input))
+	if err != nil {
+		return nil, fmt.Errorf("evaluating rego query: %w", err)
+	}
+
+	// Undefined result
+	if len(resultSet) == 0 || len(resultSet[0].Expressions) == 0 {
+		return []auth.Scope{}, nil
+	}
+
+	var grantedScopes []auth.Scope
+
+	if err := roundTripJSON(resultSet[0].Expressions[0].Value, &grantedScopes); err != nil {
+		return nil, fmt.Errorf("decoding rego result: %w", err)
+	}
+
+	return grantedScopes, nil
+}
+
+func roundTripJSON(in any, out any) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, out)
+}
+
+// RunTests runs the tests of Rego policies (rules starting with "test_" in "*_test.rego" files) found in paths.
+//
+// It returns an error listing every failed test.
+// Use it in a Go test to verify policies offline:
+//
+//	func TestPolicies(t *testing.T) {
+//		if err := rego.RunTests(context.Background(), "policies"); err != nil {
+//			t.Fatal(err)
+//		}
+//	}
+func RunTests(ctx context.Context, paths ...string) error {
+	results, err := tester.Run(ctx, paths...)
+	if err != nil {
+		return fmt.Errorf("running rego tests: %w", err)
+	}
+
+	var errs []error
+
+	for _, result := range results {
+		if result.Skip || result.Pass() {
+			continue
+		}
+
+		if result.Error != nil {
+			errs = append(errs, fmt.Errorf("%s.%s: %w", result.Package, result.Name, result.Error))
+		} else {
+			errs = append(errs, fmt.Errorf("%s.%s: failed", result.Package, result.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
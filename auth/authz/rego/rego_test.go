@@ -0,0 +1,143 @@
+package rego
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+)
+
+type subject struct {
+	id         auth.SubjectID
+	attributes map[string]any
+}
+
+func (s subject) ID() auth.SubjectID {
+	return s.id
+}
+
+func (s subject) Attribute(key string) (any, bool) {
+	v, ok := s.attributes[key]
+
+	return v, ok
+}
+
+func (s subject) Attributes() map[string]any {
+	return maps.Clone(s.attributes)
+}
+
+func TestAuthorizer(t *testing.T) {
+	var logs bytes.Buffer
+
+	authorizer, err := NewAuthorizer(context.Background(), []string{"testdata/policies"}, WithDecisionLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	require.NoError(t, err)
+
+	developer := subject{
+		id:         auth.SubjectIDFromString("developer"),
+		attributes: map[string]any{"groups": []string{"team-a"}},
+	}
+
+	admin := subject{
+		id:         auth.SubjectIDFromString("admin"),
+		attributes: map[string]any{"role": "admin"},
+	}
+
+	ctx := auth.ContextWithService(context.Background(), "registry.example.com")
+
+	testCases := []struct {
+		name           string
+		subject        auth.Subject
+		scopes         []auth.Scope
+		expectedScopes []auth.Scope
+	}{
+		{
+			name:    "Group",
+			subject: developer,
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull", "push"}},
+				{Resource: auth.Resource{Type: "repository", Name: "team-b/app"}, Actions: []string{"pull", "push"}},
+			},
+			expectedScopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull", "push"}},
+			},
+		},
+		{
+			name:    "Data",
+			subject: auth.AnonymousSubject{},
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "library/alpine"}, Actions: []string{"pull", "push"}},
+			},
+			expectedScopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "repository", Name: "library/alpine"}, Actions: []string{"pull"}},
+			},
+		},
+		{
+			name:    "Service",
+			subject: admin,
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Actions: []string{"*"}},
+			},
+			expectedScopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Actions: []string{"*"}},
+			},
+		},
+		{
+			name:    "Denied",
+			subject: developer,
+			scopes: []auth.Scope{
+				{Resource: auth.Resource{Type: "registry", Name: "catalog"}, Actions: []string{"*"}},
+			},
+			expectedScopes: []auth.Scope{},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			scopes, err := authorizer.Authorize(ctx, testCase.subject, testCase.scopes)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expectedScopes, scopes)
+		})
+	}
+
+	assert.Contains(t, logs.String(), `"msg":"rego decision"`)
+
+	t.Run("UndefinedResult", func(t *testing.T) {
+		authorizer, err := NewAuthorizer(context.Background(), []string{"testdata/policies"}, WithQuery("data.registry.authz.undefined"))
+		require.NoError(t, err)
+
+		scopes, err := authorizer.Authorize(ctx, developer, []auth.Scope{
+			{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull"}},
+		})
+		require.NoError(t, err)
+
+		assert.Empty(t, scopes)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := NewAuthorizer(context.Background(), []string{"testdata/missing"})
+		require.Error(t, err)
+	})
+}
+
+func TestRunTests(t *testing.T) {
+	t.Run("OK", func(t *testing.T) {
+		err := RunTests(context.Background(), "testdata/policies")
+		require.NoError(t, err)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		err := RunTests(context.Background(), "testdata/failing")
+		require.Error(t, err)
+
+		assert.Contains(t, err.Error(), "test_nothing_is_granted")
+	})
+}
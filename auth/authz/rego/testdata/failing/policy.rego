@@ -0,0 +1,21 @@
+package registry.authz
+
+import rego.v1
+
+# Members of a group have full access to repositories under the group namespace
+granted_scopes contains {"type": "repository", "name": concat("", [group, "/*"]), "actions": ["*"]} if {
+	some group in input.subject.attributes.groups
+}
+
+# Everyone may pull public repositories
+granted_scopes contains {"type": "repository", "name": scope.name, "actions": ["pull"]} if {
+	some scope in input.scopes
+	scope.type == "repository"
+	scope.name in data.public_repositories
+}
+
+# Admins may list repositories of the internal registry
+granted_scopes contains {"type": "registry", "name": "catalog", "actions": ["*"]} if {
+	input.service == "registry.example.com"
+	input.subject.attributes.role == "admin"
+}
@@ -0,0 +1,7 @@
+package registry.authz
+
+import rego.v1
+
+test_nothing_is_granted if {
+	count(granted_scopes) > 0 with input as {"subject": {"attributes": {}}, "scopes": []}
+}
@@ -0,0 +1,14 @@
+package registry.authz
+
+import rego.v1
+
+test_group_member if {
+	{"type": "repository", "name": "team-a/*", "actions": ["*"]} in granted_scopes with input as {"subject": {"attributes": {"groups": ["team-a"]}}, "scopes": []}
+}
+
+test_anonymous_pull if {
+	{"type": "repository", "name": "library/alpine", "actions": ["pull"]} in granted_scopes with input as {
+		"subject": {"anonymous": true, "attributes": {}},
+		"scopes": [{"type": "repository", "name": "library/alpine", "actions": ["pull", "push"]}],
+	}
+}
@@ -0,0 +1,336 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authz/internal/accessrequest"
+)
+
+// DefaultWebhookTimeout is the default amount of time a [WebhookAuthorizer] waits for a single response.
+const DefaultWebhookTimeout = 5 * time.Second
+
+// DefaultWebhookRetryBackoff is the default amount of time a [WebhookAuthorizer] waits before the first retry.
+const DefaultWebhookRetryBackoff = 100 * time.Millisecond
+
+// DefaultWebhookCacheMaxEntries is the default number of decisions remembered by a [WebhookAuthorizer].
+const DefaultWebhookCacheMaxEntries = 10000
+
+// WebhookConfig configures a [WebhookAuthorizer].
+type WebhookConfig struct {
+	// URL of the endpoint receiving access requests.
+	URL string
+
+	// Header is added to every request (eg. for authentication).
+	Header http.Header
+
+	// Client sends requests. Defaults to [http.DefaultClient].
+	Client *http.Client
+
+	// Timeout limits the amount of time a single attempt can take. Defaults to [DefaultWebhookTimeout].
+	Timeout time.Duration
+
+	// Retries is the number of times a failed request is retried.
+	// Network errors, timeouts and 429 and 5xx responses are retried.
+	Retries int
+
+	// RetryBackoff is the amount of time to wait before the first retry (doubled for every further retry).
+	// Defaults to [DefaultWebhookRetryBackoff].
+	RetryBackoff time.Duration
+
+	// CacheTTL is the amount of time a decision is remembered. Zero disables caching.
+	//
+	// Decisions are cached per access request (subject, attributes, service and requested scopes).
+	CacheTTL time.Duration
+
+	// CacheMaxEntries is the maximum number of remembered decisions. Defaults to [DefaultWebhookCacheMaxEntries].
+	CacheMaxEntries int
+
+	// FailOpen grants every requested scope if the endpoint is unavailable (after retries):
+	// network errors, timeouts and 5xx responses.
+	// Otherwise (fail-closed), the error is returned and the access request fails.
+	//
+	// Other errors (eg. 4xx responses or invalid response bodies) always fail closed.
+	//
+	// WARNING: failing open means anyone gets access to anything while the endpoint is down.
+	FailOpen bool
+
+	// Clock is used to determine the current time. Defaults to the real time.
+	Clock clockwork.Clock
+}
+
+// WebhookAuthorizer delegates authorization decisions to an external HTTP service.
+//
+// Access requests are sent as JSON in POST requests:
+//
+//	{
+//	  "subject": {"id": "user", "attributes": {"groups": ["team-a"]}, "anonymous": false},
+//	  "service": "registry.example.com",
+//	  "scopes": [{"type": "repository", "name": "team-a/app", "actions": ["pull", "push"]}]
+//	}
+//
+// The endpoint responds with 200 and the granted scopes:
+//
+//	{
+//	  "scopes": [{"type": "repository", "name": "team-a/app", "actions": ["pull"]}]
+//	}
+//
+// Granted scopes are intersected with the requested scopes (see [auth.IntersectScopes]),
+// so the endpoint may grant wildcard names (eg. "team-a/*") and actions ("*").
+type WebhookAuthorizer struct {
+	url    string
+	header http.Header
+	client *http.Client
+
+	timeout      time.Duration
+	retries      int
+	retryBackoff time.Duration
+	failOpen     bool
+
+	cacheTTL        time.Duration
+	cacheMaxEntries int
+	clock           clockwork.Clock
+
+	mu      sync.Mutex
+	entries map[string]webhookCacheEntry
+}
+
+type webhookCacheEntry struct {
+	scopes    []auth.Scope
+	expiresAt time.Time
+}
+
+type webhookResponse struct {
+	Scopes []auth.Scope `json:"scopes"`
+}
+
+// NewWebhookAuthorizer returns a new [WebhookAuthorizer].
+func NewWebhookAuthorizer(config WebhookConfig) *WebhookAuthorizer {
+	a := &WebhookAuthorizer{
+		url:             config.URL,
+		header:          config.Header,
+		client:          config.Client,
+		timeout:         config.Timeout,
+		retries:         config.Retries,
+		retryBackoff:    config.RetryBackoff,
+		failOpen:        config.FailOpen,
+		cacheTTL:        config.CacheTTL,
+		cacheMaxEntries: config.CacheMaxEntries,
+		clock:           config.Clock,
+		entries:         make(map[string]webhookCacheEntry),
+	}
+
+	if a.client == nil {
+		a.client = http.DefaultClient
+	}
+
+	if a.timeout <= 0 {
+		a.timeout = DefaultWebhookTimeout
+	}
+
+	if a.retryBackoff <= 0 {
+		a.retryBackoff = DefaultWebhookRetryBackoff
+	}
+
+	if a.cacheMaxEntries <= 0 {
+		a.cacheMaxEntries = DefaultWebhookCacheMaxEntries
+	}
+
+	if a.clock == nil {
+		a.clock = clockwork.NewRealClock()
+	}
+
+	return a
+}
+
+// Authorize implements [auth.Authorizer].
+func (a *WebhookAuthorizer) Authorize(ctx context.Context, subject auth.Subject, requestedScopes []auth.Scope) ([]auth.Scope, error) {
+	body, err := json.Marshal(accessrequest.New(ctx, subject, requestedScopes))
+	if err != nil {
+		return nil, fmt.Errorf("encoding webhook request: %w", err)
+	}
+
+	key := cacheKey(body)
+
+	grantedScopes, ok := a.get(key)
+	if !ok {
+		grantedScopes, err = a.send(ctx, body)
+		if err != nil {
+			if a.failOpen && errors.Is(err, errUnavailable) && ctx.Err() == nil {
+				return slices.Clone(requestedScopes), nil
+			}
+
+			return nil, err
+		}
+
+		a.set(key, grantedScopes)
+	}
+
+	return auth.IntersectScopes(requestedScopes, grantedScopes), nil
+}
+
+func cacheKey(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// errRetryable marks errors worth retrying.
+var errRetryable = errors.New("retryable")
+
+// errUnavailable marks errors caused by an unavailable endpoint (network errors, timeouts and 5xx responses).
+// They are retried and may fail open.
+var errUnavailable = errors.New("unavailable")
+
+func (a *WebhookAuthorizer) send(ctx context.Context, body []byte) ([]auth.Scope, error) {
+	backoff := a.retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		scopes, err := a.attempt(ctx, body)
+		if err == nil {
+			return scopes, nil
+		}
+
+		retryable := errors.Is(err, errRetryable) || errors.Is(err, errUnavailable)
+
+		if !retryable || attempt >= a.retries {
+			return nil, fmt.Errorf("webhook: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("webhook: %w", ctx.Err())
+
+		case <-a.clock.After(backoff):
+		}
+
+		backoff *= 2
+	}
+}
+
+func (a *WebhookAuthorizer) attempt(ctx context.Context, body []byte) ([]auth.Scope, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range a.header {
+		req.Header[key] = values
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		return nil, fmt.Errorf("%w: unexpected status code: %d", errUnavailable, resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		_, _ = io.Copy(io.Discard, resp.Body)
+
+		return nil, fmt.Errorf("%w: unexpected status code: %d", errRetryable, resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var response webhookResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return response.Scopes, nil
+}
+
+func (a *WebhookAuthorizer) get(key string) ([]auth.Scope, bool) {
+	if a.cacheTTL <= 0 {
+		return nil, false
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if !a.clock.Now().Before(entry.expiresAt) {
+		delete(a.entries, key)
+
+		return nil, false
+	}
+
+	return entry.scopes, true
+}
+
+func (a *WebhookAuthorizer) set(key string, scopes []auth.Scope) {
+	if a.cacheTTL <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.entries) >= a.cacheMaxEntries {
+		a.evict()
+	}
+
+	a.entries[key] = webhookCacheEntry{
+		scopes:    scopes,
+		expiresAt: a.clock.Now().Add(a.cacheTTL),
+	}
+}
+
+// evict makes room for a new entry: it drops expired entries or an arbitrary one if none expired.
+func (a *WebhookAuthorizer) evict() {
+	now := a.clock.Now()
+
+	for key, entry := range a.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(a.entries, key)
+		}
+	}
+
+	for key := range a.entries {
+		if len(a.entries) < a.cacheMaxEntries {
+			break
+		}
+
+		delete(a.entries, key)
+	}
+}
+
+// InvalidateAll drops every cached decision.
+func (a *WebhookAuthorizer) InvalidateAll() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	clear(a.entries)
+}
@@ -0,0 +1,272 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authz/internal/accessrequest"
+)
+
+type entitlementService struct {
+	calls    atomic.Int32
+	failures int32
+}
+
+func (s *entitlementService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.calls.Add(1) <= s.failures {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "forbidden", http.StatusForbidden)
+
+		return
+	}
+
+	var request accessrequest.Request
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	var response webhookResponse
+
+	if team, ok := request.Subject.Attributes["team"].(string); ok && request.Service == "registry.example.com" {
+		response.Scopes = append(response.Scopes, auth.Scope{
+			Resource: auth.Resource{Type: "repository", Name: team + "/*"},
+			Actions:  []string{"pull", "push"},
+		})
+	}
+
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func TestWebhookAuthorizer(t *testing.T) {
+	developer := subject{
+		id:         auth.SubjectIDFromString("developer"),
+		attributes: map[string]any{"team": "team-a"},
+	}
+
+	requestedScopes := []auth.Scope{
+		{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull", "push", "delete"}},
+		{Resource: auth.Resource{Type: "repository", Name: "team-b/app"}, Actions: []string{"pull"}},
+	}
+
+	expectedScopes := []auth.Scope{
+		{Resource: auth.Resource{Type: "repository", Name: "team-a/app"}, Actions: []string{"pull", "push"}},
+	}
+
+	ctx := auth.ContextWithService(context.Background(), "registry.example.com")
+
+	newServer := func(t *testing.T, service *entitlementService) *httptest.Server {
+		server := httptest.NewServer(service)
+		t.Cleanup(server.Close)
+
+		return server
+	}
+
+	header := http.Header{"Authorization": []string{"Bearer secret"}}
+
+	t.Run("OK", func(t *testing.T) {
+		server := newServer(t, &entitlementService{})
+
+		authorizer := NewWebhookAuthorizer(WebhookConfig{
+			URL:    server.URL,
+			Header: header,
+		})
+
+		scopes, err := authorizer.Authorize(ctx, developer, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Equal(t, expectedScopes, scopes)
+	})
+
+	t.Run("Retry", func(t *testing.T) {
+		service := &entitlementService{failures: 2}
+		server := newServer(t, service)
+
+		clock := clockwork.NewFakeClock()
+
+		authorizer := NewWebhookAuthorizer(WebhookConfig{
+			URL:          server.URL,
+			Header:       header,
+			Retries:      2,
+			RetryBackoff: time.Minute,
+			Clock:        clock,
+		})
+
+		type result struct {
+			scopes []auth.Scope
+			err    error
+		}
+
+		results := make(chan result, 1)
+
+		go func() {
+			scopes, err := authorizer.Authorize(ctx, developer, requestedScopes)
+			results <- result{scopes, err}
+		}()
+
+		// The backoff doubles after every retry
+		clock.BlockUntil(1)
+		clock.Advance(time.Minute)
+
+		clock.BlockUntil(1)
+		clock.Advance(2 * time.Minute)
+
+		r := <-results
+		require.NoError(t, r.err)
+
+		assert.Equal(t, expectedScopes, r.scopes)
+		assert.Equal(t, int32(3), service.calls.Load())
+	})
+
+	t.Run("Cache", func(t *testing.T) {
+		service := &entitlementService{}
+		server := newServer(t, service)
+
+		clock := clockwork.NewFakeClock()
+
+		authorizer := NewWebhookAuthorizer(WebhookConfig{
+			URL:      server.URL,
+			Header:   header,
+			CacheTTL: time.Minute,
+			Clock:    clock,
+		})
+
+		for i := 0; i < 3; i++ {
+			scopes, err := authorizer.Authorize(ctx, developer, requestedScopes)
+			require.NoError(t, err)
+
+			assert.Equal(t, expectedScopes, scopes)
+		}
+
+		assert.Equal(t, int32(1), service.calls.Load())
+
+		// Different attributes result in a different request
+		_, err := authorizer.Authorize(ctx, subject{id: developer.id, attributes: map[string]any{"team": "team-b"}}, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(2), service.calls.Load())
+
+		clock.Advance(time.Minute)
+
+		_, err = authorizer.Authorize(ctx, developer, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Equal(t, int32(3), service.calls.Load())
+	})
+
+	t.Run("FailOpen", func(t *testing.T) {
+		server := newServer(t, &entitlementService{failures: 10})
+
+		authorizer := NewWebhookAuthorizer(WebhookConfig{
+			URL:      server.URL,
+			Header:   header,
+			FailOpen: true,
+		})
+
+		scopes, err := authorizer.Authorize(ctx, developer, requestedScopes)
+		require.NoError(t, err)
+
+		assert.Equal(t, requestedScopes, scopes)
+
+		t.Run("ClientError", func(t *testing.T) {
+			server := newServer(t, &entitlementService{})
+
+			// Missing authorization header
+			authorizer := NewWebhookAuthorizer(WebhookConfig{
+				URL:      server.URL,
+				FailOpen: true,
+			})
+
+			_, err := authorizer.Authorize(ctx, developer, requestedScopes)
+			require.Error(t, err)
+		})
+
+		t.Run("InvalidResponse", func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("not json"))
+			}))
+			t.Cleanup(server.Close)
+
+			authorizer := NewWebhookAuthorizer(WebhookConfig{
+				URL:      server.URL,
+				FailOpen: true,
+			})
+
+			_, err := authorizer.Authorize(ctx, developer, requestedScopes)
+			require.Error(t, err)
+		})
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("FailClosed", func(t *testing.T) {
+			service := &entitlementService{failures: 10}
+			server := newServer(t, service)
+
+			authorizer := NewWebhookAuthorizer(WebhookConfig{
+				URL:          server.URL,
+				Header:       header,
+				Retries:      1,
+				RetryBackoff: time.Millisecond,
+			})
+
+			_, err := authorizer.Authorize(ctx, developer, requestedScopes)
+			require.Error(t, err)
+
+			assert.Equal(t, int32(2), service.calls.Load())
+		})
+
+		t.Run("ClientError", func(t *testing.T) {
+			service := &entitlementService{}
+			server := newServer(t, service)
+
+			// Missing authorization header
+			authorizer := NewWebhookAuthorizer(WebhookConfig{
+				URL:     server.URL,
+				Retries: 3,
+			})
+
+			_, err := authorizer.Authorize(ctx, developer, requestedScopes)
+			require.Error(t, err)
+
+			// Client errors are not retried
+			assert.Equal(t, int32(1), service.calls.Load())
+		})
+
+		t.Run("Timeout", func(t *testing.T) {
+			done := make(chan struct{})
+
+			server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+				<-done
+			}))
+			t.Cleanup(server.Close)
+			t.Cleanup(func() { close(done) })
+
+			authorizer := NewWebhookAuthorizer(WebhookConfig{
+				URL:     server.URL,
+				Timeout: 10 * time.Millisecond,
+			})
+
+			_, err := authorizer.Authorize(ctx, developer, requestedScopes)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		})
+	})
+}
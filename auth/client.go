@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// ClientInfo contains information about the client sending an authorization request.
+type ClientInfo struct {
+	// IP is the network address of the client (if known).
+	IP string
+
+	// ClientID is the client identifier sent in the authorization request (if any).
+	ClientID string
+}
+
+type clientInfoKey struct{}
+
+// ContextWithClientInfo returns a copy of ctx carrying information about the client.
+func ContextWithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFromContext returns information about the client (if any) carried by ctx.
+func ClientInfoFromContext(ctx context.Context) (ClientInfo, bool) {
+	info, ok := ctx.Value(clientInfoKey{}).(ClientInfo)
+
+	return info, ok
+}
+
+// contextWithClientID adds the client ID of an authorization request to the client information carried by ctx.
+func contextWithClientID(ctx context.Context, clientID string) context.Context {
+	info, _ := ClientInfoFromContext(ctx)
+	info.ClientID = clientID
+
+	return ContextWithClientInfo(ctx, info)
+}
+
+// ClientRegistry declares known clients and what they may do.
+type ClientRegistry interface {
+	// ClientPolicy authenticates a client and returns its policy.
+	//
+	// clientSecret is empty if the client did not send one (eg. public clients like docker).
+	// It returns an [OAuth2Error] with the [OAuth2ErrorInvalidClient] code if the client is unknown or its credentials are invalid.
+	ClientPolicy(ctx context.Context, clientID string, clientSecret string) (ClientPolicy, error)
+}
+
+// ClientPolicy restricts what a client may do.
+type ClientPolicy struct {
+	// GrantTypes lists the grant types the client may use (nil means any).
+	// Requests to the token endpoint (see [AuthorizationServiceImpl.TokenHandler]) count as [GrantTypePassword].
+	GrantTypes []string
+
+	// AccessTypes lists the access types the client may request (nil means any).
+	// Requests without an access type count as [AccessTypeOnline].
+	AccessTypes []string
+
+	// Scopes is the upper bound of scopes the client may be granted (nil means no limit).
+	// Resource names may contain wildcards (see [IntersectScopes]).
+	Scopes []Scope
+
+	// AccessTokenExpiration overrides the expiration of access tokens issued to the client (if positive).
+	AccessTokenExpiration time.Duration
+
+	// RefreshTokenLifetime limits how long refresh tokens issued to the client can be used after the subject authenticated (if positive).
+	RefreshTokenLifetime time.Duration
+
+	// Authenticated reports whether the registry verified the secret of the client (ie. it is a confidential client).
+	// A [ClientAuthenticator] may rely on it (see [ClientPolicyFromContext]) instead of verifying the same secret again.
+	Authenticated bool
+}
+
+// check returns an error if the policy does not allow a grant type or an access type.
+func (p ClientPolicy) check(grantType string, accessType string) error {
+	if p.GrantTypes != nil && !slices.Contains(p.GrantTypes, grantType) {
+		return OAuth2Error{Code: OAuth2ErrorUnauthorizedClient, Description: "grant type is not allowed for the client"}
+	}
+
+	if accessType == "" {
+		accessType = AccessTypeOnline
+	}
+
+	if p.AccessTypes != nil && !slices.Contains(p.AccessTypes, accessType) {
+		return OAuth2Error{Code: OAuth2ErrorUnauthorizedClient, Description: "access type is not allowed for the client"}
+	}
+
+	return nil
+}
+
+// limit limits scopes to the scope ceiling of the policy.
+func (p ClientPolicy) limit(scopes []Scope) []Scope {
+	if p.Scopes == nil {
+		return scopes
+	}
+
+	return IntersectScopes(scopes, p.Scopes)
+}
+
+type clientPolicyKey struct{}
+
+// ContextWithClientPolicy returns a copy of ctx carrying the policy of the client.
+func ContextWithClientPolicy(ctx context.Context, policy ClientPolicy) context.Context {
+	return context.WithValue(ctx, clientPolicyKey{}, policy)
+}
+
+// ClientPolicyFromContext returns the policy of the client (if any) carried by ctx.
+//
+// Token issuers use it to apply client specific token lifetimes.
+func ClientPolicyFromContext(ctx context.Context) (ClientPolicy, bool) {
+	policy, ok := ctx.Value(clientPolicyKey{}).(ClientPolicy)
+
+	return policy, ok
+}
+
+// checkClient consults the client registry (if any) and attaches the policy of the client to ctx.
+func (s AuthorizationServiceImpl) checkClient(ctx context.Context, clientID string, clientSecret string, grantType string, accessType string) (context.Context, error) {
+	if s.ClientRegistry == nil {
+		return ctx, nil
+	}
+
+	policy, err := s.ClientRegistry.ClientPolicy(ctx, clientID, clientSecret)
+	if err != nil {
+		return ctx, err
+	}
+
+	if err := policy.check(grantType, accessType); err != nil {
+		return ctx, err
+	}
+
+	return ContextWithClientPolicy(ctx, policy), nil
+}
+
+// limitClientScopes limits scopes to the scope ceiling of the client (if any).
+func limitClientScopes(ctx context.Context, scopes []Scope) []Scope {
+	policy, ok := ClientPolicyFromContext(ctx)
+	if !ok {
+		return scopes
+	}
+
+	return policy.limit(scopes)
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// GrantTypeDeviceCode is the grant type defined by the [OAuth 2.0 Device Authorization Grant].
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceAuthorizationRequest implements the device authorization request defined in the [OAuth 2.0 Device Authorization Grant].
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628#section-3.1
+type DeviceAuthorizationRequest struct {
+	Service  string
+	ClientID string
+
+	// Scopes are displayed to the user during verification.
+	// Access tokens are issued for the scopes requested when polling (as usual).
+	Scopes Scopes
+}
+
+func (r DeviceAuthorizationRequest) Validate() error {
+	if r.Service == "" {
+		return OAuth2Error{Code: OAuth2ErrorInvalidRequest, Description: "service is required"}
+	}
+
+	if r.ClientID == "" {
+		return OAuth2Error{Code: OAuth2ErrorInvalidRequest, Description: "client ID is required"}
+	}
+
+	return nil
+}
+
+// DeviceAuthorizationResponse implements the device authorization response defined in the [OAuth 2.0 Device Authorization Grant].
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628#section-3.2
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// DeviceAuthorizer implements the [OAuth 2.0 Device Authorization Grant].
+//
+// The device (eg. a docker credential helper) starts an authorization and displays a user code and a verification URI.
+// The user visits the verification URI in a browser, authenticates (eg. using SSO) and approves the code.
+// Meanwhile, the device polls the token endpoint with the device code until the authorization is approved.
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628
+type DeviceAuthorizer interface {
+	// AuthorizeDevice starts a new device authorization.
+	AuthorizeDevice(ctx context.Context, r DeviceAuthorizationRequest) (DeviceAuthorizationResponse, error)
+
+	// AuthenticateDeviceCode returns the subject that approved a device authorization.
+	//
+	// Until then, it returns an [OAuth2Error] with one of the following codes:
+	//   - [OAuth2ErrorAuthorizationPending]: the user has not approved the authorization yet
+	//   - [OAuth2ErrorSlowDown]: the device polls too often
+	//   - [OAuth2ErrorAccessDenied]: the user denied the authorization
+	//   - [OAuth2ErrorExpiredToken]: the device code expired
+	//   - [OAuth2ErrorInvalidGrant]: the device code is unknown (or has already been used)
+	AuthenticateDeviceCode(ctx context.Context, service string, clientID string, deviceCode string) (Subject, error)
+}
+
+// DeviceAuthorizationService is implemented by [AuthorizationService] implementations supporting the [OAuth 2.0 Device Authorization Grant].
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628
+type DeviceAuthorizationService interface {
+	DeviceAuthorizationHandler(ctx context.Context, r DeviceAuthorizationRequest) (DeviceAuthorizationResponse, error)
+}
+
+var errDeviceGrantUnsupported = OAuth2Error{Code: OAuth2ErrorUnsupportedGrantType, Description: "device authorization grant is not supported"}
+
+// DeviceAuthorizationHandler implements the device authorization endpoint of the [OAuth 2.0 Device Authorization Grant].
+//
+// It requires a [DeviceAuthorizer].
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628
+func (s AuthorizationServiceImpl) DeviceAuthorizationHandler(ctx context.Context, r DeviceAuthorizationRequest) (DeviceAuthorizationResponse, error) {
+	if err := r.Validate(); err != nil {
+		return DeviceAuthorizationResponse{}, err
+	}
+
+	if s.DeviceAuthorizer == nil {
+		return DeviceAuthorizationResponse{}, errDeviceGrantUnsupported
+	}
+
+	ctx = contextWithClientID(ctx, r.ClientID)
+	ctx = ContextWithService(ctx, r.Service)
+
+	// Devices always receive a refresh token
+	ctx, err := s.checkClient(ctx, r.ClientID, "", GrantTypeDeviceCode, AccessTypeOffline)
+	if err != nil {
+		return DeviceAuthorizationResponse{}, err
+	}
+
+	return s.DeviceAuthorizer.AuthorizeDevice(ctx, r)
+}
+
+// DeviceAuthorizationHandler implements [DeviceAuthorizationService] and logs every request.
+func (s LoggerAuthorizationService) DeviceAuthorizationHandler(ctx context.Context, r DeviceAuthorizationRequest) (DeviceAuthorizationResponse, error) {
+	service, ok := s.Service.(DeviceAuthorizationService)
+	if !ok {
+		return DeviceAuthorizationResponse{}, errDeviceGrantUnsupported
+	}
+
+	resp, err := service.DeviceAuthorizationHandler(ctx, r)
+
+	logger := s.Logger.With(
+		// TODO: correlation ID
+		slog.String("client_id", r.ClientID),
+		slog.String("service", r.Service),
+		slog.String("scopes", r.Scopes.String()),
+	)
+
+	if err != nil && !isClientError(err) {
+		logger.Error("device authorization failed", slog.Any("error", err))
+	} else if err != nil {
+		logger.Info("device authorization failed due to client error", slog.Any("error", err))
+	} else {
+		logger.Info("device authorization started")
+	}
+
+	return resp, err
+}
+
+// isClientError returns true if an error is caused by the client (rather than the server).
+func isClientError(err error) bool {
+	var oauth2Err OAuth2Error
+
+	return errors.Is(err, ErrUnauthorized) ||
+		errors.Is(err, ErrAuthenticationFailed) ||
+		errors.Is(err, ErrTooManyAttempts) ||
+		errors.As(err, &oauth2Err)
+}
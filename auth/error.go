@@ -19,3 +19,44 @@ func (h LogErrorHandler) Handle(err error) {
 
 	h.Logger.Error(err.Error(), slog.Any("error", err))
 }
+
+// OAuth2 error codes defined by [RFC 6749], [RFC 8628] and [RFC 8693].
+//
+// [RFC 6749]: https://datatracker.ietf.org/doc/html/rfc6749#section-5.2
+// [RFC 8628]: https://datatracker.ietf.org/doc/html/rfc8628#section-3.5
+// [RFC 8693]: https://datatracker.ietf.org/doc/html/rfc8693#section-2.2.2
+const (
+	OAuth2ErrorInvalidRequest       = "invalid_request"
+	OAuth2ErrorInvalidClient        = "invalid_client"
+	OAuth2ErrorUnauthorizedClient   = "unauthorized_client"
+	OAuth2ErrorInvalidGrant         = "invalid_grant"
+	OAuth2ErrorInvalidScope         = "invalid_scope"
+	OAuth2ErrorUnsupportedGrantType = "unsupported_grant_type"
+	OAuth2ErrorAuthorizationPending = "authorization_pending"
+	OAuth2ErrorSlowDown             = "slow_down"
+	OAuth2ErrorAccessDenied         = "access_denied"
+	OAuth2ErrorExpiredToken         = "expired_token"
+)
+
+// OAuth2Error is an error response defined by the OAuth2 specification.
+//
+// It is returned to the client as a JSON document with a 400 status code (401 for [OAuth2ErrorInvalidClient]).
+type OAuth2Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e OAuth2Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+// Is implements the interface used by [errors.Is]: errors with the same code match regardless of their description.
+func (e OAuth2Error) Is(target error) bool {
+	t, ok := target.(OAuth2Error)
+
+	return ok && t.Code == e.Code
+}
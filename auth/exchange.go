@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// GrantTypeTokenExchange is the grant type defined by [OAuth 2.0 Token Exchange].
+//
+// [OAuth 2.0 Token Exchange]: https://datatracker.ietf.org/doc/html/rfc8693
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// Token types defined by [OAuth 2.0 Token Exchange].
+//
+// [OAuth 2.0 Token Exchange]: https://datatracker.ietf.org/doc/html/rfc8693#section-3
+const (
+	TokenTypeAccessToken  = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeRefreshToken = "urn:ietf:params:oauth:token-type:refresh_token"
+)
+
+var validSubjectTokenTypes = []string{
+	TokenTypeAccessToken,
+	TokenTypeRefreshToken,
+}
+
+// Actor is the party acting on behalf of a subject (recorded in the "act" claim of [OAuth 2.0 Token Exchange]).
+//
+// If the subject token was already issued to an actor, the previous actor is nested.
+//
+// [OAuth 2.0 Token Exchange]: https://datatracker.ietf.org/doc/html/rfc8693#section-4.1
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// DelegatedSubject is a [Subject] an [Actor] is acting on behalf of.
+//
+// [AccessTokenIssuer] implementations SHOULD record the actor in issued tokens.
+type DelegatedSubject struct {
+	Subject
+
+	Actor Actor
+
+	// NotAfter is the expiration of the subject token (zero if unknown).
+	//
+	// [AccessTokenIssuer] implementations MUST NOT issue tokens expiring after it:
+	// otherwise exchanging access tokens would renew them forever.
+	NotAfter time.Time
+}
+
+// VerifiedAccessToken is the content of a verified access token.
+type VerifiedAccessToken struct {
+	// SubjectID is nil for tokens issued to anonymous subjects.
+	SubjectID SubjectID
+
+	Scopes []Scope
+
+	// Actor is the party the token was issued to if it was obtained using token exchange.
+	Actor *Actor
+
+	// ExpiresAt is the expiration of the token.
+	ExpiresAt time.Time
+}
+
+// AccessTokenVerifier is implemented by [AccessTokenIssuer] implementations that can verify their own tokens.
+//
+// It is required for exchanging access tokens.
+type AccessTokenVerifier interface {
+	// VerifyAccessToken verifies an access token issued for a service.
+	//
+	// It returns an [ErrAuthenticationFailed] error in case the token is invalid.
+	VerifyAccessToken(ctx context.Context, service string, accessToken string) (VerifiedAccessToken, error)
+}
+
+// exchangeToken implements the token exchange grant.
+//
+// It requires a [ClientRegistry]: the client becomes the actor of the new token, so it has to be a registered one.
+//
+// Requested scopes have to be a subset of what the subject token allows:
+// the scopes of an access token or whatever the subject of a refresh token is authorized for.
+// If no scopes are requested, an exchanged access token keeps its scopes.
+//
+// Access tokens only carry the ID of their subject: it is reloaded from the [SubjectRepository] and authorized again,
+// and the new token never outlives the exchanged one.
+// Refresh tokens are rotated if the [RefreshTokenIssuer] supports it (see [RefreshTokenRotator]).
+func (s AuthorizationServiceImpl) exchangeToken(ctx context.Context, r OAuth2Request) (OAuth2Response, error) {
+	if s.ClientRegistry == nil {
+		return OAuth2Response{}, OAuth2Error{Code: OAuth2ErrorUnsupportedGrantType, Description: "token exchange requires registered clients"}
+	}
+
+	var subject Subject
+	var previousActor *Actor
+	var notAfter time.Time
+
+	scopes := r.Scopes
+
+	switch r.SubjectTokenType {
+	case TokenTypeAccessToken:
+		verifier, ok := s.TokenIssuer.AccessTokenIssuer.(AccessTokenVerifier)
+		if !ok || s.SubjectRepository == nil {
+			return OAuth2Response{}, OAuth2Error{Code: OAuth2ErrorInvalidRequest, Description: "access tokens cannot be exchanged"}
+		}
+
+		token, err := verifier.VerifyAccessToken(ctx, r.Service, r.SubjectToken)
+		if err != nil {
+			return OAuth2Response{}, err
+		}
+
+		if token.SubjectID == nil || token.SubjectID.String() == "" {
+			return OAuth2Response{}, OAuth2Error{Code: OAuth2ErrorInvalidGrant, Description: "anonymous tokens cannot be exchanged"}
+		}
+
+		if len(scopes) == 0 {
+			scopes = token.Scopes
+		}
+
+		if !ScopesWithin(scopes, token.Scopes) {
+			return OAuth2Response{}, OAuth2Error{Code: OAuth2ErrorInvalidScope, Description: "requested scopes exceed the subject token"}
+		}
+
+		subject, err = s.SubjectRepository.GetSubjectByID(ctx, token.SubjectID)
+		if err != nil {
+			return OAuth2Response{}, err
+		}
+
+		previousActor = token.Actor
+		notAfter = token.ExpiresAt
+
+	case TokenTypeRefreshToken:
+		var err error
+
+		subject, err = s.Authenticator.AuthenticateRefreshToken(ctx, r.Service, r.SubjectToken)
+		if err != nil {
+			return OAuth2Response{}, err
+		}
+
+	default:
+		// This should never happen
+		return OAuth2Response{}, errors.New("unknown subject_token_type value")
+	}
+
+	grantedScopes, err := s.authorize(ctx, subject, scopes)
+	if err != nil {
+		return OAuth2Response{}, err
+	}
+
+	if subject, ok := subject.(BoundedSubject); ok {
+		grantedScopes = IntersectScopes(grantedScopes, subject.ScopeBounds())
+	}
+
+	if !ScopesWithin(scopes, grantedScopes) {
+		return OAuth2Response{}, OAuth2Error{Code: OAuth2ErrorInvalidScope, Description: "requested scopes exceed the subject token"}
+	}
+
+	scopes = slices.Clone(limitClientScopes(ctx, scopes))
+
+	// Sort actions to make sure tokens are more consistent
+	for i, scope := range scopes {
+		scope.Actions = slices.Clone(scope.Actions)
+		slices.Sort(scope.Actions)
+
+		scopes[i] = scope
+	}
+
+	delegatedSubject := DelegatedSubject{
+		Subject: subject,
+		Actor: Actor{
+			Subject: r.ClientID,
+			Actor:   previousActor,
+		},
+		NotAfter: notAfter,
+	}
+
+	token, err := s.TokenIssuer.IssueAccessToken(ctx, r.Service, delegatedSubject, scopes)
+	if err != nil {
+		return OAuth2Response{}, err
+	}
+
+	response := OAuth2Response{
+		Token:           token.Payload,
+		ExpiresIn:       int(token.ExpiresIn.Seconds()),
+		IssuedAt:        token.IssuedAt.Format(time.RFC3339),
+		Scope:           Scopes(scopes).String(),
+		IssuedTokenType: TokenTypeAccessToken,
+	}
+
+	// Rotated refresh tokens may only be used once: the client MUST use the new one next time
+	if rotator, ok := s.TokenIssuer.RefreshTokenIssuer.(RefreshTokenRotator); ok && r.SubjectTokenType == TokenTypeRefreshToken {
+		refreshToken, err := rotator.RotateRefreshToken(ctx, r.Service, subject, r.SubjectToken)
+		if err != nil {
+			return OAuth2Response{}, err
+		}
+
+		if refreshToken != r.SubjectToken {
+			response.RefreshToken = refreshToken
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,319 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+)
+
+// ActionExplanation describes the decision about a single requested action.
+type ActionExplanation struct {
+	Action  string `json:"action"`
+	Granted bool   `json:"granted"`
+
+	// Reason is a human readable description of the decision (eg. the rule that matched).
+	Reason string `json:"reason,omitempty"`
+}
+
+// ScopeExplanation describes the decisions about the actions of a requested scope.
+type ScopeExplanation struct {
+	Resource
+	Actions []ActionExplanation `json:"actions"`
+}
+
+// GrantedActions returns the granted actions of the scope.
+func (e ScopeExplanation) GrantedActions() []string {
+	actions := []string{}
+
+	for _, action := range e.Actions {
+		if action.Granted {
+			actions = append(actions, action.Action)
+		}
+	}
+
+	return actions
+}
+
+// deny revokes granted actions that are not allowed by bounds.
+func (e ScopeExplanation) deny(bounds []Scope, reason string) {
+	for i, action := range e.Actions {
+		if !action.Granted || slices.ContainsFunc(bounds, func(bound Scope) bool { return bound.allows(e.Resource, action.Action) }) {
+			continue
+		}
+
+		e.Actions[i] = ActionExplanation{
+			Action: action.Action,
+			Reason: reason,
+		}
+	}
+}
+
+// ExplainScope returns an explanation of a scope where the same reason applies to every requested action.
+func ExplainScope(scope Scope, granted bool, reason string) ScopeExplanation {
+	explanation := ScopeExplanation{
+		Resource: scope.Resource,
+		Actions:  make([]ActionExplanation, 0, len(scope.Actions)),
+	}
+
+	for _, action := range scope.Actions {
+		explanation.Actions = append(explanation.Actions, ActionExplanation{
+			Action:  action,
+			Granted: granted,
+			Reason:  reason,
+		})
+	}
+
+	return explanation
+}
+
+// Explainer is implemented by an [Authorizer] that can explain its decisions.
+type Explainer interface {
+	// Explain authorizes an access request the same way Authorize does and explains the decision about every requested scope.
+	//
+	// It returns one explanation for every requested scope (in the same order).
+	Explain(ctx context.Context, subject Subject, requestedScopes []Scope) ([]ScopeExplanation, error)
+}
+
+// Explain explains the decision of an authorizer about an access request.
+//
+// If the authorizer does not implement [Explainer], explanations are derived from the scopes it grants (without reasons).
+func Explain(ctx context.Context, authorizer Authorizer, subject Subject, requestedScopes []Scope) ([]ScopeExplanation, error) {
+	if explainer, ok := authorizer.(Explainer); ok {
+		return explainer.Explain(ctx, subject, requestedScopes)
+	}
+
+	grantedScopes, err := authorizer.Authorize(ctx, subject, requestedScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return explainGrantedScopes(requestedScopes, grantedScopes), nil
+}
+
+// explainGrantedScopes derives explanations (without reasons) from the scopes granted by an authorizer.
+func explainGrantedScopes(requestedScopes []Scope, grantedScopes []Scope) []ScopeExplanation {
+	explanations := make([]ScopeExplanation, 0, len(requestedScopes))
+
+	for _, scope := range requestedScopes {
+		explanation := ExplainScope(scope, true, "")
+		explanation.deny(grantedScopes, "")
+
+		explanations = append(explanations, explanation)
+	}
+
+	return explanations
+}
+
+// GrantedScopes returns the scopes with at least one granted action.
+func GrantedScopes(explanations []ScopeExplanation) []Scope {
+	scopes := make([]Scope, 0, len(explanations))
+
+	for _, explanation := range explanations {
+		actions := explanation.GrantedActions()
+		if len(actions) == 0 {
+			continue
+		}
+
+		scopes = append(scopes, Scope{
+			Resource: explanation.Resource,
+			Actions:  actions,
+		})
+	}
+
+	return scopes
+}
+
+// ExplainResponse describes the decision about an access request.
+type ExplainResponse struct {
+	// Subject is the ID of the authenticated subject.
+	Subject string `json:"subject"`
+
+	// Scopes explains the decision about every requested scope.
+	Scopes []ScopeExplanation `json:"scopes"`
+
+	// Scope lists the scopes a token would be issued for (in the format of [OAuth2Response]).
+	Scope string `json:"scope"`
+}
+
+// ExplainService is implemented by an [AuthorizationService] that can explain authorization decisions
+// without issuing tokens (ie. a dry-run of [AuthorizationService.TokenHandler]).
+type ExplainService interface {
+	Explain(ctx context.Context, r TokenRequest) (ExplainResponse, error)
+}
+
+var errExplainUnsupported = errors.New("explaining authorization decisions is not supported")
+
+// Explain implements [ExplainService].
+//
+// It authenticates the subject like [AuthorizationServiceImpl.TokenHandler] (anonymous requests are rejected)
+// and explains the decision of the [Authorizer] (including the limits applied by subject bounds and client policies),
+// but it does not issue any tokens.
+func (s AuthorizationServiceImpl) Explain(ctx context.Context, r TokenRequest) (ExplainResponse, error) {
+	if err := r.Validate(); err != nil {
+		return ExplainResponse{}, err
+	}
+
+	if r.Anonymous {
+		return ExplainResponse{}, ErrAuthenticationFailed
+	}
+
+	if r.ClientID == "" {
+		r.ClientID = s.DefaultClientID
+	}
+
+	ctx = contextWithClientID(ctx, r.ClientID)
+	ctx = ContextWithService(ctx, r.Service)
+
+	ctx, err := s.checkClient(ctx, r.ClientID, "", GrantTypePassword, AccessTypeOnline)
+	if err != nil {
+		return ExplainResponse{}, err
+	}
+
+	subject, err := s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
+	if err != nil {
+		return ExplainResponse{}, err
+	}
+
+	explanations, err := s.explain(ctx, subject, r.Scopes)
+	if err != nil {
+		return ExplainResponse{}, err
+	}
+
+	return ExplainResponse{
+		Subject: subject.ID().String(),
+		Scopes:  explanations,
+		Scope:   Scopes(GrantedScopes(explanations)).String(),
+	}, nil
+}
+
+// explain explains the decision of the authorizer and applies the same limits as token requests.
+func (s AuthorizationServiceImpl) explain(ctx context.Context, subject Subject, requestedScopes []Scope) ([]ScopeExplanation, error) {
+	explanations, err := Explain(ctx, s.Authorizer, subject, requestedScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, explanation := range explanations {
+		if subject, ok := subject.(BoundedSubject); ok {
+			explanation.deny(subject.ScopeBounds(), "not allowed by the scope bounds of the subject")
+		}
+
+		if policy, ok := ClientPolicyFromContext(ctx); ok && policy.Scopes != nil {
+			explanation.deny(policy.Scopes, "not allowed by the client policy")
+		}
+	}
+
+	return explanations, nil
+}
+
+// authorize authorizes an access request and logs denied actions (if a logger is configured).
+//
+// The decision is always made by Authorize: if the authorizer implements [Explainer],
+// it is only asked to explain denied actions, so that the reason can be logged.
+func (s AuthorizationServiceImpl) authorize(ctx context.Context, subject Subject, requestedScopes []Scope) ([]Scope, error) {
+	grantedScopes, err := s.Authorizer.Authorize(ctx, subject, requestedScopes)
+	if err != nil || s.Logger == nil {
+		return grantedScopes, err
+	}
+
+	explanations := explainGrantedScopes(requestedScopes, grantedScopes)
+
+	if explainer, ok := s.Authorizer.(Explainer); ok && hasDeniedActions(explanations) {
+		reasons, err := explainer.Explain(ctx, subject, requestedScopes)
+		if err != nil {
+			s.Logger.WarnContext(ctx, "explaining denied actions", slog.Any("error", err))
+		} else {
+			addDenialReasons(explanations, reasons)
+		}
+	}
+
+	logDeniedActions(ctx, s.Logger, subject, explanations)
+
+	return grantedScopes, nil
+}
+
+func hasDeniedActions(explanations []ScopeExplanation) bool {
+	for _, explanation := range explanations {
+		for _, action := range explanation.Actions {
+			if !action.Granted {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// addDenialReasons copies the reasons of denied actions from the explanations of an [Explainer].
+func addDenialReasons(explanations []ScopeExplanation, reasons []ScopeExplanation) {
+	for i, explanation := range explanations {
+		if i >= len(reasons) || reasons[i].Resource != explanation.Resource {
+			continue
+		}
+
+		for j, action := range explanation.Actions {
+			if action.Granted {
+				continue
+			}
+
+			for _, reason := range reasons[i].Actions {
+				if reason.Action == action.Action && !reason.Granted {
+					explanation.Actions[j].Reason = reason.Reason
+
+					break
+				}
+			}
+		}
+	}
+}
+
+func logDeniedActions(ctx context.Context, logger *slog.Logger, subject Subject, explanations []ScopeExplanation) {
+	var subjectID string
+	if !IsAnonymous(subject) {
+		subjectID = subject.ID().String()
+	}
+
+	for _, explanation := range explanations {
+		for _, action := range explanation.Actions {
+			if action.Granted {
+				continue
+			}
+
+			logger.InfoContext(ctx, "action denied",
+				slog.String("subject", subjectID),
+				slog.String("resource_type", explanation.Type),
+				slog.String("resource_name", explanation.Name),
+				slog.String("action", action.Action),
+				slog.String("reason", action.Reason),
+			)
+		}
+	}
+}
+
+// Explain implements [ExplainService] and logs every request.
+func (s LoggerAuthorizationService) Explain(ctx context.Context, r TokenRequest) (ExplainResponse, error) {
+	service, ok := s.Service.(ExplainService)
+	if !ok {
+		return ExplainResponse{}, errExplainUnsupported
+	}
+
+	resp, err := service.Explain(ctx, r)
+
+	logger := s.Logger.With(
+		// TODO: correlation ID
+		slog.String("client_id", r.ClientID),
+		slog.String("service", r.Service),
+		slog.String("scopes", r.Scopes.String()),
+	)
+
+	if err != nil && !isClientError(err) {
+		logger.Error("explaining authorization failed", slog.Any("error", err))
+	} else if err != nil {
+		logger.Info("explaining authorization failed due to client error", slog.Any("error", err))
+	} else {
+		logger.Info("authorization explained", slog.String("subject", resp.Subject), slog.Any("explanations", resp.Scopes))
+	}
+
+	return resp, err
+}
@@ -3,6 +3,7 @@ package auth
 import (
 	"cmp"
 	"fmt"
+	"path"
 	"regexp"
 	"slices"
 	"strings"
@@ -166,3 +167,59 @@ func splitResourceClass(t string) (string, string) {
 
 	return matches[1], matches[2][1 : len(matches[2])-1]
 }
+
+// IntersectScopes limits scopes to the actions allowed by bounds.
+//
+// A bound applies to a scope if their resource types are equal and the resource name matches the bound name.
+// Bound names may contain wildcards following the syntax of [path.Match] (eg. "team/*").
+// A bound action "*" allows every action.
+//
+// Scopes with no remaining actions are omitted from the result.
+func IntersectScopes(scopes []Scope, bounds []Scope) []Scope {
+	result := make([]Scope, 0, len(scopes))
+
+	for _, scope := range scopes {
+		var actions []string
+
+		for _, action := range scope.Actions {
+			if slices.ContainsFunc(bounds, func(bound Scope) bool { return bound.allows(scope.Resource, action) }) {
+				actions = append(actions, action)
+			}
+		}
+
+		if len(actions) == 0 {
+			continue
+		}
+
+		scope.Actions = actions
+
+		result = append(result, scope)
+	}
+
+	return result
+}
+
+// ScopesWithin checks if every action of scopes is allowed by bounds (following the rules of [IntersectScopes]).
+func ScopesWithin(scopes []Scope, bounds []Scope) bool {
+	for _, scope := range scopes {
+		for _, action := range scope.Actions {
+			if !slices.ContainsFunc(bounds, func(bound Scope) bool { return bound.allows(scope.Resource, action) }) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func (s Scope) allows(resource Resource, action string) bool {
+	if s.Type != resource.Type {
+		return false
+	}
+
+	if ok, _ := path.Match(s.Name, resource.Name); !ok {
+		return false
+	}
+
+	return slices.Contains(s.Actions, "*") || slices.Contains(s.Actions, action)
+}
@@ -445,3 +445,66 @@ func TestScopes_String(t *testing.T) {
 
 	assert.Equal(t, expected, scopes.String())
 }
+
+func TestIntersectScopes(t *testing.T) {
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "team/repo",
+			},
+			Actions: []string{"pull", "push", "delete"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "other/repo",
+			},
+			Actions: []string{"pull"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: "catalog",
+			},
+			Actions: []string{"*"},
+		},
+	}
+
+	bounds := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "team/*",
+			},
+			Actions: []string{"pull", "push"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: "catalog",
+			},
+			Actions: []string{"*"},
+		},
+	}
+
+	expected := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "team/repo",
+			},
+			Actions: []string{"pull", "push"},
+		},
+		{
+			Resource: auth.Resource{
+				Type: "registry",
+				Name: "catalog",
+			},
+			Actions: []string{"*"},
+		},
+	}
+
+	assert.Equal(t, expected, auth.IntersectScopes(scopes, bounds))
+	assert.Empty(t, auth.IntersectScopes(scopes, nil))
+}
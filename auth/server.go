@@ -1,10 +1,15 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/gorilla/schema"
 )
@@ -27,6 +32,33 @@ type AuthorizationServer struct {
 }
 
 func httpHandleError(err error, w http.ResponseWriter) {
+	var oauth2Err OAuth2Error
+	if errors.As(err, &oauth2Err) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+
+		if oauth2Err.Code == OAuth2ErrorInvalidClient {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+
+		_ = json.NewEncoder(w).Encode(oauth2Err)
+
+		return
+	}
+
+	if errors.Is(err, ErrTooManyAttempts) {
+		var tooManyAttemptsErr TooManyAttemptsError
+		if errors.As(err, &tooManyAttemptsErr) && tooManyAttemptsErr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooManyAttemptsErr.RetryAfter.Seconds()))))
+		}
+
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+
+		return
+	}
+
 	if errors.Is(err, ErrAuthenticationFailed) {
 		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 
@@ -36,6 +68,24 @@ func httpHandleError(err error, w http.ResponseWriter) {
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
 
+// withClientInfo attaches information about the client to the request context (unless a preceding middleware already did).
+func withClientInfo(r *http.Request) context.Context {
+	ctx := r.Context()
+
+	if _, ok := ClientInfoFromContext(ctx); ok {
+		return ctx
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return ContextWithClientInfo(ctx, ClientInfo{
+		IP: ip,
+	})
+}
+
 func (s AuthorizationServer) handleError(err error) {
 	if s.ErrorHandler == nil {
 		return
@@ -56,7 +106,7 @@ func (s AuthorizationServer) TokenHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	response, err := s.Service.TokenHandler(r.Context(), request)
+	response, err := s.Service.TokenHandler(withClientInfo(r), request)
 	if err != nil {
 		httpHandleError(err, w)
 		return
@@ -117,7 +167,7 @@ func (s AuthorizationServer) OAuth2Handler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	response, err := s.Service.OAuth2Handler(r.Context(), request)
+	response, err := s.Service.OAuth2Handler(withClientInfo(r), request)
 	if err != nil {
 		httpHandleError(err, w)
 		return
@@ -158,6 +208,31 @@ func decodeOAuth2Request(r *http.Request) (OAuth2Request, error) {
 		Username:     rawRequest.Username,
 		Password:     rawRequest.Password,
 		RefreshToken: rawRequest.RefreshToken,
+		DeviceCode:   rawRequest.DeviceCode,
+		ClientSecret: rawRequest.ClientSecret,
+
+		SubjectToken:     rawRequest.SubjectToken,
+		SubjectTokenType: rawRequest.SubjectTokenType,
+	}
+
+	// Clients may authenticate using basic auth instead of form parameters (RFC 6749, section 2.3.1)
+	if username, password, ok := r.BasicAuth(); ok {
+		clientID, err := url.QueryUnescape(username)
+		if err != nil {
+			return OAuth2Request{}, err
+		}
+
+		clientSecret, err := url.QueryUnescape(password)
+		if err != nil {
+			return OAuth2Request{}, err
+		}
+
+		if request.ClientID != "" && request.ClientID != clientID {
+			return OAuth2Request{}, OAuth2Error{Code: OAuth2ErrorInvalidRequest, Description: "client_id does not match basic auth credentials"}
+		}
+
+		request.ClientID = clientID
+		request.ClientSecret = clientSecret
 	}
 
 	return request, nil
@@ -174,6 +249,136 @@ type rawOAuth2Request struct {
 	Username     string `schema:"username"`
 	Password     string `schema:"password"`
 	RefreshToken string `schema:"refresh_token"`
+	DeviceCode   string `schema:"device_code"`
+	ClientSecret string `schema:"client_secret"`
+
+	SubjectToken     string `schema:"subject_token"`
+	SubjectTokenType string `schema:"subject_token_type"`
+}
+
+// DeviceAuthorizationHandler implements the device authorization endpoint of the [OAuth 2.0 Device Authorization Grant].
+//
+// It responds with 404 if the service does not implement [DeviceAuthorizationService].
+//
+// [OAuth 2.0 Device Authorization Grant]: https://datatracker.ietf.org/doc/html/rfc8628
+func (s AuthorizationServer) DeviceAuthorizationHandler(w http.ResponseWriter, r *http.Request) {
+	service, ok := s.Service.(DeviceAuthorizationService)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	request, err := decodeDeviceAuthorizationRequest(r)
+	if err != nil {
+		s.handleError(fmt.Errorf("decoding device authorization request: %w", err))
+		httpHandleError(err, w)
+
+		return
+	}
+
+	response, err := service.DeviceAuthorizationHandler(withClientInfo(r), request)
+	if err != nil {
+		httpHandleError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		s.handleError(fmt.Errorf("encoding device authorization response: %w", err))
+	}
+}
+
+func decodeDeviceAuthorizationRequest(r *http.Request) (DeviceAuthorizationRequest, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return DeviceAuthorizationRequest{}, OAuth2Error{Code: OAuth2ErrorInvalidRequest, Description: err.Error()}
+	}
+
+	var rawRequest rawDeviceAuthorizationRequest
+
+	err = decoder.Decode(&rawRequest, r.PostForm)
+	if err != nil {
+		return DeviceAuthorizationRequest{}, OAuth2Error{Code: OAuth2ErrorInvalidRequest, Description: err.Error()}
+	}
+
+	scopes, err := ParseScopes(rawRequest.Scopes)
+	if err != nil {
+		return DeviceAuthorizationRequest{}, OAuth2Error{Code: OAuth2ErrorInvalidRequest, Description: err.Error()}
+	}
+
+	request := DeviceAuthorizationRequest{
+		Service:  rawRequest.Service,
+		ClientID: rawRequest.ClientID,
+		Scopes:   scopes,
+	}
+
+	return request, nil
+}
+
+type rawDeviceAuthorizationRequest struct {
+	Service  string   `schema:"service"`
+	ClientID string   `schema:"client_id"`
+	Scopes   []string `schema:"scope"`
+}
+
+// ExplainHandler reports the authorization decision about a token request without issuing a token (dry-run).
+//
+// It accepts the same parameters as [AuthorizationServer.TokenHandler] and requires credentials (basic auth).
+// The response contains an explanation for every requested scope (see [ExplainResponse]).
+//
+// It responds with 404 if the service does not implement [ExplainService].
+func (s AuthorizationServer) ExplainHandler(w http.ResponseWriter, r *http.Request) {
+	service, ok := s.Service.(ExplainService)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	request, err := decodeTokenRequest(r)
+	if err != nil {
+		s.handleError(fmt.Errorf("decoding explain request: %w", err))
+		httpHandleError(err, w)
+
+		return
+	}
+
+	response, err := service.Explain(withClientInfo(r), request)
+	if errors.Is(err, errExplainUnsupported) {
+		http.NotFound(w, r)
+
+		return
+	} else if err != nil {
+		if !isClientError(err) {
+			s.handleError(fmt.Errorf("explaining token request: %w", err))
+		}
+
+		httpHandleError(err, w)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		s.handleError(fmt.Errorf("encoding explain response: %w", err))
+	}
 }
 
 // ServeHTTP implements the [http.Handler] interface.
@@ -182,6 +387,9 @@ type rawOAuth2Request struct {
 // Otherwise, register the handler in an HTTP router directly:
 //   - GET / -> [AuthorizationServer.TokenHandler]
 //   - POST / -> [AuthorizationServer.OAuth2Handler]
+//
+// The device authorization endpoint has to be registered separately (eg. POST /device -> [AuthorizationServer.DeviceAuthorizationHandler]).
+// So does the explain endpoint (eg. GET /explain -> [AuthorizationServer.ExplainHandler]).
 func (s AuthorizationServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
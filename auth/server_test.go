@@ -2,8 +2,11 @@ package auth_test
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
+	"log/slog"
 	"maps"
 	"net/http"
 	"net/http/httptest"
@@ -20,6 +23,9 @@ import (
 
 	"github.com/portward/registry-auth/auth"
 	"github.com/portward/registry-auth/auth/authn"
+	"github.com/portward/registry-auth/auth/authn/device"
+	"github.com/portward/registry-auth/auth/authn/oidc"
+	"github.com/portward/registry-auth/auth/authn/pat"
 	"github.com/portward/registry-auth/auth/authz"
 	"github.com/portward/registry-auth/auth/token/jwt"
 )
@@ -486,4 +492,1182 @@ func TestAuthorizationServer(t *testing.T) {
 			})
 		}
 	})
+	t.Run("AnonymousPull", func(t *testing.T) {
+		t.Parallel()
+
+		request, err := http.NewRequest(http.MethodGet, httpServer.URL, nil)
+		require.NoError(t, err)
+
+		query := request.URL.Query()
+
+		query.Add("service", "service.example.com")
+		query.Add("scope", "repository:library/alpine:pull,push")
+		query.Add("offline_token", "true")
+
+		request.URL.RawQuery = query.Encode()
+
+		response, err := httpServer.Client().Do(request)
+		require.NoError(t, err)
+
+		defer response.Body.Close()
+
+		require.Equal(t, http.StatusOK, response.StatusCode)
+
+		var actual auth.TokenResponse
+
+		err = json.NewDecoder(response.Body).Decode(&actual)
+		require.NoError(t, err)
+
+		assert.Empty(t, actual.RefreshToken)
+
+		parts := strings.Split(actual.Token, ".")
+		require.Len(t, parts, 3)
+
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+
+		var claims struct {
+			Subject string       `json:"sub"`
+			Access  []auth.Scope `json:"access"`
+		}
+
+		err = json.Unmarshal(payload, &claims)
+		require.NoError(t, err)
+
+		expected := []auth.Scope{
+			{
+				Resource: auth.Resource{
+					Type: "repository",
+					Name: "library/alpine",
+				},
+				Actions: []string{"pull"},
+			},
+		}
+
+		assert.Empty(t, claims.Subject)
+		assert.Equal(t, expected, claims.Access)
+	})
+}
+
+type authorizationServiceStub struct {
+	err error
+
+	clientInfo auth.ClientInfo
+}
+
+func (s *authorizationServiceStub) TokenHandler(ctx context.Context, _ auth.TokenRequest) (auth.TokenResponse, error) {
+	s.clientInfo, _ = auth.ClientInfoFromContext(ctx)
+
+	return auth.TokenResponse{}, s.err
+}
+
+func (s *authorizationServiceStub) OAuth2Handler(ctx context.Context, _ auth.OAuth2Request) (auth.OAuth2Response, error) {
+	s.clientInfo, _ = auth.ClientInfoFromContext(ctx)
+
+	return auth.OAuth2Response{}, s.err
+}
+
+func TestAuthorizationServer_TooManyAttempts(t *testing.T) {
+	service := &authorizationServiceStub{
+		err: auth.TooManyAttemptsError{RetryAfter: 1500 * time.Millisecond},
+	}
+
+	server := auth.AuthorizationServer{
+		Service: service,
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/?service=service.example.com", nil)
+	request.RemoteAddr = "10.0.0.1:1234"
+	request.SetBasicAuth("user", "password")
+
+	recorder := httptest.NewRecorder()
+
+	server.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, "10.0.0.1", service.clientInfo.IP)
+}
+
+func TestAuthorizationServer_RefreshTokenRotation(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	userAuthenticator := authn.NewUserAuthenticator([]authn.User{
+		{
+			Enabled:      true,
+			Username:     "user",
+			PasswordHash: string(passwordHash),
+		},
+	})
+
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	refreshTokenIssuer := jwt.NewRefreshTokenIssuer("issuer.example.com", signingKey, jwt.WithRefreshTokenStore(jwt.NewInMemoryRefreshTokenStore()))
+
+	server := auth.AuthorizationServer{
+		Service: auth.AuthorizationServiceImpl{
+			Authenticator: auth.Authenticator{
+				PasswordAuthenticator:     userAuthenticator,
+				RefreshTokenAuthenticator: authn.NewRefreshTokenAuthenticator(refreshTokenIssuer, userAuthenticator),
+			},
+			Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+			TokenIssuer: auth.TokenIssuer{
+				AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute),
+				RefreshTokenIssuer: refreshTokenIssuer,
+			},
+		},
+	}
+
+	exchange := func(t *testing.T, form url.Values) (auth.OAuth2Response, int) {
+		t.Helper()
+
+		form.Set("service", "service.example.com")
+		form.Set("client_id", "test")
+
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		var response auth.OAuth2Response
+
+		if recorder.Code == http.StatusOK {
+			err := json.NewDecoder(recorder.Body).Decode(&response)
+			require.NoError(t, err)
+		}
+
+		return response, recorder.Code
+	}
+
+	response, code := exchange(t, url.Values{
+		"grant_type":  {"password"},
+		"access_type": {"offline"},
+		"username":    {"user"},
+		"password":    {"password"},
+	})
+	require.Equal(t, http.StatusOK, code)
+	require.NotEmpty(t, response.RefreshToken)
+
+	originalToken := response.RefreshToken
+
+	response, code = exchange(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {originalToken},
+	})
+	require.Equal(t, http.StatusOK, code)
+	require.NotEmpty(t, response.RefreshToken)
+
+	rotatedToken := response.RefreshToken
+
+	assert.NotEqual(t, originalToken, rotatedToken)
+
+	// Replay of the original token is detected...
+	_, code = exchange(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {originalToken},
+	})
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// ...and the whole family is revoked
+	_, code = exchange(t, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {rotatedToken},
+	})
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestAuthorizationServer_PersonalAccessToken(t *testing.T) {
+	user := authn.User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	userAuthenticator := authn.NewUserAuthenticator([]authn.User{user})
+
+	patService := pat.NewService(pat.NewInMemoryStore(), userAuthenticator)
+
+	secret, _, err := patService.CreateToken(context.Background(), pat.CreateTokenRequest{
+		SubjectID: user.ID(),
+		Name:      "ci",
+		Scopes: []auth.Scope{
+			{
+				Resource: auth.Resource{
+					Type: "repository",
+					Name: "user/app",
+				},
+				Actions: []string{"pull"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	refreshTokenIssuer := jwt.NewRefreshTokenIssuer("issuer.example.com", signingKey)
+
+	server := auth.AuthorizationServer{
+		Service: auth.AuthorizationServiceImpl{
+			Authenticator: auth.Authenticator{
+				PasswordAuthenticator:     patService,
+				RefreshTokenAuthenticator: authn.NewRefreshTokenAuthenticator(refreshTokenIssuer, userAuthenticator),
+			},
+			Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+			TokenIssuer: auth.TokenIssuer{
+				AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute),
+				RefreshTokenIssuer: refreshTokenIssuer,
+			},
+		},
+	}
+
+	t.Run("TokenHandler", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/?service=service.example.com&client_id=test&offline_token=true&scope=repository:user/app:pull,push", nil)
+		request.SetBasicAuth("user", secret)
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var response auth.TokenResponse
+
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, response.Token)
+
+		// The owner's refresh token would not be bound by the scopes of the personal access token
+		assert.Empty(t, response.RefreshToken)
+	})
+
+	t.Run("OAuth2Handler", func(t *testing.T) {
+		form := url.Values{
+			"service":     {"service.example.com"},
+			"client_id":   {"test"},
+			"grant_type":  {"password"},
+			"access_type": {"offline"},
+			"username":    {"user"},
+			"password":    {secret},
+			"scope":       {"repository:user/app:pull,push"},
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var response auth.OAuth2Response
+
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		require.NoError(t, err)
+
+		assert.Equal(t, "repository:user/app:pull", response.Scope)
+		assert.Empty(t, response.RefreshToken)
+	})
+}
+
+type passwordAuthenticatorStub struct {
+	subject auth.Subject
+}
+
+func (a passwordAuthenticatorStub) AuthenticatePassword(_ context.Context, _ string, _ string) (auth.Subject, error) {
+	return a.subject, nil
+}
+
+func TestAuthorizationServer_TransientSubject(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	service := auth.AuthorizationServiceImpl{
+		Authenticator: auth.Authenticator{
+			PasswordAuthenticator: passwordAuthenticatorStub{oidc.Subject{Provider: "github", Subject: "repo:org/repo:ref:refs/heads/main"}},
+		},
+		Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+		TokenIssuer: auth.TokenIssuer{
+			AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute),
+			RefreshTokenIssuer: jwt.NewRefreshTokenIssuer("issuer.example.com", signingKey),
+		},
+	}
+
+	response, err := service.OAuth2Handler(context.Background(), auth.OAuth2Request{
+		GrantType:  auth.GrantTypePassword,
+		Service:    "service.example.com",
+		ClientID:   "test",
+		AccessType: auth.AccessTypeOffline,
+		Username:   "oidc",
+		Password:   "token",
+	})
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, response.Token)
+
+	// The subject could not be reloaded on refresh
+	assert.Empty(t, response.RefreshToken)
+}
+
+func TestAuthorizationServer_DeviceAuthorization(t *testing.T) {
+	user := authn.User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	userAuthenticator := authn.NewUserAuthenticator([]authn.User{user})
+
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	clock := clockwork.NewFakeClock()
+
+	deviceService := device.NewService(device.NewInMemoryStore(), userAuthenticator, "https://auth.example.com/device", device.WithClock(clock))
+
+	refreshTokenIssuer := jwt.NewRefreshTokenIssuer("issuer.example.com", signingKey)
+
+	server := auth.AuthorizationServer{
+		Service: auth.AuthorizationServiceImpl{
+			Authenticator: auth.Authenticator{
+				PasswordAuthenticator:     userAuthenticator,
+				RefreshTokenAuthenticator: authn.NewRefreshTokenAuthenticator(refreshTokenIssuer, userAuthenticator),
+			},
+			Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+			TokenIssuer: auth.TokenIssuer{
+				AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute),
+				RefreshTokenIssuer: refreshTokenIssuer,
+			},
+			DeviceAuthorizer: deviceService,
+		},
+	}
+
+	post := func(t *testing.T, handler http.HandlerFunc, form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+
+		form.Set("service", "service.example.com")
+		form.Set("client_id", "test")
+
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+
+		handler(recorder, request)
+
+		return recorder
+	}
+
+	recorder := post(t, server.DeviceAuthorizationHandler, url.Values{})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var deviceResponse auth.DeviceAuthorizationResponse
+
+	err = json.NewDecoder(recorder.Body).Decode(&deviceResponse)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, deviceResponse.DeviceCode)
+	assert.Equal(t, "https://auth.example.com/device", deviceResponse.VerificationURI)
+
+	poll := func(t *testing.T) *httptest.ResponseRecorder {
+		t.Helper()
+
+		return post(t, server.ServeHTTP, url.Values{
+			"grant_type":  {auth.GrantTypeDeviceCode},
+			"device_code": {deviceResponse.DeviceCode},
+		})
+	}
+
+	assertOAuth2Error := func(t *testing.T, recorder *httptest.ResponseRecorder, code string) {
+		t.Helper()
+
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		var oauth2Err auth.OAuth2Error
+
+		err := json.NewDecoder(recorder.Body).Decode(&oauth2Err)
+		require.NoError(t, err)
+
+		assert.Equal(t, code, oauth2Err.Code)
+	}
+
+	assertOAuth2Error(t, poll(t), auth.OAuth2ErrorAuthorizationPending)
+	assertOAuth2Error(t, poll(t), auth.OAuth2ErrorSlowDown)
+
+	err = deviceService.Approve(context.Background(), deviceResponse.UserCode, user.ID())
+	require.NoError(t, err)
+
+	clock.Advance(time.Minute)
+
+	recorder = poll(t)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var response auth.OAuth2Response
+
+	err = json.NewDecoder(recorder.Body).Decode(&response)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, response.Token)
+	require.NotEmpty(t, response.RefreshToken)
+
+	// The device code can only be used once
+	assertOAuth2Error(t, poll(t), auth.OAuth2ErrorInvalidGrant)
+
+	// The refresh token serves as an identity token
+	recorder = post(t, server.ServeHTTP, url.Values{
+		"grant_type":    {auth.GrantTypeRefreshToken},
+		"refresh_token": {response.RefreshToken},
+	})
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestAuthorizationServer_ClientCredentials(t *testing.T) {
+	secretHash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	clientRegistry := authn.NewClientRegistry([]authn.Client{
+		{
+			Enabled:    true,
+			ClientID:   "deploy-bot",
+			SecretHash: string(secretHash),
+			Scopes: []auth.Scope{
+				{
+					Resource: auth.Resource{
+						Type: "repository",
+						Name: "deploy-bot/*",
+					},
+					Actions: []string{"pull"},
+				},
+			},
+		},
+	})
+
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	server := auth.AuthorizationServer{
+		Service: auth.AuthorizationServiceImpl{
+			Authenticator: auth.Authenticator{
+				ClientAuthenticator: clientRegistry,
+			},
+			Authorizer: authz.NewDefaultAuthorizer(authz.NewRBACRepositoryAuthorizer(authz.NewInMemoryRoleBindingStore(
+				authz.RoleBinding{
+					Role:       authz.RoleAdmin,
+					Repository: "deploy-bot/*",
+					Subjects:   []string{"client:deploy-bot"},
+				},
+			)), false),
+			TokenIssuer: auth.TokenIssuer{
+				AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute),
+				RefreshTokenIssuer: jwt.NewRefreshTokenIssuer("issuer.example.com", signingKey),
+			},
+		},
+	}
+
+	exchange := func(t *testing.T, form url.Values, basicAuth bool) (auth.OAuth2Response, int) {
+		t.Helper()
+
+		form.Set("grant_type", auth.GrantTypeClientCredentials)
+		form.Set("service", "service.example.com")
+		form.Set("access_type", "offline")
+		form.Set("scope", "repository:deploy-bot/app:pull,push")
+
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if basicAuth {
+			request.SetBasicAuth("deploy-bot", "secret")
+		}
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		var response auth.OAuth2Response
+
+		if recorder.Code == http.StatusOK {
+			err := json.NewDecoder(recorder.Body).Decode(&response)
+			require.NoError(t, err)
+		}
+
+		return response, recorder.Code
+	}
+
+	t.Run("BasicAuth", func(t *testing.T) {
+		response, code := exchange(t, url.Values{}, true)
+		require.Equal(t, http.StatusOK, code)
+
+		// Push is not part of the client registration
+		assert.Equal(t, "repository:deploy-bot/app:pull", response.Scope)
+		assert.Empty(t, response.RefreshToken)
+	})
+
+	t.Run("Form", func(t *testing.T) {
+		response, code := exchange(t, url.Values{
+			"client_id":     {"deploy-bot"},
+			"client_secret": {"secret"},
+		}, false)
+		require.Equal(t, http.StatusOK, code)
+
+		assert.Equal(t, "repository:deploy-bot/app:pull", response.Scope)
+	})
+
+	t.Run("InvalidSecret", func(t *testing.T) {
+		_, code := exchange(t, url.Values{
+			"client_id":     {"deploy-bot"},
+			"client_secret": {"other"},
+		}, false)
+
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("ClientIDMismatch", func(t *testing.T) {
+		_, code := exchange(t, url.Values{
+			"client_id": {"other"},
+		}, true)
+
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func TestAuthorizationServer_TokenExchange(t *testing.T) {
+	user := authn.User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	user.PasswordHash = string(passwordHash)
+
+	userAuthenticator := authn.NewUserAuthenticator([]authn.User{user})
+
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	clock := clockwork.NewFakeClockAt(time.Unix(1257894000, 0))
+
+	refreshTokenIssuer := jwt.NewRefreshTokenIssuer(
+		"issuer.example.com",
+		signingKey,
+		jwt.WithClock(clock),
+		jwt.WithRefreshTokenStore(jwt.NewInMemoryRefreshTokenStore()),
+	)
+
+	service := auth.AuthorizationServiceImpl{
+		Authenticator: auth.Authenticator{
+			PasswordAuthenticator:     userAuthenticator,
+			RefreshTokenAuthenticator: authn.NewRefreshTokenAuthenticator(refreshTokenIssuer, userAuthenticator),
+		},
+		Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+		TokenIssuer: auth.TokenIssuer{
+			AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute, jwt.WithClock(clock)),
+			RefreshTokenIssuer: refreshTokenIssuer,
+		},
+		ClientRegistry: authn.NewClientRegistry([]authn.Client{
+			{
+				Enabled:  true,
+				ClientID: "orchestrator",
+			},
+		}),
+		SubjectRepository: userAuthenticator,
+	}
+
+	exchangeWith := func(t *testing.T, service auth.AuthorizationServiceImpl, form url.Values) (auth.OAuth2Response, *httptest.ResponseRecorder) {
+		t.Helper()
+
+		server := auth.AuthorizationServer{
+			Service: service,
+		}
+
+		form.Set("service", "service.example.com")
+		form.Set("client_id", "orchestrator")
+
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		var response auth.OAuth2Response
+
+		if recorder.Code == http.StatusOK {
+			err := json.NewDecoder(recorder.Body).Decode(&response)
+			require.NoError(t, err)
+		}
+
+		return response, recorder
+	}
+
+	exchange := func(t *testing.T, form url.Values) (auth.OAuth2Response, *httptest.ResponseRecorder) {
+		t.Helper()
+
+		return exchangeWith(t, service, form)
+	}
+
+	type claims struct {
+		Subject string       `json:"sub"`
+		Access  []auth.Scope `json:"access"`
+		Actor   *auth.Actor  `json:"act"`
+	}
+
+	decodeClaims := func(t *testing.T, token string) claims {
+		t.Helper()
+
+		parts := strings.Split(token, ".")
+		require.Len(t, parts, 3)
+
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		require.NoError(t, err)
+
+		var c claims
+
+		err = json.Unmarshal(payload, &c)
+		require.NoError(t, err)
+
+		return c
+	}
+
+	response, recorder := exchange(t, url.Values{
+		"grant_type":  {"password"},
+		"access_type": {"offline"},
+		"username":    {"user"},
+		"password":    {"password"},
+		"scope":       {"repository:user/app:pull,push", "repository:user/lib:pull"},
+	})
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	accessToken := response.Token
+	refreshToken := response.RefreshToken
+
+	t.Run("AccessToken", func(t *testing.T) {
+		response, recorder := exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {accessToken},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+			"scope":              {"repository:user/app:pull"},
+		})
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		assert.Equal(t, "repository:user/app:pull", response.Scope)
+		assert.Equal(t, auth.TokenTypeAccessToken, response.IssuedTokenType)
+		assert.Empty(t, response.RefreshToken)
+
+		c := decodeClaims(t, response.Token)
+
+		assert.Equal(t, "user", c.Subject)
+		assert.Equal(t, &auth.Actor{Subject: "orchestrator"}, c.Actor)
+
+		// Exchanging an exchanged token nests actors
+		response, recorder = exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {response.Token},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+		})
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		assert.Equal(t, "repository:user/app:pull", response.Scope)
+
+		c = decodeClaims(t, response.Token)
+
+		assert.Equal(t, &auth.Actor{Subject: "orchestrator", Actor: &auth.Actor{Subject: "orchestrator"}}, c.Actor)
+	})
+
+	t.Run("NotAfter", func(t *testing.T) {
+		clock.Advance(40 * time.Second)
+		defer clock.Advance(-time.Minute)
+
+		// Exchanged tokens never outlive the subject token
+		response, recorder := exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {accessToken},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+		})
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		assert.Equal(t, 20, response.ExpiresIn)
+
+		clock.Advance(20 * time.Second)
+
+		_, recorder = exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {response.Token},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+		})
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("SubjectRemoved", func(t *testing.T) {
+		service := service
+		service.SubjectRepository = authn.NewUserAuthenticator(nil)
+
+		_, recorder := exchangeWith(t, service, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {accessToken},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+		})
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("RefreshToken", func(t *testing.T) {
+		response, recorder := exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {refreshToken},
+			"subject_token_type": {auth.TokenTypeRefreshToken},
+			"scope":              {"repository:user/other:push"},
+		})
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		assert.Equal(t, "repository:user/other:push", response.Scope)
+
+		// Refresh tokens are rotated
+		require.NotEmpty(t, response.RefreshToken)
+		assert.NotEqual(t, refreshToken, response.RefreshToken)
+
+		_, recorder = exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {refreshToken},
+			"subject_token_type": {auth.TokenTypeRefreshToken},
+		})
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+
+	t.Run("UnregisteredClient", func(t *testing.T) {
+		service := service
+		service.ClientRegistry = nil
+
+		_, recorder := exchangeWith(t, service, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {accessToken},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+		})
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		var oauth2Err auth.OAuth2Error
+
+		err := json.NewDecoder(recorder.Body).Decode(&oauth2Err)
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.OAuth2ErrorUnsupportedGrantType, oauth2Err.Code)
+	})
+
+	t.Run("ScopeExceeded", func(t *testing.T) {
+		_, recorder := exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {accessToken},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+			"scope":              {"repository:user/lib:pull,push"},
+		})
+		require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		var oauth2Err auth.OAuth2Error
+
+		err := json.NewDecoder(recorder.Body).Decode(&oauth2Err)
+		require.NoError(t, err)
+
+		assert.Equal(t, auth.OAuth2ErrorInvalidScope, oauth2Err.Code)
+	})
+
+	t.Run("InvalidToken", func(t *testing.T) {
+		_, recorder := exchange(t, url.Values{
+			"grant_type":         {auth.GrantTypeTokenExchange},
+			"subject_token":      {"invalid"},
+			"subject_token_type": {auth.TokenTypeAccessToken},
+		})
+
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	})
+}
+
+func TestAuthorizationServer_ClientRegistry(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	userAuthenticator := authn.NewUserAuthenticator([]authn.User{
+		{
+			Enabled:      true,
+			Username:     "user",
+			PasswordHash: string(passwordHash),
+		},
+	})
+
+	clientRegistry := authn.NewClientRegistry([]authn.Client{
+		{
+			Enabled:    true,
+			ClientID:   "docker",
+			GrantTypes: []string{auth.GrantTypePassword, auth.GrantTypeRefreshToken},
+			Scopes: []auth.Scope{
+				{
+					Resource: auth.Resource{
+						Type: "repository",
+						Name: "*/*",
+					},
+					Actions: []string{"pull"},
+				},
+			},
+			AccessTokenExpiration: 5 * time.Minute,
+		},
+		{
+			Enabled:     true,
+			ClientID:    "ui",
+			AccessTypes: []string{auth.AccessTypeOnline},
+		},
+	})
+
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	server := auth.AuthorizationServer{
+		Service: auth.AuthorizationServiceImpl{
+			Authenticator: auth.Authenticator{
+				PasswordAuthenticator: userAuthenticator,
+				ClientAuthenticator:   clientRegistry,
+			},
+			Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+			TokenIssuer: auth.TokenIssuer{
+				AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute),
+				RefreshTokenIssuer: jwt.NewRefreshTokenIssuer("issuer.example.com", signingKey),
+			},
+			ClientRegistry:  clientRegistry,
+			DefaultClientID: "docker",
+		},
+	}
+
+	exchange := func(t *testing.T, form url.Values) (auth.OAuth2Response, *httptest.ResponseRecorder) {
+		t.Helper()
+
+		form.Set("service", "service.example.com")
+		form.Set("username", "user")
+		form.Set("password", "password")
+		form.Set("scope", "repository:user/app:pull,push")
+
+		if !form.Has("grant_type") {
+			form.Set("grant_type", "password")
+		}
+
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		var response auth.OAuth2Response
+
+		if recorder.Code == http.StatusOK {
+			err := json.NewDecoder(recorder.Body).Decode(&response)
+			require.NoError(t, err)
+		}
+
+		return response, recorder
+	}
+
+	assertOAuth2Error := func(t *testing.T, recorder *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+
+		require.Equal(t, status, recorder.Code)
+
+		var oauth2Err auth.OAuth2Error
+
+		err := json.NewDecoder(recorder.Body).Decode(&oauth2Err)
+		require.NoError(t, err)
+
+		assert.Equal(t, code, oauth2Err.Code)
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		response, recorder := exchange(t, url.Values{
+			"client_id": {"docker"},
+		})
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		// Push exceeds the scope ceiling of the client
+		assert.Equal(t, "repository:user/app:pull", response.Scope)
+		assert.Equal(t, 300, response.ExpiresIn)
+	})
+
+	t.Run("UnknownClient", func(t *testing.T) {
+		_, recorder := exchange(t, url.Values{
+			"client_id": {"unknown"},
+		})
+
+		assertOAuth2Error(t, recorder, http.StatusUnauthorized, auth.OAuth2ErrorInvalidClient)
+	})
+
+	t.Run("GrantTypeNotAllowed", func(t *testing.T) {
+		_, recorder := exchange(t, url.Values{
+			"client_id":     {"docker"},
+			"client_secret": {"secret"},
+			"grant_type":    {auth.GrantTypeClientCredentials},
+		})
+
+		assertOAuth2Error(t, recorder, http.StatusBadRequest, auth.OAuth2ErrorUnauthorizedClient)
+	})
+
+	t.Run("AccessTypeNotAllowed", func(t *testing.T) {
+		_, recorder := exchange(t, url.Values{
+			"client_id":   {"ui"},
+			"access_type": {"offline"},
+		})
+
+		assertOAuth2Error(t, recorder, http.StatusBadRequest, auth.OAuth2ErrorUnauthorizedClient)
+	})
+
+	t.Run("TokenHandler", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/?service=service.example.com&client_id=unknown", nil)
+		request.SetBasicAuth("user", "password")
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		assertOAuth2Error(t, recorder, http.StatusUnauthorized, auth.OAuth2ErrorInvalidClient)
+	})
+
+	t.Run("TokenHandlerDefaultClient", func(t *testing.T) {
+		// docker login does not send a client ID
+		request := httptest.NewRequest(http.MethodGet, "/?service=service.example.com", nil)
+		request.SetBasicAuth("user", "password")
+
+		recorder := httptest.NewRecorder()
+
+		server.ServeHTTP(recorder, request)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var response auth.TokenResponse
+
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		require.NoError(t, err)
+
+		// The policy of the default client applies
+		assert.Equal(t, 300, response.ExpiresIn)
+	})
+}
+
+// explainerStub explains a different decision than the one it makes.
+type explainerStub struct {
+	err error
+}
+
+func (a explainerStub) Authorize(_ context.Context, _ auth.Subject, _ []auth.Scope) ([]auth.Scope, error) {
+	return []auth.Scope{}, a.err
+}
+
+func (a explainerStub) Explain(_ context.Context, _ auth.Subject, requestedScopes []auth.Scope) ([]auth.ScopeExplanation, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	explanations := make([]auth.ScopeExplanation, 0, len(requestedScopes))
+
+	for _, scope := range requestedScopes {
+		explanations = append(explanations, auth.ExplainScope(scope, true, "explained"))
+	}
+
+	return explanations, nil
+}
+
+type errorHandlerStub struct {
+	errs []error
+}
+
+func (h *errorHandlerStub) Handle(err error) {
+	h.errs = append(h.errs, err)
+}
+
+func TestAuthorizationServer_Explain(t *testing.T) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	userAuthenticator := authn.NewUserAuthenticator([]authn.User{
+		{
+			Enabled:      true,
+			Username:     "user",
+			PasswordHash: string(passwordHash),
+		},
+	})
+
+	clientRegistry := authn.NewClientRegistry([]authn.Client{
+		{
+			Enabled:  true,
+			ClientID: "docker",
+			Scopes: []auth.Scope{
+				{
+					Resource: auth.Resource{
+						Type: "repository",
+						Name: "*/*",
+					},
+					Actions: []string{"pull"},
+				},
+			},
+		},
+	})
+
+	signingKey, err := libtrust.LoadKeyFile("token/jwt/testdata/private.pem")
+	require.NoError(t, err)
+
+	var logs strings.Builder
+
+	service := auth.AuthorizationServiceImpl{
+		Authenticator: auth.Authenticator{
+			PasswordAuthenticator: userAuthenticator,
+		},
+		Authorizer: authz.NewDefaultAuthorizer(authz.NewDefaultRepositoryAuthorizer(false), false),
+		TokenIssuer: auth.TokenIssuer{
+			AccessTokenIssuer:  jwt.NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute),
+			RefreshTokenIssuer: jwt.NewRefreshTokenIssuer("issuer.example.com", signingKey),
+		},
+		ClientRegistry: clientRegistry,
+		Logger:         slog.New(slog.NewTextHandler(&logs, nil)),
+	}
+
+	server := auth.AuthorizationServer{
+		Service: service,
+	}
+
+	const query = "/explain?service=service.example.com&client_id=docker&scope=repository:user/app:pull,push&scope=repository:other/app:pull&scope=registry:catalog:*"
+
+	t.Run("OK", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, query, nil)
+		request.SetBasicAuth("user", "password")
+
+		recorder := httptest.NewRecorder()
+
+		server.ExplainHandler(recorder, request)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var response auth.ExplainResponse
+
+		err := json.NewDecoder(recorder.Body).Decode(&response)
+		require.NoError(t, err)
+
+		expected := auth.ExplainResponse{
+			Subject: "user",
+			Scopes: []auth.ScopeExplanation{
+				{
+					Resource: auth.Resource{Type: "repository", Name: "user/app"},
+					Actions: []auth.ActionExplanation{
+						{Action: "pull", Granted: true, Reason: "repository is in the namespace of the subject"},
+						{Action: "push", Reason: "not allowed by the client policy"},
+					},
+				},
+				{
+					Resource: auth.Resource{Type: "repository", Name: "other/app"},
+					Actions: []auth.ActionExplanation{
+						{Action: "pull", Reason: "repository is outside the namespace of the subject"},
+					},
+				},
+				{
+					Resource: auth.Resource{Type: "registry", Name: "catalog"},
+					Actions: []auth.ActionExplanation{
+						{Action: "*", Reason: "not allowed by the client policy"},
+					},
+				},
+			},
+			Scope: "repository:user/app:pull",
+		}
+
+		assert.Equal(t, expected, response)
+	})
+
+	t.Run("Logs", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, strings.Replace(query, "/explain", "/", 1), nil)
+		request.SetBasicAuth("user", "password")
+
+		recorder := httptest.NewRecorder()
+
+		server.TokenHandler(recorder, request)
+
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		assert.Contains(t, logs.String(), `msg="action denied" subject=user resource_type=repository resource_name=other/app action=pull reason="repository is outside the namespace of the subject"`)
+	})
+
+	t.Run("LoggerDoesNotChangeDecision", func(t *testing.T) {
+		service := service
+		service.Authorizer = explainerStub{}
+
+		response, err := service.OAuth2Handler(context.Background(), auth.OAuth2Request{
+			GrantType: auth.GrantTypePassword,
+			Service:   "service.example.com",
+			ClientID:  "docker",
+			Scopes:    auth.Scopes{{Resource: auth.Resource{Type: "repository", Name: "user/app"}, Actions: []string{"pull"}}},
+			Username:  "user",
+			Password:  "password",
+		})
+		require.NoError(t, err)
+
+		assert.Empty(t, response.Scope)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("Anonymous", func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, query, nil)
+
+			recorder := httptest.NewRecorder()
+
+			server.ExplainHandler(recorder, request)
+
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		})
+
+		t.Run("InvalidCredentials", func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, query, nil)
+			request.SetBasicAuth("user", "invalid")
+
+			recorder := httptest.NewRecorder()
+
+			server.ExplainHandler(recorder, request)
+
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		})
+
+		t.Run("ServiceError", func(t *testing.T) {
+			service := service
+			service.Authorizer = explainerStub{err: errors.New("authorizer unavailable")}
+
+			var errorHandler errorHandlerStub
+
+			server := auth.AuthorizationServer{
+				Service:      service,
+				ErrorHandler: &errorHandler,
+			}
+
+			request := httptest.NewRequest(http.MethodGet, query, nil)
+			request.SetBasicAuth("user", "password")
+
+			recorder := httptest.NewRecorder()
+
+			server.ExplainHandler(recorder, request)
+
+			assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+			assert.Len(t, errorHandler.errs, 1)
+		})
+
+		t.Run("Unsupported", func(t *testing.T) {
+			server := auth.AuthorizationServer{
+				Service: struct{ auth.AuthorizationService }{service},
+			}
+
+			request := httptest.NewRequest(http.MethodGet, query, nil)
+			request.SetBasicAuth("user", "password")
+
+			recorder := httptest.NewRecorder()
+
+			server.ExplainHandler(recorder, request)
+
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+		})
+	})
 }
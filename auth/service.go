@@ -42,10 +42,6 @@ func (r TokenRequest) Validate() error {
 		return errors.New("service is required")
 	}
 
-	if r.ClientID == "" { //nolint
-		// return errors.New("client ID is required")
-	}
-
 	return nil
 }
 
@@ -72,6 +68,11 @@ type OAuth2Request struct {
 	Username     string
 	Password     string
 	RefreshToken string
+	DeviceCode   string
+	ClientSecret string
+
+	SubjectToken     string
+	SubjectTokenType string
 }
 
 // TODO: oauth2 error
@@ -98,6 +99,28 @@ func (r OAuth2Request) Validate() error {
 		}
 	}
 
+	if r.GrantType == GrantTypeDeviceCode {
+		if r.DeviceCode == "" {
+			return errors.New("missing device_code value")
+		}
+	}
+
+	if r.GrantType == GrantTypeClientCredentials {
+		if r.ClientSecret == "" {
+			return errors.New("missing client_secret value")
+		}
+	}
+
+	if r.GrantType == GrantTypeTokenExchange {
+		if r.SubjectToken == "" {
+			return errors.New("missing subject_token value")
+		}
+
+		if !slices.Contains(validSubjectTokenTypes, r.SubjectTokenType) {
+			return errors.New("unknown subject_token_type value")
+		}
+	}
+
 	if r.GrantType == GrantTypePassword {
 		if r.Username == "" {
 			return errors.New("missing username value")
@@ -116,8 +139,9 @@ func (r OAuth2Request) Validate() error {
 }
 
 const (
-	GrantTypeRefreshToken = "refresh_token"
-	GrantTypePassword     = "password"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypePassword          = "password"
+	GrantTypeClientCredentials = "client_credentials"
 
 	AccessTypeOnline  = "online"
 	AccessTypeOffline = "offline"
@@ -126,6 +150,9 @@ const (
 var validGrantTypes = []string{
 	GrantTypeRefreshToken,
 	GrantTypePassword,
+	GrantTypeDeviceCode,
+	GrantTypeClientCredentials,
+	GrantTypeTokenExchange,
 }
 
 var validAccessTypes = []string{
@@ -143,6 +170,9 @@ type OAuth2Response struct {
 	ExpiresIn    int    `json:"expires_in,omitempty"`
 	IssuedAt     string `json:"issued_at,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// IssuedTokenType is only returned by the token exchange grant.
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
 }
 
 // AuthorizationServiceImpl implements the [Docker Registry v2 authentication] specification.
@@ -152,12 +182,38 @@ type AuthorizationServiceImpl struct {
 	Authenticator Authenticator
 	Authorizer    Authorizer
 	TokenIssuer   TokenIssuer
+
+	// DeviceAuthorizer enables the device authorization grant (optional).
+	DeviceAuthorizer DeviceAuthorizer
+
+	// ClientRegistry restricts requests to known clients (optional).
+	// It is consulted before authentication and authorization happen.
+	// Without it, the token exchange grant is not supported.
+	ClientRegistry ClientRegistry
+
+	// DefaultClientID is the client ID of token requests without one (optional).
+	// Clients (eg. docker) may not send a client ID to the token endpoint (see [AuthorizationServiceImpl.TokenHandler]):
+	// without a default client, the ClientRegistry rejects these requests.
+	//
+	// Requests to the token endpoint never carry a client secret: confidential clients have to use the OAuth2 endpoint.
+	DefaultClientID string
+
+	// SubjectRepository reloads the subject of exchanged access tokens (optional).
+	// Without it, access tokens cannot be exchanged.
+	SubjectRepository SubjectRepository
+
+	// Logger logs denied actions along with the reason (optional).
+	// Reasons are only available if the Authorizer implements [Explainer].
+	Logger *slog.Logger
 }
 
-// Authenticator is a facade combining a [PasswordAuthenticator] and a [RefreshTokenAuthenticator].
+// Authenticator is a facade combining a [PasswordAuthenticator], a [RefreshTokenAuthenticator] and a [ClientAuthenticator].
+//
+// ClientAuthenticator is optional: without it, the "client_credentials" grant is not supported.
 type Authenticator struct {
 	PasswordAuthenticator
 	RefreshTokenAuthenticator
+	ClientAuthenticator
 }
 
 // TokenIssuer is a facade combining an [AccessTokenIssuer] and a [RefreshTokenIssuer].
@@ -174,22 +230,44 @@ func (s AuthorizationServiceImpl) TokenHandler(ctx context.Context, r TokenReque
 		return TokenResponse{}, err
 	}
 
-	var subject Subject
+	if r.ClientID == "" {
+		r.ClientID = s.DefaultClientID
+	}
 
-	if !r.Anonymous {
-		var err error
+	ctx = contextWithClientID(ctx, r.ClientID)
+	ctx = ContextWithService(ctx, r.Service)
+
+	accessType := AccessTypeOnline
+	if r.Offline {
+		accessType = AccessTypeOffline
+	}
 
+	ctx, err := s.checkClient(ctx, r.ClientID, "", GrantTypePassword, accessType)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	var subject Subject = NewAnonymousSubject(ctx)
+
+	if !r.Anonymous {
 		subject, err = s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
 		if err != nil {
 			return TokenResponse{}, err
 		}
 	}
 
-	grantedScopes, err := s.Authorizer.Authorize(ctx, subject, r.Scopes)
+	grantedScopes, err := s.authorize(ctx, subject, r.Scopes)
 	if err != nil {
 		return TokenResponse{}, err
 	}
 
+	// Some subjects (eg. personal access tokens) may not receive every scope their owner would
+	if subject, ok := subject.(BoundedSubject); ok {
+		grantedScopes = IntersectScopes(grantedScopes, subject.ScopeBounds())
+	}
+
+	grantedScopes = limitClientScopes(ctx, grantedScopes)
+
 	// Sort actions to make sure tokens are more consistent
 	for _, scope := range grantedScopes {
 		slices.Sort(scope.Actions)
@@ -205,7 +283,7 @@ func (s AuthorizationServiceImpl) TokenHandler(ctx context.Context, r TokenReque
 		ExpiresIn: int(token.ExpiresIn.Seconds()),
 	}
 
-	if r.Offline && subject != nil {
+	if r.Offline && canRefresh(subject) {
 		refreshToken, err := s.TokenIssuer.IssueRefreshToken(ctx, r.Service, subject)
 		if err != nil {
 			return TokenResponse{}, err
@@ -222,13 +300,32 @@ func (s AuthorizationServiceImpl) OAuth2Handler(ctx context.Context, r OAuth2Req
 		return OAuth2Response{}, err
 	}
 
+	ctx = contextWithClientID(ctx, r.ClientID)
+	ctx = ContextWithService(ctx, r.Service)
+
+	// Devices (eg. docker credential helpers) use the refresh token as an identity token: without it, the whole flow would be pointless
+	offline := r.AccessType == AccessTypeOffline || r.GrantType == GrantTypeDeviceCode
+
+	// Clients can always present their credentials again, so they never receive refresh tokens (RFC 6749, section 4.4.3)
+	if r.GrantType == GrantTypeClientCredentials {
+		offline = false
+	}
+
+	accessType := AccessTypeOnline
+	if offline {
+		accessType = AccessTypeOffline
+	}
+
+	ctx, err := s.checkClient(ctx, r.ClientID, r.ClientSecret, r.GrantType, accessType)
+	if err != nil {
+		return OAuth2Response{}, err
+	}
+
 	var subject Subject
 	var refreshToken string
 
 	switch r.GrantType {
 	case GrantTypeRefreshToken:
-		var err error
-
 		subject, err = s.Authenticator.AuthenticateRefreshToken(ctx, r.Service, r.RefreshToken)
 		if err != nil {
 			return OAuth2Response{}, err
@@ -236,22 +333,47 @@ func (s AuthorizationServiceImpl) OAuth2Handler(ctx context.Context, r OAuth2Req
 
 		refreshToken = r.RefreshToken
 	case GrantTypePassword:
-		var err error
-
 		subject, err = s.Authenticator.AuthenticatePassword(ctx, r.Username, r.Password)
 		if err != nil {
 			return OAuth2Response{}, err
 		}
+	case GrantTypeDeviceCode:
+		if s.DeviceAuthorizer == nil {
+			return OAuth2Response{}, errDeviceGrantUnsupported
+		}
+
+		subject, err = s.DeviceAuthorizer.AuthenticateDeviceCode(ctx, r.Service, r.ClientID, r.DeviceCode)
+		if err != nil {
+			return OAuth2Response{}, err
+		}
+	case GrantTypeClientCredentials:
+		if s.Authenticator.ClientAuthenticator == nil {
+			return OAuth2Response{}, OAuth2Error{Code: OAuth2ErrorUnsupportedGrantType, Description: "client credentials grant is not supported"}
+		}
+
+		subject, err = s.Authenticator.AuthenticateClient(ctx, r.ClientID, r.ClientSecret)
+		if err != nil {
+			return OAuth2Response{}, err
+		}
+	case GrantTypeTokenExchange:
+		return s.exchangeToken(ctx, r)
 	default:
 		// This should never happen
 		return OAuth2Response{}, errors.New("unknown grant_type value")
 	}
 
-	grantedScopes, err := s.Authorizer.Authorize(ctx, subject, r.Scopes)
+	grantedScopes, err := s.authorize(ctx, subject, r.Scopes)
 	if err != nil {
 		return OAuth2Response{}, err
 	}
 
+	// Some subjects (eg. personal access tokens) may not receive every scope their owner would
+	if subject, ok := subject.(BoundedSubject); ok {
+		grantedScopes = IntersectScopes(grantedScopes, subject.ScopeBounds())
+	}
+
+	grantedScopes = limitClientScopes(ctx, grantedScopes)
+
 	// Sort actions to make sure tokens are more consistent
 	for _, scope := range grantedScopes {
 		slices.Sort(scope.Actions)
@@ -269,7 +391,18 @@ func (s AuthorizationServiceImpl) OAuth2Handler(ctx context.Context, r OAuth2Req
 		Scope:     Scopes(grantedScopes).String(),
 	}
 
-	if r.AccessType == AccessTypeOffline && subject != nil {
+	var rotated bool
+
+	// Rotated refresh tokens may only be used once: the client MUST use the new one next time
+	if rotator, ok := s.TokenIssuer.RefreshTokenIssuer.(RefreshTokenRotator); ok && r.GrantType == GrantTypeRefreshToken {
+		token, err := rotator.RotateRefreshToken(ctx, r.Service, subject, refreshToken)
+		if err != nil {
+			return OAuth2Response{}, err
+		}
+
+		rotated = token != refreshToken
+		refreshToken = token
+	} else if offline && canRefresh(subject) {
 		token, err := s.TokenIssuer.IssueRefreshToken(ctx, r.Service, subject)
 		if err != nil {
 			return OAuth2Response{}, err
@@ -278,13 +411,28 @@ func (s AuthorizationServiceImpl) OAuth2Handler(ctx context.Context, r OAuth2Req
 		refreshToken = token
 	}
 
-	if r.AccessType == AccessTypeOffline && refreshToken != "" {
+	if (offline || rotated) && refreshToken != "" {
 		response.RefreshToken = refreshToken
 	}
 
 	return response, nil
 }
 
+// canRefresh reports whether a refresh token may be issued to a subject.
+//
+// Refresh tokens only carry the ID of the subject: bounded subjects (eg. personal access tokens)
+// would lose their bounds on refresh and outlive their credentials,
+// transient subjects (eg. OIDC identities) could not be reloaded on refresh.
+func canRefresh(subject Subject) bool {
+	if IsAnonymous(subject) || IsTransient(subject) {
+		return false
+	}
+
+	_, bounded := subject.(BoundedSubject)
+
+	return !bounded
+}
+
 // LoggerAuthorizationService acts as a middleware for an [AUthorizationService] and logs every request.
 type LoggerAuthorizationService struct {
 	Service AuthorizationService
@@ -304,7 +452,7 @@ func (s LoggerAuthorizationService) TokenHandler(ctx context.Context, r TokenReq
 		slog.Bool("anonymous", r.Anonymous),
 	)
 
-	if err != nil && !(errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrAuthenticationFailed)) {
+	if err != nil && !isClientError(err) {
 		logger.Error("authorization failed", slog.Any("error", err))
 	} else if err != nil {
 		logger.Info("authorization failed due to client error", slog.Any("error", err))
@@ -328,7 +476,7 @@ func (s LoggerAuthorizationService) OAuth2Handler(ctx context.Context, r OAuth2R
 		slog.String("grant_type", r.GrantType),
 	)
 
-	if err != nil && !(errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrAuthenticationFailed)) {
+	if err != nil && !isClientError(err) {
 		logger.Error("authorization failed", slog.Any("error", err))
 	} else if err != nil {
 		logger.Info("authorization failed due to client error", slog.Any("error", err))
@@ -1,5 +1,10 @@
 package auth
 
+import (
+	"context"
+	"maps"
+)
+
 // SubjectID is the primary identifier of a Subject (a username or an arbitrary ID (eg. UUID)),
 // but it is not necessarily globally unique: authenticators can federate between various providers and/or subject types (eg. human vs machine users).
 // Therefore, SubjectID alone SHOULD NOT be used as a reference to the Subject if uniqueness cannot be guaranteed across the federated providers.
@@ -45,3 +50,88 @@ type Subject interface {
 	// Prefer using Attribute instead.
 	Attributes() map[string]any
 }
+
+// BoundedSubject is a [Subject] whose access is limited to a set of scopes,
+// regardless of what an [Authorizer] would grant otherwise (eg. a subject authenticated with a personal access token).
+//
+// Scopes granted to a BoundedSubject are intersected with its bounds (see [IntersectScopes]).
+// Refresh tokens are never issued to a BoundedSubject: the bounds would not survive a refresh.
+type BoundedSubject interface {
+	Subject
+
+	// ScopeBounds returns the upper bound of scopes the subject may be granted.
+	ScopeBounds() []Scope
+}
+
+// AttributeClientIP is the attribute of an [AnonymousSubject] holding the IP address of the client (if known).
+const AttributeClientIP = "client_ip"
+
+// AnonymousSubject is the [Subject] of requests without credentials.
+//
+// Its ID is empty. Use [IsAnonymous] to detect anonymous subjects.
+type AnonymousSubject struct {
+	Attrs map[string]any
+}
+
+// NewAnonymousSubject returns a new [AnonymousSubject] with attributes derived from ctx (eg. the client IP, see [ClientInfo]).
+func NewAnonymousSubject(ctx context.Context) AnonymousSubject {
+	var subject AnonymousSubject
+
+	if info, ok := ClientInfoFromContext(ctx); ok && info.IP != "" {
+		subject.Attrs = map[string]any{
+			AttributeClientIP: info.IP,
+		}
+	}
+
+	return subject
+}
+
+// ID implements [Subject].
+func (AnonymousSubject) ID() SubjectID {
+	return SubjectIDFromString("")
+}
+
+// Attribute implements [Subject].
+func (s AnonymousSubject) Attribute(key string) (any, bool) {
+	v, ok := s.Attrs[key]
+
+	return v, ok
+}
+
+// Attributes implements [Subject].
+func (s AnonymousSubject) Attributes() map[string]any {
+	return maps.Clone(s.Attrs)
+}
+
+// TransientSubject is a [Subject] that cannot be looked up by its ID,
+// because it only exists for as long as the credentials it was authenticated with
+// (eg. a subject authenticated with an identity token of an external OIDC provider).
+//
+// Refresh tokens are never issued to a transient subject: it could not be reloaded on refresh.
+type TransientSubject interface {
+	Subject
+
+	// Transient reports whether the subject is transient.
+	Transient() bool
+}
+
+// IsTransient reports whether a subject is a [TransientSubject].
+func IsTransient(subject Subject) bool {
+	transient, ok := subject.(TransientSubject)
+
+	return ok && transient.Transient()
+}
+
+// IsAnonymous reports whether a subject is anonymous (ie. nil or an [AnonymousSubject]).
+func IsAnonymous(subject Subject) bool {
+	if subject == nil {
+		return true
+	}
+
+	switch subject.(type) {
+	case AnonymousSubject, *AnonymousSubject:
+		return true
+	}
+
+	return false
+}
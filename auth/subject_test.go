@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,3 +14,37 @@ func TestSubjectID(t *testing.T) {
 	assert.Equal(t, "id", id.String())
 	assert.True(t, id.Equals(other))
 }
+
+func TestAnonymousSubject(t *testing.T) {
+	ctx := ContextWithClientInfo(context.Background(), ClientInfo{IP: "10.0.0.1"})
+
+	subject := NewAnonymousSubject(ctx)
+
+	assert.Equal(t, "", subject.ID().String())
+
+	ip, ok := subject.Attribute(AttributeClientIP)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.1", ip)
+
+	assert.True(t, IsAnonymous(subject))
+	assert.True(t, IsAnonymous(&subject))
+	assert.True(t, IsAnonymous(nil))
+	assert.False(t, IsAnonymous(namedSubject("user")))
+
+	_, ok = NewAnonymousSubject(context.Background()).Attribute(AttributeClientIP)
+	assert.False(t, ok)
+}
+
+type namedSubject string
+
+func (s namedSubject) ID() SubjectID {
+	return SubjectIDFromString(string(s))
+}
+
+func (namedSubject) Attribute(_ string) (any, bool) {
+	return nil, false
+}
+
+func (namedSubject) Attributes() map[string]any {
+	return nil
+}
@@ -26,3 +26,10 @@ type AccessTokenIssuer interface {
 type RefreshTokenIssuer interface {
 	IssueRefreshToken(ctx context.Context, service string, subject Subject) (string, error)
 }
+
+// RefreshTokenRotator is implemented by [RefreshTokenIssuer] implementations that rotate refresh tokens:
+// every time a refresh token is exchanged for an access token, it is replaced by a new one.
+type RefreshTokenRotator interface {
+	// RotateRefreshToken invalidates a (previously verified) refresh token and returns a new one.
+	RotateRefreshToken(ctx context.Context, service string, subject Subject, refreshToken string) (string, error)
+}
@@ -3,6 +3,7 @@ package jwt
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/docker/libtrust"
@@ -16,6 +17,9 @@ type accessTokenClaims struct {
 	jwt.RegisteredClaims
 
 	Access []auth.Scope `json:"access"`
+
+	// Actor is the party acting on behalf of the subject (see [auth.DelegatedSubject]).
+	Actor *auth.Actor `json:"act,omitempty"`
 }
 
 // AccessTokenIssuer issues access tokens according to the [Token Authentication Specification] and [Token Authentication Implementation].
@@ -27,8 +31,9 @@ type AccessTokenIssuer struct {
 	signingKey libtrust.PrivateKey
 	expiration time.Duration
 
-	idGenerator IDGenerator
-	clock       Clock
+	idGenerator      IDGenerator
+	clock            Clock
+	anonymousSubject string
 }
 
 // NewAccessTokenIssuer returns a new AccessTokenIssuer.
@@ -58,7 +63,11 @@ func NewAccessTokenIssuer(issuer string, signingKey libtrust.PrivateKey, expirat
 	return i
 }
 
-func (i AccessTokenIssuer) IssueAccessToken(_ context.Context, service string, subject auth.Subject, grantedScopes []auth.Scope) (auth.AccessToken, error) {
+// IssueAccessToken implements auth.AccessTokenIssuer.
+//
+// The expiration of the token can be overridden per client (see [auth.ClientPolicy]).
+// Tokens issued to an [auth.DelegatedSubject] never expire after [auth.DelegatedSubject.NotAfter].
+func (i AccessTokenIssuer) IssueAccessToken(ctx context.Context, service string, subject auth.Subject, grantedScopes []auth.Scope) (auth.AccessToken, error) {
 	alg, err := detectSigningMethod(i.signingKey)
 	if err != nil {
 		return auth.AccessToken{}, err
@@ -71,19 +80,45 @@ func (i AccessTokenIssuer) IssueAccessToken(_ context.Context, service string, s
 
 	now := i.clock.Now()
 
+	expiration := i.expiration
+	if policy, ok := auth.ClientPolicyFromContext(ctx); ok && policy.AccessTokenExpiration > 0 {
+		expiration = policy.AccessTokenExpiration
+	}
+
+	// Exchanged tokens never outlive the subject token
+	if delegatedSubject, ok := subject.(auth.DelegatedSubject); ok && !delegatedSubject.NotAfter.IsZero() {
+		if notAfter := delegatedSubject.NotAfter.Sub(now); notAfter < expiration {
+			expiration = notAfter
+		}
+
+		if expiration <= 0 {
+			return auth.AccessToken{}, fmt.Errorf("%w: subject token expired", auth.ErrAuthenticationFailed)
+		}
+	}
+
+	sub := i.anonymousSubject
+	if !auth.IsAnonymous(subject) {
+		sub = subject.ID().String()
+	}
+
 	claims := accessTokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        id,
 			Issuer:    i.issuer,
-			Subject:   subject.ID().String(),
+			Subject:   sub,
 			Audience:  []string{service},
-			ExpiresAt: jwt.NewNumericDate(now.Add(i.expiration)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
 			NotBefore: jwt.NewNumericDate(now),
 			IssuedAt:  jwt.NewNumericDate(now),
 		},
 		Access: grantedScopes,
 	}
 
+	if delegatedSubject, ok := subject.(auth.DelegatedSubject); ok {
+		actor := delegatedSubject.Actor
+		claims.Actor = &actor
+	}
+
 	token := jwt.NewWithClaims(alg, claims)
 
 	if x5c := i.signingKey.GetExtendedField("x5c"); x5c != nil {
@@ -104,7 +139,40 @@ func (i AccessTokenIssuer) IssueAccessToken(_ context.Context, service string, s
 
 	return auth.AccessToken{
 		Payload:   signedToken,
-		ExpiresIn: i.expiration,
+		ExpiresIn: expiration,
 		IssuedAt:  now,
 	}, nil
 }
+
+// VerifyAccessToken implements [auth.AccessTokenVerifier].
+func (i AccessTokenIssuer) VerifyAccessToken(_ context.Context, service string, accessToken string) (auth.VerifiedAccessToken, error) {
+	var claims accessTokenClaims
+
+	_, err := jwt.ParseWithClaims(
+		accessToken,
+		&claims,
+		func(_ *jwt.Token) (interface{}, error) {
+			return i.signingKey.CryptoPublicKey(), nil
+		},
+		jwt.WithLeeway(5*time.Second),
+		jwt.WithAudience(service),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(i.clock.Now),
+	)
+	if err != nil {
+		return auth.VerifiedAccessToken{}, fmt.Errorf("%w: %w", auth.ErrAuthenticationFailed, err)
+	}
+
+	token := auth.VerifiedAccessToken{
+		Scopes:    claims.Access,
+		Actor:     claims.Actor,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	if claims.Subject != "" && claims.Subject != i.anonymousSubject {
+		token.SubjectID = auth.SubjectIDFromString(claims.Subject)
+	}
+
+	return token, nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/docker/libtrust"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/jonboulle/clockwork"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -63,3 +64,160 @@ func TestAccessTokenIssuer_IssueAccessToken(t *testing.T) {
 
 	assert.Equal(t, expected, token)
 }
+
+func TestAccessTokenIssuer_IssueAccessToken_Anonymous(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	parse := func(t *testing.T, token auth.AccessToken) jwt.MapClaims {
+		t.Helper()
+
+		claims := jwt.MapClaims{}
+
+		_, err := jwt.ParseWithClaims(token.Payload, claims, func(_ *jwt.Token) (any, error) {
+			return signingKey.PublicKey().CryptoPublicKey(), nil
+		})
+		require.NoError(t, err)
+
+		return claims
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute)
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", auth.AnonymousSubject{}, nil)
+		require.NoError(t, err)
+
+		assert.NotContains(t, parse(t, token), "sub")
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, time.Minute, WithAnonymousSubject("anonymous"))
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", nil, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "anonymous", parse(t, token)["sub"])
+	})
+}
+
+func TestAccessTokenIssuer_IssueAccessToken_NotAfter(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	clock := clockwork.NewFakeClockAt(time.Unix(1257894000, 0))
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithClock(clock))
+
+	subject := auth.DelegatedSubject{
+		Subject: subjectStub{
+			id: auth.SubjectIDFromString("id"),
+		},
+		Actor: auth.Actor{
+			Subject: "orchestrator",
+		},
+		NotAfter: clock.Now().Add(5 * time.Minute),
+	}
+
+	t.Run("Capped", func(t *testing.T) {
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subject, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, 5*time.Minute, token.ExpiresIn)
+
+		verifiedToken, err := tokenIssuer.VerifyAccessToken(context.Background(), "service.example.com", token.Payload)
+		require.NoError(t, err)
+
+		assert.True(t, subject.NotAfter.Equal(verifiedToken.ExpiresAt))
+	})
+
+	t.Run("Later", func(t *testing.T) {
+		subject := subject
+		subject.NotAfter = clock.Now().Add(time.Hour)
+
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subject, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, 15*time.Minute, token.ExpiresIn)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		subject := subject
+		subject.NotAfter = clock.Now()
+
+		_, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subject, nil)
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+}
+
+func TestAccessTokenIssuer_VerifyAccessToken(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	clock := clockwork.NewFakeClock()
+
+	tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithClock(clock))
+
+	subject := auth.DelegatedSubject{
+		Subject: subjectStub{
+			id: auth.SubjectIDFromString("id"),
+		},
+		Actor: auth.Actor{
+			Subject: "build",
+			Actor: &auth.Actor{
+				Subject: "orchestrator",
+			},
+		},
+	}
+
+	scopes := []auth.Scope{
+		{
+			Resource: auth.Resource{
+				Type: "repository",
+				Name: "path/to/repo",
+			},
+			Actions: []string{"pull"},
+		},
+	}
+
+	token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", subject, scopes)
+	require.NoError(t, err)
+
+	t.Run("OK", func(t *testing.T) {
+		verifiedToken, err := tokenIssuer.VerifyAccessToken(context.Background(), "service.example.com", token.Payload)
+		require.NoError(t, err)
+
+		expected := auth.VerifiedAccessToken{
+			SubjectID: auth.SubjectIDFromString("id"),
+			Scopes:    scopes,
+			Actor:     &subject.Actor,
+			ExpiresAt: time.Unix(clock.Now().Add(15*time.Minute).Unix(), 0),
+		}
+
+		assert.Equal(t, expected, verifiedToken)
+	})
+
+	t.Run("Anonymous", func(t *testing.T) {
+		token, err := tokenIssuer.IssueAccessToken(context.Background(), "service.example.com", auth.AnonymousSubject{}, scopes)
+		require.NoError(t, err)
+
+		verifiedToken, err := tokenIssuer.VerifyAccessToken(context.Background(), "service.example.com", token.Payload)
+		require.NoError(t, err)
+
+		assert.Nil(t, verifiedToken.SubjectID)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("OtherService", func(t *testing.T) {
+			_, err := tokenIssuer.VerifyAccessToken(context.Background(), "other.example.com", token.Payload)
+			require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("Expired", func(t *testing.T) {
+			tokenIssuer := NewAccessTokenIssuer("issuer.example.com", signingKey, 15*time.Minute, WithClock(clockwork.NewFakeClockAt(clock.Now().Add(time.Hour))))
+
+			_, err := tokenIssuer.VerifyAccessToken(context.Background(), "service.example.com", token.Payload)
+			require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+	})
+}
@@ -34,7 +34,7 @@ func (w withClock) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
 }
 
 // WIthIDGenerator configures a token issuer to use an IDGenerator.
-func WithIDGenerator(idGenerator IDGenerator) AccessTokenIssuerOption {
+func WithIDGenerator(idGenerator IDGenerator) Option {
 	return withIDGenerator{idGenerator}
 }
 
@@ -45,3 +45,48 @@ type withIDGenerator struct {
 func (w withIDGenerator) applyAccessTokenIssuer(i *AccessTokenIssuer) {
 	i.idGenerator = w.idGenerator
 }
+
+func (w withIDGenerator) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
+	i.idGenerator = w.idGenerator
+}
+
+// WithRefreshTokenStore enables revocation and rotation of refresh tokens.
+func WithRefreshTokenStore(store RefreshTokenStore) RefreshTokenIssuerOption {
+	return withRefreshTokenStore{store}
+}
+
+type withRefreshTokenStore struct {
+	store RefreshTokenStore
+}
+
+func (w withRefreshTokenStore) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
+	i.store = w.store
+}
+
+// WithAnonymousSubject configures the "sub" claim of access tokens issued to anonymous subjects (see [auth.IsAnonymous]).
+// By default, the claim is omitted.
+func WithAnonymousSubject(sub string) AccessTokenIssuerOption {
+	return withAnonymousSubject{sub}
+}
+
+type withAnonymousSubject struct {
+	sub string
+}
+
+func (w withAnonymousSubject) applyAccessTokenIssuer(i *AccessTokenIssuer) {
+	i.anonymousSubject = w.sub
+}
+
+// WithRefreshTokenLifetime makes refresh tokens expire according to a policy
+// (eg. a [RefreshTokenLifetime] or a [SubjectTypeLifetimePolicy]).
+func WithRefreshTokenLifetime(policy RefreshTokenLifetimePolicy) RefreshTokenIssuerOption {
+	return withRefreshTokenLifetime{policy}
+}
+
+type withRefreshTokenLifetime struct {
+	policy RefreshTokenLifetimePolicy
+}
+
+func (w withRefreshTokenLifetime) applyRefreshTokenIssuer(i *RefreshTokenIssuer) {
+	i.lifetime = w.policy
+}
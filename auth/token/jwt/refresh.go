@@ -2,6 +2,8 @@ package jwt
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/docker/libtrust"
@@ -11,12 +13,113 @@ import (
 	"github.com/portward/registry-auth/auth"
 )
 
+type refreshTokenClaims struct {
+	jwt.RegisteredClaims
+
+	// FamilyID identifies the chain of rotated tokens the token belongs to.
+	FamilyID string `json:"fam,omitempty"`
+
+	// AuthTime is the time the subject originally authenticated (preserved across rotations).
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+}
+
+// RefreshTokenLifetime limits how long a refresh token can be used.
+//
+// A zero value means refresh tokens never expire.
+type RefreshTokenLifetime struct {
+	// Absolute is the maximum amount of time refresh tokens can be used after the subject authenticated with credentials.
+	// Rotating a refresh token does not extend it: the subject has to log in again.
+	Absolute time.Duration
+
+	// Idle is the maximum amount of time a refresh token can remain unused.
+	// Every time a refresh token is exchanged, the new token is valid for another Idle period (up to the Absolute lifetime).
+	Idle time.Duration
+}
+
+// RefreshTokenLifetime implements [RefreshTokenLifetimePolicy].
+func (l RefreshTokenLifetime) RefreshTokenLifetime(_ auth.Subject) RefreshTokenLifetime {
+	return l
+}
+
+func (l RefreshTokenLifetime) expiresAt(now time.Time, authTime time.Time) time.Time {
+	var expiresAt time.Time
+
+	if l.Idle > 0 {
+		expiresAt = now.Add(l.Idle)
+	}
+
+	if l.Absolute > 0 {
+		absolute := authTime.Add(l.Absolute)
+
+		if expiresAt.IsZero() || absolute.Before(expiresAt) {
+			expiresAt = absolute
+		}
+	}
+
+	return expiresAt
+}
+
+// RefreshTokenLifetimePolicy determines the lifetime of refresh tokens issued to a subject.
+type RefreshTokenLifetimePolicy interface {
+	RefreshTokenLifetime(subject auth.Subject) RefreshTokenLifetime
+}
+
+// SubjectTypeLifetimePolicy applies different refresh token lifetimes to different types of subjects (eg. humans and robot accounts).
+//
+// The type of a subject is the value of a (string) subject attribute.
+type SubjectTypeLifetimePolicy struct {
+	// Attribute is the subject attribute holding the type of the subject (eg. "type").
+	Attribute string
+
+	// Types maps subject types to lifetimes.
+	Types map[string]RefreshTokenLifetime
+
+	// Default applies to subjects whose type is missing or not listed in Types.
+	Default RefreshTokenLifetime
+}
+
+// RefreshTokenLifetime implements [RefreshTokenLifetimePolicy].
+func (p SubjectTypeLifetimePolicy) RefreshTokenLifetime(subject auth.Subject) RefreshTokenLifetime {
+	if subject == nil {
+		return p.Default
+	}
+
+	v, ok := subject.Attribute(p.Attribute)
+	if !ok {
+		return p.Default
+	}
+
+	subjectType, ok := v.(string)
+	if !ok {
+		return p.Default
+	}
+
+	lifetime, ok := p.Types[subjectType]
+	if !ok {
+		return p.Default
+	}
+
+	return lifetime
+}
+
 // RefreshTokenIssuer issues a refresh token.
+//
+// By default, refresh tokens are stateless: they cannot be revoked and remain valid forever.
+// Configure a [RefreshTokenStore] (see [WithRefreshTokenStore]) to enable revocation and rotation:
+// each token then carries an ID ("jti") and a family ID ("fam") and can only be exchanged once (see [RefreshTokenIssuer.RotateRefreshToken]).
+// Presenting an already rotated token again revokes the whole family, so that a leaked token becomes useless
+// as soon as either the attacker or the legitimate client uses it.
+//
+// Configure a [RefreshTokenLifetimePolicy] (see [WithRefreshTokenLifetime]) to make refresh tokens expire.
+// Client policies (see [auth.ClientPolicy]) may further limit their absolute lifetime.
 type RefreshTokenIssuer struct {
 	issuer     string
 	signingKey libtrust.PrivateKey
 
-	clock Clock
+	store       RefreshTokenStore
+	lifetime    RefreshTokenLifetimePolicy
+	idGenerator IDGenerator
+	clock       Clock
 }
 
 // NewRefreshTokenIssuer returns a new RefreshTokenIssuer.
@@ -30,6 +133,10 @@ func NewRefreshTokenIssuer(issuer string, signingKey libtrust.PrivateKey, opts .
 		opt.applyRefreshTokenIssuer(&i)
 	}
 
+	if i.idGenerator == nil {
+		i.idGenerator = uuidGenerator{}
+	}
+
 	if i.clock == nil {
 		i.clock = clockwork.NewRealClock()
 	}
@@ -38,7 +145,14 @@ func NewRefreshTokenIssuer(issuer string, signingKey libtrust.PrivateKey, opts .
 }
 
 // IssueRefreshToken implements auth.RefreshTokenIssuer.
-func (i RefreshTokenIssuer) IssueRefreshToken(_ context.Context, service string, subject auth.Subject) (string, error) {
+func (i RefreshTokenIssuer) IssueRefreshToken(ctx context.Context, service string, subject auth.Subject) (string, error) {
+	return i.issue(ctx, service, subject, subject.ID().String(), "", time.Time{})
+}
+
+// issue creates a new refresh token.
+// If familyID is empty, a new family is started.
+// If authTime is zero, the subject is considered to have just authenticated.
+func (i RefreshTokenIssuer) issue(ctx context.Context, service string, subject auth.Subject, subjectID string, familyID string, authTime time.Time) (string, error) {
 	alg, err := detectSigningMethod(i.signingKey)
 	if err != nil {
 		return "", err
@@ -46,12 +160,57 @@ func (i RefreshTokenIssuer) IssueRefreshToken(_ context.Context, service string,
 
 	now := i.clock.Now()
 
-	claims := jwt.RegisteredClaims{
-		Issuer:    i.issuer,
-		Subject:   subject.ID().String(),
-		Audience:  []string{service},
-		NotBefore: jwt.NewNumericDate(now),
-		IssuedAt:  jwt.NewNumericDate(now),
+	claims := refreshTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.issuer,
+			Subject:   subjectID,
+			Audience:  []string{service},
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	if lifetime, ok := i.refreshTokenLifetime(ctx, subject); ok {
+		if authTime.IsZero() {
+			authTime = now
+		}
+
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+
+		if expiresAt := lifetime.expiresAt(now, authTime); !expiresAt.IsZero() {
+			claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+		}
+	}
+
+	if i.store != nil {
+		id, err := i.idGenerator.GenerateID()
+		if err != nil {
+			return "", err
+		}
+
+		if familyID == "" {
+			familyID = id
+		}
+
+		claims.ID = id
+		claims.FamilyID = familyID
+
+		record := RefreshTokenRecord{
+			ID:        id,
+			FamilyID:  familyID,
+			SubjectID: subjectID,
+			Service:   service,
+			IssuedAt:  now,
+		}
+
+		if claims.ExpiresAt != nil {
+			record.ExpiresAt = claims.ExpiresAt.Time
+		}
+
+		err = i.store.SaveRefreshToken(ctx, record)
+		if err != nil {
+			return "", fmt.Errorf("saving refresh token: %w", err)
+		}
 	}
 
 	token := jwt.NewWithClaims(alg, claims)
@@ -64,32 +223,148 @@ func (i RefreshTokenIssuer) IssueRefreshToken(_ context.Context, service string,
 	return signedToken, nil
 }
 
-// VerifyRefreshToken implements authn.RefreshTokenVerifier.
-func (i RefreshTokenIssuer) VerifyRefreshToken(_ context.Context, service string, refreshToken string) (auth.SubjectID, error) {
-	var claims jwt.RegisteredClaims
+// refreshTokenLifetime returns the lifetime of refresh tokens issued to a subject and whether it is limited at all.
+//
+// The absolute lifetime is further limited by the policy of the client (see [auth.ClientPolicy]).
+func (i RefreshTokenIssuer) refreshTokenLifetime(ctx context.Context, subject auth.Subject) (RefreshTokenLifetime, bool) {
+	var lifetime RefreshTokenLifetime
 
-	token, err := jwt.ParseWithClaims(refreshToken, &claims, func(_ *jwt.Token) (interface{}, error) {
-		return i.signingKey.CryptoPublicKey(), nil
-	})
-	if err != nil {
-		return nil, err
+	limited := i.lifetime != nil
+
+	if limited {
+		lifetime = i.lifetime.RefreshTokenLifetime(subject)
 	}
-	// TODO: validate audience/service/issuer?
 
-	if !token.Valid { //nolint:staticcheck,revive
-		// TODO: return error?
+	if policy, ok := auth.ClientPolicyFromContext(ctx); ok && policy.RefreshTokenLifetime > 0 {
+		limited = true
+
+		if lifetime.Absolute <= 0 || policy.RefreshTokenLifetime < lifetime.Absolute {
+			lifetime.Absolute = policy.RefreshTokenLifetime
+		}
 	}
 
-	validator := jwt.NewValidator(
-		jwt.WithLeeway(5*time.Second),
+	return lifetime, limited
+}
+
+func (i RefreshTokenIssuer) parse(service string, refreshToken string) (refreshTokenClaims, error) {
+	var claims refreshTokenClaims
+
+	_, err := jwt.ParseWithClaims(refreshToken, &claims, func(_ *jwt.Token) (interface{}, error) {
+		return i.signingKey.CryptoPublicKey(), nil
+	}, jwt.WithTimeFunc(i.clock.Now), jwt.WithLeeway(5*time.Second))
+	if err != nil {
+		return refreshTokenClaims{}, fmt.Errorf("%w: %w", auth.ErrAuthenticationFailed, err)
+	}
+
+	validatorOpts := []jwt.ParserOption{
+		jwt.WithLeeway(5 * time.Second),
 		jwt.WithAudience(service),
 		jwt.WithIssuer(i.issuer),
-	)
+		jwt.WithTimeFunc(i.clock.Now),
+	}
+
+	validator := jwt.NewValidator(validatorOpts...)
 
 	err = validator.Validate(claims)
+	if err != nil {
+		return refreshTokenClaims{}, fmt.Errorf("%w: %w", auth.ErrAuthenticationFailed, err)
+	}
+
+	// Tokens issued before a lifetime policy was configured never expire, so they are not accepted anymore.
+	// Tokens issued under the policy always record the authentication time, even if the policy lets them live forever.
+	if i.lifetime != nil && claims.AuthTime == nil {
+		return refreshTokenClaims{}, fmt.Errorf("%w: token was issued without a lifetime policy", auth.ErrAuthenticationFailed)
+	}
+
+	return claims, nil
+}
+
+// VerifyRefreshToken implements authn.RefreshTokenVerifier.
+func (i RefreshTokenIssuer) VerifyRefreshToken(ctx context.Context, service string, refreshToken string) (auth.SubjectID, error) {
+	claims, err := i.parse(service, refreshToken)
 	if err != nil {
 		return nil, err
 	}
 
+	if i.store != nil {
+		if err := i.checkState(ctx, claims); err != nil {
+			return nil, err
+		}
+	}
+
 	return auth.SubjectIDFromString(claims.Subject), nil
 }
+
+func (i RefreshTokenIssuer) checkState(ctx context.Context, claims refreshTokenClaims) error {
+	// Tokens issued without a store cannot be revoked, so they are not accepted anymore
+	if claims.ID == "" {
+		return auth.ErrAuthenticationFailed
+	}
+
+	record, err := i.store.GetRefreshToken(ctx, claims.ID)
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return err
+	}
+
+	if record.Revoked {
+		return auth.ErrAuthenticationFailed
+	}
+
+	if !record.RotatedAt.IsZero() {
+		return i.revokeFamily(ctx, record.FamilyID)
+	}
+
+	return nil
+}
+
+// revokeFamily revokes a token family after a replayed token is detected and returns the resulting authentication error.
+func (i RefreshTokenIssuer) revokeFamily(ctx context.Context, familyID string) error {
+	if err := i.store.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		return fmt.Errorf("revoking refresh token family: %w", err)
+	}
+
+	return fmt.Errorf("%w: %w", auth.ErrAuthenticationFailed, ErrRefreshTokenReused)
+}
+
+// RotateRefreshToken implements auth.RefreshTokenRotator.
+//
+// Without a [RefreshTokenStore], the original token remains valid.
+// A new token is still issued if the lifetime policy has an idle timeout (to extend it);
+// otherwise the original token is returned.
+func (i RefreshTokenIssuer) RotateRefreshToken(ctx context.Context, service string, subject auth.Subject, refreshToken string) (string, error) {
+	if lifetime, _ := i.refreshTokenLifetime(ctx, subject); i.store == nil && lifetime.Idle <= 0 {
+		return refreshToken, nil
+	}
+
+	claims, err := i.parse(service, refreshToken)
+	if err != nil {
+		return "", err
+	}
+
+	var authTime time.Time
+	if claims.AuthTime != nil {
+		authTime = claims.AuthTime.Time
+	}
+
+	if i.store == nil {
+		return i.issue(ctx, service, subject, claims.Subject, "", authTime)
+	}
+
+	if err := i.checkState(ctx, claims); err != nil {
+		return "", err
+	}
+
+	err = i.store.MarkRefreshTokenRotated(ctx, claims.ID, i.clock.Now())
+	if errors.Is(err, ErrRefreshTokenReused) {
+		// Lost a race against another exchange of the same token
+		return "", i.revokeFamily(ctx, claims.FamilyID)
+	} else if errors.Is(err, ErrRefreshTokenNotFound) {
+		return "", auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return "", err
+	}
+
+	return i.issue(ctx, service, subject, claims.Subject, claims.FamilyID, authTime)
+}
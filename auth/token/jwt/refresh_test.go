@@ -38,3 +38,286 @@ func TestRefreshTokenIssuer_IssueRefreshToken(t *testing.T) {
 
 	assert.Equal(t, expected, token)
 }
+
+type sequenceIDGenerator struct {
+	ids []string
+}
+
+func (g *sequenceIDGenerator) GenerateID() (string, error) {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+
+	return id, nil
+}
+
+func TestRefreshTokenIssuer_RotateRefreshToken(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	const (
+		issuer  = "issuer.example.com"
+		service = "service.example.com"
+	)
+
+	subject := subjectStub{
+		id: auth.SubjectIDFromString("id"),
+	}
+
+	newIssuer := func() (RefreshTokenIssuer, *InMemoryRefreshTokenStore) {
+		store := NewInMemoryRefreshTokenStore()
+		idGenerator := &sequenceIDGenerator{ids: []string{"1", "2", "3", "4"}}
+
+		return NewRefreshTokenIssuer(issuer, signingKey, WithRefreshTokenStore(store), WithIDGenerator(idGenerator)), store
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		tokenIssuer, store := newIssuer()
+
+		token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, subject)
+		require.NoError(t, err)
+
+		subjectID, err := tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.NoError(t, err)
+
+		assert.Equal(t, subject.ID(), subjectID)
+
+		rotatedToken, err := tokenIssuer.RotateRefreshToken(context.Background(), service, subject, token)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, token, rotatedToken)
+
+		record, err := store.GetRefreshToken(context.Background(), "2")
+		require.NoError(t, err)
+
+		assert.Equal(t, "1", record.FamilyID)
+		assert.Equal(t, "id", record.SubjectID)
+
+		subjectID, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, rotatedToken)
+		require.NoError(t, err)
+
+		assert.Equal(t, subject.ID(), subjectID)
+	})
+
+	t.Run("Stateless", func(t *testing.T) {
+		tokenIssuer := NewRefreshTokenIssuer(issuer, signingKey)
+
+		token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, subject)
+		require.NoError(t, err)
+
+		rotatedToken, err := tokenIssuer.RotateRefreshToken(context.Background(), service, subject, token)
+		require.NoError(t, err)
+
+		assert.Equal(t, token, rotatedToken)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Run("Reused", func(t *testing.T) {
+			tokenIssuer, _ := newIssuer()
+
+			token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, subject)
+			require.NoError(t, err)
+
+			rotatedToken, err := tokenIssuer.RotateRefreshToken(context.Background(), service, subject, token)
+			require.NoError(t, err)
+
+			// Replaying the original token revokes the whole family
+			_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+			assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+			_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, rotatedToken)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("Revoked", func(t *testing.T) {
+			tokenIssuer, store := newIssuer()
+
+			token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, subject)
+			require.NoError(t, err)
+
+			err = store.RevokeSubjectRefreshTokens(context.Background(), "id")
+			require.NoError(t, err)
+
+			_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+			_, err = tokenIssuer.RotateRefreshToken(context.Background(), service, subject, token)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+
+		t.Run("StatelessToken", func(t *testing.T) {
+			tokenIssuer, _ := newIssuer()
+
+			token, err := NewRefreshTokenIssuer(issuer, signingKey).IssueRefreshToken(context.Background(), service, subject)
+			require.NoError(t, err)
+
+			_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+			require.Error(t, err)
+
+			assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		})
+	})
+}
+
+func TestRefreshTokenIssuer_Lifetime(t *testing.T) {
+	signingKey, err := libtrust.LoadKeyFile("testdata/private.pem")
+	require.NoError(t, err)
+
+	const (
+		issuer  = "issuer.example.com"
+		service = "service.example.com"
+	)
+
+	human := subjectStub{
+		id:    auth.SubjectIDFromString("human"),
+		attrs: map[string]any{"type": "human"},
+	}
+
+	robot := subjectStub{
+		id:    auth.SubjectIDFromString("robot"),
+		attrs: map[string]any{"type": "robot"},
+	}
+
+	daemon := subjectStub{
+		id:    auth.SubjectIDFromString("daemon"),
+		attrs: map[string]any{"type": "daemon"},
+	}
+
+	policy := SubjectTypeLifetimePolicy{
+		Attribute: "type",
+		Default: RefreshTokenLifetime{
+			Absolute: 24 * time.Hour,
+			Idle:     time.Hour,
+		},
+		Types: map[string]RefreshTokenLifetime{
+			"robot": {
+				Absolute: 30 * 24 * time.Hour,
+			},
+			"daemon": {},
+		},
+	}
+
+	newIssuer := func() (RefreshTokenIssuer, *clockwork.FakeClock) {
+		clock := clockwork.NewFakeClockAt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		return NewRefreshTokenIssuer(issuer, signingKey, WithClock(clock), WithRefreshTokenLifetime(policy)), clock
+	}
+
+	t.Run("Idle", func(t *testing.T) {
+		tokenIssuer, clock := newIssuer()
+
+		token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, human)
+		require.NoError(t, err)
+
+		// Keep using the token within the idle timeout
+		for i := 0; i < 3; i++ {
+			clock.Advance(50 * time.Minute)
+
+			_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+			require.NoError(t, err)
+
+			token, err = tokenIssuer.RotateRefreshToken(context.Background(), service, human, token)
+			require.NoError(t, err)
+		}
+
+		clock.Advance(2 * time.Hour)
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.Error(t, err)
+
+		assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("Absolute", func(t *testing.T) {
+		tokenIssuer, clock := newIssuer()
+
+		token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, human)
+		require.NoError(t, err)
+
+		for i := 0; i < 25; i++ {
+			_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+			require.NoError(t, err, "refresh %d", i)
+
+			token, err = tokenIssuer.RotateRefreshToken(context.Background(), service, human, token)
+			require.NoError(t, err)
+
+			clock.Advance(59 * time.Minute)
+		}
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.Error(t, err)
+
+		assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("SubjectType", func(t *testing.T) {
+		tokenIssuer, clock := newIssuer()
+
+		token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, robot)
+		require.NoError(t, err)
+
+		// Robots have no idle timeout
+		clock.Advance(7 * 24 * time.Hour)
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.NoError(t, err)
+
+		clock.Advance(30 * 24 * time.Hour)
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.Error(t, err)
+	})
+
+	// A zero lifetime means tokens never expire
+	t.Run("Unlimited", func(t *testing.T) {
+		tokenIssuer, clock := newIssuer()
+
+		token, err := tokenIssuer.IssueRefreshToken(context.Background(), service, daemon)
+		require.NoError(t, err)
+
+		clock.Advance(365 * 24 * time.Hour)
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.NoError(t, err)
+	})
+
+	t.Run("ClientPolicy", func(t *testing.T) {
+		tokenIssuer, clock := newIssuer()
+
+		ctx := auth.ContextWithClientPolicy(context.Background(), auth.ClientPolicy{RefreshTokenLifetime: 24 * time.Hour})
+
+		token, err := tokenIssuer.IssueRefreshToken(ctx, service, robot)
+		require.NoError(t, err)
+
+		clock.Advance(23 * time.Hour)
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.NoError(t, err)
+
+		// The client policy is shorter than the lifetime of robots
+		clock.Advance(2 * time.Hour)
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("NoExpiration", func(t *testing.T) {
+		tokenIssuer, clock := newIssuer()
+
+		token, err := NewRefreshTokenIssuer(issuer, signingKey, WithClock(clock)).IssueRefreshToken(context.Background(), service, human)
+		require.NoError(t, err)
+
+		_, err = tokenIssuer.VerifyRefreshToken(context.Background(), service, token)
+		require.Error(t, err)
+
+		assert.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+}
@@ -0,0 +1,166 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRefreshTokenNotFound is returned by a [RefreshTokenStore] when a refresh token does not exist.
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+// ErrRefreshTokenReused is returned by a [RefreshTokenStore] when a refresh token has already been rotated.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// RefreshTokenRecord is the server-side state of a refresh token.
+type RefreshTokenRecord struct {
+	// ID is the "jti" claim of the token.
+	ID string
+
+	// FamilyID identifies the chain of tokens rotated from the same original token (ie. the same login).
+	FamilyID string
+
+	SubjectID string
+	Service   string
+	IssuedAt  time.Time
+
+	// ExpiresAt is the expiration of the token (zero if the token never expires).
+	ExpiresAt time.Time
+
+	// RotatedAt is the time the token was exchanged for a new one (zero if the token is still active).
+	RotatedAt time.Time
+
+	// Revoked is true if the token (or its whole family) has been revoked.
+	Revoked bool
+}
+
+// RefreshTokenStore persists the state of refresh tokens.
+//
+// Implementations MUST be safe for concurrent use.
+type RefreshTokenStore interface {
+	// SaveRefreshToken stores a newly issued refresh token.
+	SaveRefreshToken(ctx context.Context, record RefreshTokenRecord) error
+
+	// GetRefreshToken returns a refresh token by its ID or [ErrRefreshTokenNotFound].
+	GetRefreshToken(ctx context.Context, id string) (RefreshTokenRecord, error)
+
+	// MarkRefreshTokenRotated marks an active refresh token as rotated.
+	//
+	// It MUST be atomic: if the token has already been rotated, it returns [ErrRefreshTokenReused].
+	MarkRefreshTokenRotated(ctx context.Context, id string, rotatedAt time.Time) error
+
+	// RevokeRefreshTokenFamily revokes every refresh token of a family.
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+
+	// RevokeSubjectRefreshTokens revokes every refresh token of a subject (eg. when a user is disabled).
+	RevokeSubjectRefreshTokens(ctx context.Context, subjectID string) error
+}
+
+// InMemoryRefreshTokenStore is a [RefreshTokenStore] keeping records in memory.
+//
+// It is mostly useful for testing and single instance deployments.
+// Records are kept until they are pruned: call [InMemoryRefreshTokenStore.Prune] periodically to keep memory usage bounded.
+type InMemoryRefreshTokenStore struct {
+	mu      sync.Mutex
+	records map[string]RefreshTokenRecord
+}
+
+// NewInMemoryRefreshTokenStore returns a new [InMemoryRefreshTokenStore].
+func NewInMemoryRefreshTokenStore() *InMemoryRefreshTokenStore {
+	return &InMemoryRefreshTokenStore{
+		records: make(map[string]RefreshTokenRecord),
+	}
+}
+
+// SaveRefreshToken implements [RefreshTokenStore].
+func (s *InMemoryRefreshTokenStore) SaveRefreshToken(_ context.Context, record RefreshTokenRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[record.ID] = record
+
+	return nil
+}
+
+// GetRefreshToken implements [RefreshTokenStore].
+func (s *InMemoryRefreshTokenStore) GetRefreshToken(_ context.Context, id string) (RefreshTokenRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return RefreshTokenRecord{}, ErrRefreshTokenNotFound
+	}
+
+	return record, nil
+}
+
+// MarkRefreshTokenRotated implements [RefreshTokenStore].
+func (s *InMemoryRefreshTokenStore) MarkRefreshTokenRotated(_ context.Context, id string, rotatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return ErrRefreshTokenNotFound
+	}
+
+	if !record.RotatedAt.IsZero() {
+		return ErrRefreshTokenReused
+	}
+
+	record.RotatedAt = rotatedAt
+	s.records[id] = record
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily implements [RefreshTokenStore].
+func (s *InMemoryRefreshTokenStore) RevokeRefreshTokenFamily(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, record := range s.records {
+		if record.FamilyID == familyID {
+			record.Revoked = true
+			s.records[id] = record
+		}
+	}
+
+	return nil
+}
+
+// RevokeSubjectRefreshTokens implements [RefreshTokenStore].
+func (s *InMemoryRefreshTokenStore) RevokeSubjectRefreshTokens(_ context.Context, subjectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, record := range s.records {
+		if record.SubjectID == subjectID {
+			record.Revoked = true
+			s.records[id] = record
+		}
+	}
+
+	return nil
+}
+
+// Prune removes records of tokens that can no longer be used: expired and revoked tokens,
+// as well as tokens rotated more than rotatedRetention ago.
+//
+// Rotated tokens are kept for a while to detect reuse:
+// presenting a token whose record was pruned still fails, but does not revoke its family anymore.
+func (s *InMemoryRefreshTokenStore) Prune(now time.Time, rotatedRetention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, record := range s.records {
+		expired := !record.ExpiresAt.IsZero() && !now.Before(record.ExpiresAt)
+		rotated := !record.RotatedAt.IsZero() && !now.Before(record.RotatedAt.Add(rotatedRetention))
+
+		if expired || rotated || record.Revoked {
+			delete(s.records, id)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package jwt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryRefreshTokenStore_Prune(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewInMemoryRefreshTokenStore()
+
+	records := []RefreshTokenRecord{
+		{ID: "active", FamilyID: "active"},
+		{ID: "expired", FamilyID: "expired", ExpiresAt: now},
+		{ID: "revoked", FamilyID: "revoked", Revoked: true},
+		{ID: "rotated", FamilyID: "rotated", RotatedAt: now.Add(-2 * time.Hour)},
+		{ID: "recently-rotated", FamilyID: "rotated", RotatedAt: now.Add(-time.Minute)},
+	}
+
+	for _, record := range records {
+		err := store.SaveRefreshToken(context.Background(), record)
+		require.NoError(t, err)
+	}
+
+	store.Prune(now, time.Hour)
+
+	for _, id := range []string{"active", "recently-rotated"} {
+		_, err := store.GetRefreshToken(context.Background(), id)
+		assert.NoError(t, err, id)
+	}
+
+	for _, id := range []string{"expired", "revoked", "rotated"} {
+		_, err := store.GetRefreshToken(context.Background(), id)
+		assert.ErrorIs(t, err, ErrRefreshTokenNotFound, id)
+	}
+}
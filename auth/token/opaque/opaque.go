@@ -0,0 +1,228 @@
+// Package opaque implements server-side refresh tokens.
+//
+// Unlike JWT refresh tokens, opaque tokens are random strings that reveal nothing about the subject or the issuer.
+// Every token represents a session: only a hash of the token is stored along with the subject, service, client ID and timestamps.
+// Sessions expire after a fixed amount of time and can be listed and revoked at any time.
+// A token can only be redeemed by the client it was issued to.
+package opaque
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/internal/secret"
+)
+
+// Prefix is prepended to every token to make them easy to recognize (eg. by secret scanners).
+const Prefix = "rt_"
+
+// DefaultTTL is the default amount of time a session remains valid.
+const DefaultTTL = 30 * 24 * time.Hour
+
+// ErrSessionNotFound is returned by a [Store] when a session cannot be found.
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session describes a refresh token issued to a subject.
+type Session struct {
+	ID        string
+	SubjectID string
+	Service   string
+	ClientID  string
+
+	// Hash is the hex encoded SHA-256 hash of the refresh token.
+	Hash string
+
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// LastUsedAt is the time the token was last exchanged for an access token (if ever).
+	LastUsedAt time.Time
+}
+
+// Expired checks if a session has expired.
+func (s Session) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// Store persists sessions.
+type Store interface {
+	// CreateSession stores a new session.
+	CreateSession(ctx context.Context, session Session) error
+
+	// GetSessionByHash returns a session by the hash of its refresh token or [ErrSessionNotFound].
+	GetSessionByHash(ctx context.Context, hash string) (Session, error)
+
+	// ListSessions returns every session of a subject.
+	ListSessions(ctx context.Context, subjectID string) ([]Session, error)
+
+	// UpdateLastUsedAt records the last time a session was used.
+	UpdateLastUsedAt(ctx context.Context, id string, lastUsedAt time.Time) error
+
+	// DeleteSession deletes a session of a subject or returns [ErrSessionNotFound].
+	DeleteSession(ctx context.Context, subjectID string, id string) error
+
+	// DeleteSessions deletes every session of a subject.
+	DeleteSessions(ctx context.Context, subjectID string) error
+}
+
+// RefreshTokenIssuer issues opaque refresh tokens and verifies them.
+//
+// It implements [auth.RefreshTokenIssuer] and authn.RefreshTokenVerifier.
+type RefreshTokenIssuer struct {
+	store Store
+
+	ttl   time.Duration
+	clock clockwork.Clock
+}
+
+// Option configures a [RefreshTokenIssuer].
+type Option interface {
+	apply(i *RefreshTokenIssuer)
+}
+
+// WithClock configures a [RefreshTokenIssuer] to use a Clock.
+func WithClock(clock clockwork.Clock) Option {
+	return withClock{clock}
+}
+
+type withClock struct {
+	clock clockwork.Clock
+}
+
+func (w withClock) apply(i *RefreshTokenIssuer) {
+	i.clock = w.clock
+}
+
+// WithTTL configures how long sessions remain valid. Defaults to [DefaultTTL].
+func WithTTL(ttl time.Duration) Option {
+	return withTTL{ttl}
+}
+
+type withTTL struct {
+	ttl time.Duration
+}
+
+func (w withTTL) apply(i *RefreshTokenIssuer) {
+	i.ttl = w.ttl
+}
+
+// NewRefreshTokenIssuer returns a new [RefreshTokenIssuer].
+func NewRefreshTokenIssuer(store Store, opts ...Option) RefreshTokenIssuer {
+	i := RefreshTokenIssuer{
+		store: store,
+	}
+
+	for _, opt := range opts {
+		opt.apply(&i)
+	}
+
+	if i.ttl <= 0 {
+		i.ttl = DefaultTTL
+	}
+
+	if i.clock == nil {
+		i.clock = clockwork.NewRealClock()
+	}
+
+	return i
+}
+
+// IssueRefreshToken implements [auth.RefreshTokenIssuer].
+//
+// The client ID is taken from the context (see [auth.ClientInfo]).
+// Client policies (see [auth.ClientPolicy]) may shorten the lifetime of the session.
+func (i RefreshTokenIssuer) IssueRefreshToken(ctx context.Context, service string, subject auth.Subject) (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+
+	token, err := secret.New(Prefix)
+	if err != nil {
+		return "", err
+	}
+
+	now := i.clock.Now()
+	ttl := i.ttl
+
+	if policy, ok := auth.ClientPolicyFromContext(ctx); ok && policy.RefreshTokenLifetime > 0 && policy.RefreshTokenLifetime < ttl {
+		ttl = policy.RefreshTokenLifetime
+	}
+
+	session := Session{
+		ID:        id.String(),
+		SubjectID: subject.ID().String(),
+		Service:   service,
+		Hash:      secret.Hash(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	if info, ok := auth.ClientInfoFromContext(ctx); ok {
+		session.ClientID = info.ClientID
+	}
+
+	if err := i.store.CreateSession(ctx, session); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// VerifyRefreshToken implements authn.RefreshTokenVerifier.
+//
+// The client ID is taken from the context (see [auth.ClientInfo]): it has to match the client the token was issued to.
+func (i RefreshTokenIssuer) VerifyRefreshToken(ctx context.Context, service string, refreshToken string) (auth.SubjectID, error) {
+	if !strings.HasPrefix(refreshToken, Prefix) {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	session, err := i.store.GetSessionByHash(ctx, secret.Hash(refreshToken))
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, err
+	}
+
+	var clientID string
+	if info, ok := auth.ClientInfoFromContext(ctx); ok {
+		clientID = info.ClientID
+	}
+
+	now := i.clock.Now()
+
+	if session.Service != service || session.ClientID != clientID || session.Expired(now) {
+		return nil, auth.ErrAuthenticationFailed
+	}
+
+	// The session may have been revoked concurrently
+	err = i.store.UpdateLastUsedAt(ctx, session.ID, now)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, auth.ErrAuthenticationFailed
+	} else if err != nil {
+		return nil, err
+	}
+
+	return auth.SubjectIDFromString(session.SubjectID), nil
+}
+
+// ListSessions returns every session of a subject.
+func (i RefreshTokenIssuer) ListSessions(ctx context.Context, subjectID auth.SubjectID) ([]Session, error) {
+	return i.store.ListSessions(ctx, subjectID.String())
+}
+
+// RevokeSession revokes a session of a subject.
+func (i RefreshTokenIssuer) RevokeSession(ctx context.Context, subjectID auth.SubjectID, id string) error {
+	return i.store.DeleteSession(ctx, subjectID.String(), id)
+}
+
+// RevokeSessions revokes every session of a subject (eg. when the subject is disabled or changes their password).
+func (i RefreshTokenIssuer) RevokeSessions(ctx context.Context, subjectID auth.SubjectID) error {
+	return i.store.DeleteSessions(ctx, subjectID.String())
+}
@@ -0,0 +1,207 @@
+package opaque
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/portward/registry-auth/auth"
+	"github.com/portward/registry-auth/auth/authn"
+	"github.com/portward/registry-auth/internal/secret"
+)
+
+// revokingStore revokes sessions right after they are looked up (as if they were revoked concurrently).
+type revokingStore struct {
+	*InMemoryStore
+}
+
+func (s revokingStore) GetSessionByHash(ctx context.Context, hash string) (Session, error) {
+	session, err := s.InMemoryStore.GetSessionByHash(ctx, hash)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, s.DeleteSession(ctx, session.SubjectID, session.ID)
+}
+
+func TestRefreshTokenIssuer(t *testing.T) {
+	user := authn.User{
+		Enabled:  true,
+		Username: "user",
+	}
+
+	newIssuer := func() (RefreshTokenIssuer, *clockwork.FakeClock) {
+		clock := clockwork.NewFakeClockAt(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		return NewRefreshTokenIssuer(NewInMemoryStore(), WithClock(clock)), clock
+	}
+
+	t.Run("OK", func(t *testing.T) {
+		issuer, clock := newIssuer()
+
+		ctx := auth.ContextWithClientInfo(context.Background(), auth.ClientInfo{ClientID: "docker"})
+
+		token, err := issuer.IssueRefreshToken(ctx, "registry", user)
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(token, Prefix))
+
+		clock.Advance(time.Hour)
+
+		subjectID, err := issuer.VerifyRefreshToken(ctx, "registry", token)
+		require.NoError(t, err)
+
+		assert.Equal(t, user.ID(), subjectID)
+
+		sessions, err := issuer.ListSessions(context.Background(), user.ID())
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+
+		session := sessions[0]
+
+		assert.Equal(t, user.ID().String(), session.SubjectID)
+		assert.Equal(t, "registry", session.Service)
+		assert.Equal(t, "docker", session.ClientID)
+		assert.NotContains(t, session.Hash, token)
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), session.CreatedAt)
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).Add(DefaultTTL), session.ExpiresAt)
+		assert.Equal(t, time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), session.LastUsedAt)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		issuer, _ := newIssuer()
+
+		token, err := issuer.IssueRefreshToken(auth.ContextWithClientInfo(context.Background(), auth.ClientInfo{ClientID: "docker"}), "registry", user)
+		require.NoError(t, err)
+
+		testCases := []struct {
+			name     string
+			service  string
+			clientID string
+			token    string
+		}{
+			{
+				name:     "UnknownToken",
+				service:  "registry",
+				clientID: "docker",
+				token:    Prefix + "unknown",
+			},
+			{
+				name:     "MissingPrefix",
+				service:  "registry",
+				clientID: "docker",
+				token:    strings.TrimPrefix(token, Prefix),
+			},
+			{
+				name:     "OtherService",
+				service:  "other",
+				clientID: "docker",
+				token:    token,
+			},
+			{
+				name:     "OtherClient",
+				service:  "registry",
+				clientID: "podman",
+				token:    token,
+			},
+		}
+
+		for _, testCase := range testCases {
+			testCase := testCase
+
+			t.Run(testCase.name, func(t *testing.T) {
+				ctx := auth.ContextWithClientInfo(context.Background(), auth.ClientInfo{ClientID: testCase.clientID})
+
+				_, err := issuer.VerifyRefreshToken(ctx, testCase.service, testCase.token)
+				require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+			})
+		}
+	})
+
+	t.Run("RevokedConcurrently", func(t *testing.T) {
+		issuer := NewRefreshTokenIssuer(revokingStore{NewInMemoryStore()})
+
+		ctx := auth.ContextWithClientInfo(context.Background(), auth.ClientInfo{ClientID: "docker"})
+
+		token, err := issuer.IssueRefreshToken(ctx, "registry", user)
+		require.NoError(t, err)
+
+		_, err = issuer.VerifyRefreshToken(ctx, "registry", token)
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		issuer, clock := newIssuer()
+
+		ctx := auth.ContextWithClientPolicy(context.Background(), auth.ClientPolicy{RefreshTokenLifetime: 24 * time.Hour})
+
+		token, err := issuer.IssueRefreshToken(ctx, "registry", user)
+		require.NoError(t, err)
+
+		clock.Advance(23 * time.Hour)
+
+		_, err = issuer.VerifyRefreshToken(context.Background(), "registry", token)
+		require.NoError(t, err)
+
+		// The client policy is shorter than the default TTL
+		clock.Advance(time.Hour)
+
+		_, err = issuer.VerifyRefreshToken(context.Background(), "registry", token)
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+		issuer.store.(*InMemoryStore).Prune(clock.Now())
+
+		sessions, err := issuer.ListSessions(context.Background(), user.ID())
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		issuer, _ := newIssuer()
+
+		token1, err := issuer.IssueRefreshToken(context.Background(), "registry", user)
+		require.NoError(t, err)
+
+		token2, err := issuer.IssueRefreshToken(context.Background(), "registry", user)
+		require.NoError(t, err)
+
+		token3, err := issuer.IssueRefreshToken(context.Background(), "registry", user)
+		require.NoError(t, err)
+
+		sessions, err := issuer.ListSessions(context.Background(), user.ID())
+		require.NoError(t, err)
+		require.Len(t, sessions, 3)
+
+		session, err := issuer.store.GetSessionByHash(context.Background(), secret.Hash(token1))
+		require.NoError(t, err)
+
+		err = issuer.RevokeSession(context.Background(), auth.SubjectIDFromString("other"), session.ID)
+		require.ErrorIs(t, err, ErrSessionNotFound)
+
+		err = issuer.RevokeSession(context.Background(), user.ID(), session.ID)
+		require.NoError(t, err)
+
+		_, err = issuer.VerifyRefreshToken(context.Background(), "registry", token1)
+		require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+
+		_, err = issuer.VerifyRefreshToken(context.Background(), "registry", token2)
+		require.NoError(t, err)
+
+		err = issuer.RevokeSessions(context.Background(), user.ID())
+		require.NoError(t, err)
+
+		for _, token := range []string{token2, token3} {
+			_, err = issuer.VerifyRefreshToken(context.Background(), "registry", token)
+			require.ErrorIs(t, err, auth.ErrAuthenticationFailed)
+		}
+
+		sessions, err = issuer.ListSessions(context.Background(), user.ID())
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+	})
+}
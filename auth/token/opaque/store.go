@@ -0,0 +1,108 @@
+package opaque
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/portward/registry-auth/internal/secret"
+)
+
+// InMemoryStore is a [Store] keeping sessions in memory.
+//
+// It is primarily useful for testing and single instance deployments: sessions are lost when the process exits.
+// Expired sessions are kept until they are pruned (see [InMemoryStore.Prune]).
+type InMemoryStore struct {
+	sessions *secret.Store[Session]
+}
+
+// NewInMemoryStore returns a new [InMemoryStore].
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		sessions: secret.NewStore(
+			func(session Session) string { return session.ID },
+			func(session Session) []string { return []string{session.Hash} },
+		),
+	}
+}
+
+// CreateSession implements [Store].
+func (s *InMemoryStore) CreateSession(_ context.Context, session Session) error {
+	if !s.sessions.Add(session) {
+		return errors.New("refresh token hash collision")
+	}
+
+	return nil
+}
+
+// GetSessionByHash implements [Store].
+func (s *InMemoryStore) GetSessionByHash(_ context.Context, hash string) (Session, error) {
+	session, ok := s.sessions.Lookup(hash)
+	if !ok {
+		return Session{}, ErrSessionNotFound
+	}
+
+	return session, nil
+}
+
+// ListSessions implements [Store].
+func (s *InMemoryStore) ListSessions(_ context.Context, subjectID string) ([]Session, error) {
+	sessions := s.sessions.Filter(func(session Session) bool {
+		return session.SubjectID == subjectID
+	})
+
+	slices.SortFunc(sessions, func(a Session, b Session) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return sessions, nil
+}
+
+// UpdateLastUsedAt implements [Store].
+func (s *InMemoryStore) UpdateLastUsedAt(_ context.Context, id string, lastUsedAt time.Time) error {
+	ok := s.sessions.Update(id, func(session *Session) bool {
+		session.LastUsedAt = lastUsedAt
+
+		return true
+	})
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteSession implements [Store].
+func (s *InMemoryStore) DeleteSession(_ context.Context, subjectID string, id string) error {
+	ok := s.sessions.Delete(id, func(session Session) bool {
+		return session.SubjectID == subjectID
+	})
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteSessions implements [Store].
+func (s *InMemoryStore) DeleteSessions(_ context.Context, subjectID string) error {
+	s.sessions.DeleteFunc(func(session Session) bool {
+		return session.SubjectID == subjectID
+	})
+
+	return nil
+}
+
+// Prune removes expired sessions.
+// Call it periodically to keep memory usage bounded.
+func (s *InMemoryStore) Prune(now time.Time) {
+	s.sessions.DeleteFunc(func(session Session) bool {
+		return session.Expired(now)
+	})
+}
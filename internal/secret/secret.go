@@ -0,0 +1,29 @@
+// Package secret implements the plumbing shared by server-side credentials (eg. personal access tokens, opaque refresh tokens and device codes):
+// random secret generation, hashing and an in-memory store indexed by hashes.
+package secret
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// New returns a new random (256-bit, base64url encoded) secret with a prefix prepended.
+func New(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of a secret.
+//
+// Secrets are random, so a fast hash is enough to protect them at rest.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,78 @@
+package secret
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	s1, err := New("pat_")
+	require.NoError(t, err)
+
+	s2, err := New("pat_")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(s1, "pat_"))
+	assert.NotEqual(t, s1, s2)
+	assert.NotEqual(t, Hash(s1), Hash(s2))
+	assert.Len(t, Hash(s1), 64)
+}
+
+type record struct {
+	id    string
+	hash  string
+	owner string
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(
+		func(r record) string { return r.id },
+		func(r record) []string { return []string{r.hash} },
+	)
+
+	require.True(t, store.Add(record{id: "1", hash: "a", owner: "user"}))
+	require.True(t, store.Add(record{id: "2", hash: "b", owner: "other"}))
+
+	// Lookup keys are unique
+	assert.False(t, store.Add(record{id: "3", hash: "a"}))
+
+	r, ok := store.Lookup("a")
+	require.True(t, ok)
+	assert.Equal(t, "1", r.id)
+
+	// Replacing a record drops its previous lookup keys
+	require.True(t, store.Add(record{id: "3", hash: "c"}))
+	require.True(t, store.Add(record{id: "3", hash: "d"}))
+
+	_, ok = store.Lookup("c")
+	assert.False(t, ok)
+
+	r, ok = store.Lookup("d")
+	require.True(t, ok)
+	assert.Equal(t, "3", r.id)
+	assert.True(t, store.Delete("3", nil))
+
+	ok = store.Update("1", func(r *record) bool {
+		r.owner = "admin"
+
+		return true
+	})
+	require.True(t, ok)
+
+	r, _ = store.Lookup("a")
+	assert.Equal(t, "admin", r.owner)
+
+	assert.False(t, store.Update("unknown", func(_ *record) bool { return true }))
+	assert.False(t, store.Delete("2", func(r record) bool { return r.owner == "user" }))
+	assert.True(t, store.Delete("2", nil))
+
+	_, ok = store.Lookup("b")
+	assert.False(t, ok)
+
+	store.DeleteFunc(func(r record) bool { return r.owner == "admin" })
+
+	assert.Empty(t, store.Filter(func(_ record) bool { return true }))
+}
@@ -0,0 +1,142 @@
+package secret
+
+import "sync"
+
+// Store keeps records in memory, indexed by their ID and by unique lookup keys (eg. the hash of a secret).
+//
+// It is safe for concurrent use.
+type Store[T any] struct {
+	mu      sync.RWMutex
+	records map[string]T
+	keys    map[string]string
+
+	id         func(record T) string
+	lookupKeys func(record T) []string
+}
+
+// NewStore returns a new [Store].
+//
+// id returns the ID of a record, lookupKeys returns the keys a record can be looked up by.
+func NewStore[T any](id func(record T) string, lookupKeys func(record T) []string) *Store[T] {
+	return &Store[T]{
+		records:    make(map[string]T),
+		keys:       make(map[string]string),
+		id:         id,
+		lookupKeys: lookupKeys,
+	}
+}
+
+// Add adds a new record or replaces the record with the same ID (and its lookup keys).
+//
+// It returns false if a lookup key of the record is already taken by another record.
+func (s *Store[T]) Add(record T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.id(record)
+	keys := s.lookupKeys(record)
+
+	for _, key := range keys {
+		if other, ok := s.keys[key]; ok && other != id {
+			return false
+		}
+	}
+
+	if previous, ok := s.records[id]; ok {
+		s.deleteLocked(id, previous)
+	}
+
+	s.records[id] = record
+
+	for _, key := range keys {
+		s.keys[key] = id
+	}
+
+	return true
+}
+
+// Lookup returns a record by one of its lookup keys.
+func (s *Store[T]) Lookup(key string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.keys[key]
+	if !ok {
+		var zero T
+
+		return zero, false
+	}
+
+	return s.records[id], true
+}
+
+// Update modifies a record atomically.
+//
+// fn returns false to leave the record untouched. It MUST NOT change the ID or the lookup keys of the record.
+// Update returns false if the record does not exist or fn left it untouched.
+func (s *Store[T]) Update(id string, fn func(record *T) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok || !fn(&record) {
+		return false
+	}
+
+	s.records[id] = record
+
+	return true
+}
+
+// Delete deletes a record if match (if any) returns true for it.
+//
+// It returns false if the record does not exist or does not match.
+func (s *Store[T]) Delete(id string, match func(record T) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok || (match != nil && !match(record)) {
+		return false
+	}
+
+	s.deleteLocked(id, record)
+
+	return true
+}
+
+// DeleteFunc deletes every record match returns true for.
+func (s *Store[T]) DeleteFunc(match func(record T) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, record := range s.records {
+		if match(record) {
+			s.deleteLocked(id, record)
+		}
+	}
+}
+
+func (s *Store[T]) deleteLocked(id string, record T) {
+	delete(s.records, id)
+
+	for _, key := range s.lookupKeys(record) {
+		delete(s.keys, key)
+	}
+}
+
+// Filter returns every record match returns true for (in no particular order).
+func (s *Store[T]) Filter(match func(record T) bool) []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []T
+
+	for _, record := range s.records {
+		if match(record) {
+			records = append(records, record)
+		}
+	}
+
+	return records
+}
@@ -0,0 +1,90 @@
+// Package fswatch watches individual files for changes.
+package fswatch
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is the default amount of time Watch waits for subsequent events before calling the change handler.
+const DefaultDebounce = 100 * time.Millisecond
+
+// Watch watches a file for changes and calls onChange every time the file is written, created, replaced or removed.
+//
+// Watch monitors the parent directory instead of the file itself,
+// so that atomic replacements (eg. rename or symlink swaps used by editors and Kubernetes ConfigMaps) are detected as well.
+// Bursts of events are coalesced: onChange is only called once no events arrived for the duration of debounce.
+//
+// Watch blocks until ctx is canceled or the watcher fails.
+// It returns nil when ctx is canceled.
+func Watch(ctx context.Context, path string, debounce time.Duration, onChange func()) error {
+	path = filepath.Clean(path)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+
+	// Created stopped so that the first reset starts from a clean state.
+	timer := time.NewTimer(debounce)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if !isRelevant(path, event) {
+				continue
+			}
+
+			timer.Reset(debounce)
+
+		case <-timer.C:
+			onChange()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+func isRelevant(path string, event fsnotify.Event) bool {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return false
+	}
+
+	name := filepath.Clean(event.Name)
+
+	if name == path {
+		return true
+	}
+
+	// Kubernetes mounts ConfigMaps and Secrets through a "..data" symlink that gets swapped atomically.
+	return filepath.Base(name) == "..data"
+}